@@ -0,0 +1,170 @@
+package casefold
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/caddyserver/caddy/v2"
+)
+
+func init() {
+	caddy.RegisterModule(adminAPI{})
+}
+
+// adminAPI serves casefold endpoints on Caddy's admin API:
+//
+//	GET    /casefold/cache            statistics for every fs mode cache
+//	DELETE /casefold/cache[?root=]    purge cached resolutions (optionally for one root)
+//	GET    /casefold/excludes[/name]  live exclude patterns, by handler name
+//	POST   /casefold/excludes/name    add patterns (JSON array body)
+//	DELETE /casefold/excludes/name    remove patterns (JSON array body)
+type adminAPI struct{}
+
+// CaddyModule returns the Caddy module information.
+func (adminAPI) CaddyModule() caddy.ModuleInfo { //nolint:revive
+	return caddy.ModuleInfo{
+		ID:  "admin.api.casefold",
+		New: func() caddy.Module { return new(adminAPI) },
+	}
+}
+
+// Routes implements caddy.AdminRouter.
+func (a adminAPI) Routes() []caddy.AdminRoute { //nolint:revive
+	return []caddy.AdminRoute{
+		{
+			Pattern: "/casefold/cache",
+			Handler: caddy.AdminHandlerFunc(a.handleCache),
+		},
+		{
+			Pattern: "/casefold/excludes",
+			Handler: caddy.AdminHandlerFunc(a.handleExcludes),
+		},
+		{
+			Pattern: "/casefold/excludes/",
+			Handler: caddy.AdminHandlerFunc(a.handleExcludes),
+		},
+	}
+}
+
+// cacheReport describes one shared fs mode cache.
+type cacheReport struct {
+	Root string `json:"root"`
+	Key  string `json:"key"`
+	cacheStats
+}
+
+func (adminAPI) handleCache(w http.ResponseWriter, r *http.Request) error {
+	switch r.Method {
+	case http.MethodGet:
+		reports := []cacheReport{}
+		rangeCaches(func(key string, st *fsState) {
+			reports = append(reports, cacheReport{Root: st.root, Key: key, cacheStats: st.cache.Stats()})
+		})
+		sort.Slice(reports, func(i, j int) bool { return reports[i].Key < reports[j].Key })
+		w.Header().Set("Content-Type", "application/json")
+		return json.NewEncoder(w).Encode(reports)
+	case http.MethodDelete:
+		root := r.URL.Query().Get("root")
+		purged := 0
+		rangeCaches(func(_ string, st *fsState) {
+			if root == "" || root == st.root {
+				purged += st.cache.Purge()
+			}
+		})
+		w.Header().Set("Content-Type", "application/json")
+		return json.NewEncoder(w).Encode(map[string]int{"purged": purged})
+	default:
+		return caddy.APIError{
+			HTTPStatus: http.StatusMethodNotAllowed,
+			Err:        fmt.Errorf("method not allowed: %v", r.Method),
+		}
+	}
+}
+
+// handleExcludes lists and patches the exclude patterns of live handlers.
+// Patches last until the handlers are replaced by a config reload.
+func (adminAPI) handleExcludes(w http.ResponseWriter, r *http.Request) error {
+	name := strings.Trim(strings.TrimPrefix(r.URL.Path, "/casefold/excludes"), "/")
+	if name == "" {
+		if r.Method != http.MethodGet {
+			return caddy.APIError{
+				HTTPStatus: http.StatusMethodNotAllowed,
+				Err:        fmt.Errorf("method not allowed: %v", r.Method),
+			}
+		}
+		all := make(map[string][]string)
+		for _, n := range handlerNames() {
+			all[n] = excludesOf(handlersNamed(n))
+		}
+		w.Header().Set("Content-Type", "application/json")
+		return json.NewEncoder(w).Encode(all)
+	}
+
+	hs := handlersNamed(name)
+	if len(hs) == 0 {
+		return caddy.APIError{
+			HTTPStatus: http.StatusNotFound,
+			Err:        fmt.Errorf("no casefold handler named %q", name),
+		}
+	}
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPost, http.MethodDelete:
+		var patterns []string
+		if err := json.NewDecoder(r.Body).Decode(&patterns); err != nil {
+			return caddy.APIError{
+				HTTPStatus: http.StatusBadRequest,
+				Err:        fmt.Errorf("decoding request body: %v", err),
+			}
+		}
+		if err := validateExcludes(patterns); err != nil {
+			return caddy.APIError{HTTPStatus: http.StatusBadRequest, Err: err}
+		}
+		for _, c := range hs {
+			if r.Method == http.MethodPost {
+				c.excludes.Add(patterns...)
+			} else {
+				c.excludes.Remove(patterns...)
+			}
+		}
+	default:
+		return caddy.APIError{
+			HTTPStatus: http.StatusMethodNotAllowed,
+			Err:        fmt.Errorf("method not allowed: %v", r.Method),
+		}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	return json.NewEncoder(w).Encode(excludesOf(hs))
+}
+
+// excludesOf merges the live patterns of hs, in first-seen order.
+func excludesOf(hs []*Casefold) []string {
+	patterns := []string{}
+	for _, c := range hs {
+		for _, p := range c.excludes.All() {
+			if !containsString(patterns, p) {
+				patterns = append(patterns, p)
+			}
+		}
+	}
+	return patterns
+}
+
+// rangeCaches calls f for every shared fs state that has a cache.
+func rangeCaches(f func(key string, st *fsState)) {
+	fsStates.Range(func(k, v any) bool {
+		if st, ok := v.(*fsState); ok && st.cache != nil {
+			f(k.(string), st)
+		}
+		return true
+	})
+}
+
+// Interface guards
+var (
+	_ caddy.Module      = adminAPI{}
+	_ caddy.AdminRouter = adminAPI{}
+)
@@ -0,0 +1,139 @@
+package casefold
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/caddyserver/caddy/v2"
+)
+
+func TestAdminCacheStatsAndPurge(t *testing.T) {
+	root := t.TempDir()
+	if err := os.Mkdir(filepath.Join(root, "Docs"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	c := &Casefold{Mode: "fs", Root: root, CacheSize: 8}
+	if err := c.Provision(caddy.Context{}); err != nil {
+		t.Fatal(err)
+	}
+	defer c.Cleanup()
+	c.resolveFS("/docs")
+	c.resolveFS("/docs")
+
+	find := func() *cacheReport {
+		rr := httptest.NewRecorder()
+		if err := (adminAPI{}).handleCache(rr, httptest.NewRequest(http.MethodGet, "/casefold/cache", nil)); err != nil {
+			t.Fatal(err)
+		}
+		var reports []cacheReport
+		if err := json.NewDecoder(rr.Body).Decode(&reports); err != nil {
+			t.Fatal(err)
+		}
+		for i := range reports {
+			if reports[i].Root == c.Root {
+				return &reports[i]
+			}
+		}
+		t.Fatalf("no report for %s in %+v", c.Root, reports)
+		return nil
+	}
+	rep := find()
+	if rep.Entries != 1 || rep.Capacity != 8 || rep.Hits != 1 || rep.Misses != 1 || rep.HitRatio != 0.5 || rep.MemoryBytes == 0 {
+		t.Fatalf("unexpected stats: %+v", rep)
+	}
+
+	rr := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodDelete, "/casefold/cache?root="+c.Root, nil)
+	if err := (adminAPI{}).handleCache(rr, req); err != nil {
+		t.Fatal(err)
+	}
+	var purged map[string]int
+	if err := json.NewDecoder(rr.Body).Decode(&purged); err != nil {
+		t.Fatal(err)
+	}
+	if purged["purged"] != 1 {
+		t.Fatalf("expected 1 entry purged, got %v", purged)
+	}
+	if rep := find(); rep.Entries != 0 {
+		t.Fatalf("expected empty cache after purge, got %+v", rep)
+	}
+}
+
+func TestAdminCacheMethodNotAllowed(t *testing.T) {
+	err := (adminAPI{}).handleCache(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/casefold/cache", nil))
+	if apiErr, ok := err.(caddy.APIError); !ok || apiErr.HTTPStatus != http.StatusMethodNotAllowed {
+		t.Fatalf("expected 405 API error, got %v", err)
+	}
+}
+
+func TestAdminPatchExcludes(t *testing.T) {
+	c := &Casefold{Mode: "lower", Name: "admin-test", Exclude: []string{"/api/*"}}
+	if err := c.Provision(caddy.Context{}); err != nil {
+		t.Fatal(err)
+	}
+	defer c.Cleanup()
+	call := func(method, body string) []string {
+		t.Helper()
+		rr := httptest.NewRecorder()
+		req := httptest.NewRequest(method, "/casefold/excludes/admin-test", strings.NewReader(body))
+		if err := (adminAPI{}).handleExcludes(rr, req); err != nil {
+			t.Fatal(err)
+		}
+		var patterns []string
+		if err := json.NewDecoder(rr.Body).Decode(&patterns); err != nil {
+			t.Fatal(err)
+		}
+		return patterns
+	}
+	serve := func(target string) string {
+		rr := httptest.NewRecorder()
+		if err := c.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, target, nil), recordHandler{t}); err != nil {
+			t.Fatal(err)
+		}
+		return rr.Header().Get("X-Final-Path")
+	}
+
+	if got := call(http.MethodPost, `["/Legacy/*"]`); !reflect.DeepEqual(got, []string{"/api/*", "/Legacy/*"}) {
+		t.Fatalf("unexpected patterns after add: %v", got)
+	}
+	if got := serve("/Legacy/Page"); got != "/Legacy/Page" {
+		t.Fatalf("expected added exclude to apply, got %s", got)
+	}
+	if got := call(http.MethodDelete, `["/api/*"]`); !reflect.DeepEqual(got, []string{"/Legacy/*"}) {
+		t.Fatalf("unexpected patterns after remove: %v", got)
+	}
+	if got := serve("/api/X"); got != "/api/x" {
+		t.Fatalf("expected removed exclude to stop applying, got %s", got)
+	}
+	if got := call(http.MethodGet, ""); !reflect.DeepEqual(got, []string{"/Legacy/*"}) {
+		t.Fatalf("unexpected patterns: %v", got)
+	}
+}
+
+func TestAdminPatchExcludesErrors(t *testing.T) {
+	c := &Casefold{Name: "admin-errors"}
+	if err := c.Provision(caddy.Context{}); err != nil {
+		t.Fatal(err)
+	}
+	defer c.Cleanup()
+	for _, tc := range []struct {
+		target, body string
+		status       int
+	}{
+		{"/casefold/excludes/missing", `[]`, http.StatusNotFound},
+		{"/casefold/excludes/admin-errors", `not json`, http.StatusBadRequest},
+		{"/casefold/excludes/admin-errors", `["[a-"]`, http.StatusBadRequest},
+	} {
+		req := httptest.NewRequest(http.MethodPost, tc.target, strings.NewReader(tc.body))
+		err := (adminAPI{}).handleExcludes(httptest.NewRecorder(), req)
+		if apiErr, ok := err.(caddy.APIError); !ok || apiErr.HTTPStatus != tc.status {
+			t.Errorf("%s %s: expected status %d, got %v", tc.target, tc.body, tc.status, err)
+		}
+	}
+}
@@ -0,0 +1,139 @@
+package casefold
+
+import (
+	"fmt"
+	"html"
+	"io"
+	"io/fs"
+	"net/http"
+	"strings"
+)
+
+// Ambiguity policies for fs mode, used when several entries differ from a
+// requested path only by case.
+const (
+	// ambiguityPreferExact serves the entry matching the request exactly, or
+	// else the first candidate in lexical order. This is the default.
+	ambiguityPreferExact = "prefer_exact"
+	// ambiguityFirst always serves the first candidate in lexical order.
+	ambiguityFirst = "first"
+	// ambiguityNewest serves the most recently modified candidate.
+	ambiguityNewest = "newest"
+	// ambiguityError serves an exact match but otherwise fails the request
+	// with 409 Conflict.
+	ambiguityError = "error"
+	// ambiguityMultipleChoices serves an exact match but otherwise responds
+	// 300 Multiple Choices, listing the candidates.
+	ambiguityMultipleChoices = "multiple_choices"
+)
+
+// ambiguousPathError reports that the "error" policy refused to pick between
+// entries sharing a folded path.
+type ambiguousPathError struct {
+	Path       string
+	Candidates []string
+}
+
+func (e *ambiguousPathError) Error() string {
+	return fmt.Sprintf("ambiguous path %s: %s differ only by case", e.Path, strings.Join(e.Candidates, ", "))
+}
+
+// validAmbiguity reports whether policy names a known ambiguity policy.
+func validAmbiguity(policy string) bool {
+	switch policy {
+	case "", ambiguityPreferExact, ambiguityFirst, ambiguityNewest, ambiguityError, ambiguityMultipleChoices:
+		return true
+	}
+	return false
+}
+
+// ambiguityDependsOnRequest reports whether policy can pick different
+// candidates for differently cased requests of the same folded path.
+func ambiguityDependsOnRequest(policy string) bool {
+	return policy != ambiguityFirst && policy != ambiguityNewest
+}
+
+// choose picks one of cands (slash paths, all equal to want under case
+// folding) according to the Ambiguity policy. Paths are compared segment by
+// segment, the way a directory walk meets them, so the disk walk (which
+// chooses one name per directory) and the preloaded index (which holds full
+// paths) agree.
+func (c *Casefold) choose(want string, cands []string) (string, error) {
+	if c.Ambiguity == ambiguityNewest {
+		return c.newest(cands), nil
+	}
+	wantSegs := strings.Split(c.norm.String(want), "/")
+	remaining := make([][]string, len(cands))
+	for i, cand := range cands {
+		remaining[i] = strings.Split(cand, "/")
+	}
+	for level, seg := range wantSegs {
+		if c.Ambiguity != ambiguityFirst {
+			if exact := filterSegment(remaining, level, seg, c.norm); len(exact) > 0 {
+				remaining = exact
+				continue
+			}
+		}
+		least := remaining[0][level]
+		for _, cand := range remaining[1:] {
+			if cand[level] < least {
+				least = cand[level]
+			}
+		}
+		first := filterSegment(remaining, level, least, "")
+		if len(first) < len(remaining) && (c.Ambiguity == ambiguityError || c.Ambiguity == ambiguityMultipleChoices) {
+			return "", &ambiguousPathError{Path: strings.ToLower(want), Candidates: append([]string(nil), cands...)}
+		}
+		remaining = first
+	}
+	return strings.Join(remaining[0], "/"), nil
+}
+
+// filterSegment returns the split paths whose segment at level, normalized
+// with n, is seg.
+func filterSegment(paths [][]string, level int, seg string, n normalizer) [][]string {
+	var out [][]string
+	for _, p := range paths {
+		if level < len(p) && n.String(p[level]) == seg {
+			out = append(out, p)
+		}
+	}
+	return out
+}
+
+// newest returns the candidate with the latest modification time, the
+// earliest in cands on ties. Entries that cannot be stat'ed are skipped.
+func (c *Casefold) newest(cands []string) string {
+	best := cands[0]
+	var bestInfo fs.FileInfo
+	for _, cand := range cands {
+		fi, err := fs.Stat(c.fsys, fsPath(cand))
+		if err != nil {
+			continue
+		}
+		if bestInfo == nil || fi.ModTime().After(bestInfo.ModTime()) {
+			best, bestInfo = cand, fi
+		}
+	}
+	return best
+}
+
+// writeMultipleChoices responds 300 with a Link header and a short HTML
+// list for each candidate of amb, keeping the request's query string.
+func writeMultipleChoices(w http.ResponseWriter, r *http.Request, amb *ambiguousPathError) error {
+	var body strings.Builder
+	body.WriteString("<!DOCTYPE html>\n<title>Multiple Choices</title>\n<ul>\n")
+	for _, cand := range amb.Candidates {
+		ref := relativeRef(cand, r.URL.RawQuery)
+		w.Header().Add("Link", "<"+ref+`>; rel="alternate"`)
+		fmt.Fprintf(&body, "<li><a href=\"%s\">%s</a></li>\n", html.EscapeString(ref), html.EscapeString(cand))
+	}
+	body.WriteString("</ul>\n")
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(http.StatusMultipleChoices)
+	if r.Method == http.MethodHead {
+		return nil
+	}
+	_, err := io.WriteString(w, body.String())
+	return err
+}
@@ -0,0 +1,146 @@
+package casefold
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/caddyserver/caddy/v2"
+	"github.com/caddyserver/caddy/v2/modules/caddyhttp"
+)
+
+func collidingFS() fstest.MapFS {
+	now := time.Now()
+	return fstest.MapFS{
+		"Docs/README.md": &fstest.MapFile{ModTime: now.Add(-time.Hour)},
+		"Docs/Readme.md": &fstest.MapFile{ModTime: now},
+	}
+}
+
+func TestAmbiguityPolicies(t *testing.T) {
+	for _, tc := range []struct {
+		policy, req, want string
+	}{
+		{"", "/docs/Readme.md", "/Docs/Readme.md"},
+		{"", "/docs/readme.md", "/Docs/README.md"},
+		{"prefer_exact", "/DOCS/Readme.md", "/Docs/Readme.md"},
+		{"first", "/docs/Readme.md", "/Docs/README.md"},
+		{"newest", "/docs/README.md", "/Docs/Readme.md"},
+		{"error", "/docs/Readme.md", "/Docs/Readme.md"},
+	} {
+		c := &Casefold{Mode: "fs", Ambiguity: tc.policy, fsys: collidingFS()}
+		got, ok, err := c.canonicalFS(tc.req)
+		if err != nil || !ok || got != tc.want {
+			t.Errorf("%q %s: expected %s, got %q %v %v", tc.policy, tc.req, tc.want, got, ok, err)
+		}
+		// the preloaded index must agree with the disk walk
+		idx, err := buildIndex(c.fsys, "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		c.state = &fsState{fsys: c.fsys, index: idx}
+		if got, ok := c.resolveFS(tc.req); !ok || got != tc.want {
+			t.Errorf("%q %s (index): expected %s, got %q %v", tc.policy, tc.req, tc.want, got, ok)
+		}
+	}
+}
+
+func TestAmbiguityErrorResponds409(t *testing.T) {
+	c := &Casefold{Mode: "fs", Ambiguity: "error"}
+	if err := c.Provision(caddy.Context{}); err != nil {
+		t.Fatal(err)
+	}
+	c.fsys = collidingFS()
+	c.state = nil
+	err := c.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/docs/readme.md", nil), recordHandler{t})
+	var herr caddyhttp.HandlerError
+	if !errors.As(err, &herr) || herr.StatusCode != http.StatusConflict {
+		t.Fatalf("expected 409 handler error, got %v", err)
+	}
+	var amb *ambiguousPathError
+	if !errors.As(err, &amb) || len(amb.Candidates) != 2 {
+		t.Fatalf("expected ambiguity details, got %v", err)
+	}
+}
+
+func TestAmbiguousResolutionsNotCachedByFoldedKey(t *testing.T) {
+	c := &Casefold{Mode: "fs", fsys: collidingFS()}
+	c.state = &fsState{fsys: c.fsys, cache: newResolutionCache(8, 0)}
+	if got, _ := c.resolveFS("/docs/readme.md"); got != "/Docs/README.md" {
+		t.Fatalf("expected /Docs/README.md, got %s", got)
+	}
+	if got, _ := c.resolveFS("/docs/Readme.md"); got != "/Docs/Readme.md" {
+		t.Fatalf("expected exact match /Docs/Readme.md, got %s", got)
+	}
+}
+
+func TestAmbiguityPoliciesDoNotShareState(t *testing.T) {
+	root := t.TempDir()
+	for _, name := range []string{"README.md", "Readme.md"} {
+		if err := os.WriteFile(filepath.Join(root, name), nil, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	first := &Casefold{Mode: "fs", Root: root, CacheSize: 10, Ambiguity: "first"}
+	strict := &Casefold{Mode: "fs", Root: root, CacheSize: 10, Ambiguity: "error"}
+	for _, c := range []*Casefold{first, strict} {
+		if err := c.Provision(caddy.Context{}); err != nil {
+			t.Fatal(err)
+		}
+		defer c.Cleanup()
+	}
+	if first.state == strict.state {
+		t.Fatal("expected handlers with different ambiguity policies not to share state")
+	}
+	if got, ok, _, err := first.lookupFS("/readme.md"); err != nil || !ok || got != "/README.md" {
+		t.Fatalf("first: expected /README.md, got %q %v %v", got, ok, err)
+	}
+	var amb *ambiguousPathError
+	if got, ok, _, err := strict.lookupFS("/readme.md"); !errors.As(err, &amb) {
+		t.Fatalf("error: expected an ambiguity error, got %q %v %v", got, ok, err)
+	}
+}
+
+func TestInvalidAmbiguityPolicy(t *testing.T) {
+	c := &Casefold{Mode: "fs", Ambiguity: "random"}
+	if err := c.Provision(caddy.Context{}); err == nil {
+		t.Fatal("expected unknown ambiguity policy to be rejected")
+	}
+}
+
+func TestAmbiguityMultipleChoices(t *testing.T) {
+	c := &Casefold{Mode: "fs", Ambiguity: "multiple_choices"}
+	if err := c.Provision(caddy.Context{}); err != nil {
+		t.Fatal(err)
+	}
+	c.fsys = fstest.MapFS{
+		"Docs/a.txt": &fstest.MapFile{},
+		"docs/a.txt": &fstest.MapFile{},
+	}
+	c.state = nil
+	rr := httptest.NewRecorder()
+	if err := c.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/DOCS/a.txt?v=1", nil), recordHandler{t}); err != nil {
+		t.Fatal(err)
+	}
+	if rr.Code != http.StatusMultipleChoices {
+		t.Fatalf("expected 300, got %d", rr.Code)
+	}
+	links := rr.Header().Values("Link")
+	want := []string{`</Docs/a.txt?v=1>; rel="alternate"`, `</docs/a.txt?v=1>; rel="alternate"`}
+	if !reflect.DeepEqual(links, want) {
+		t.Fatalf("expected links %v, got %v", want, links)
+	}
+	if body := rr.Body.String(); !strings.Contains(body, `<a href="/Docs/a.txt?v=1">/Docs/a.txt</a>`) {
+		t.Fatalf("unexpected body: %s", body)
+	}
+	if rr.Header().Get("X-Final-Path") != "" {
+		t.Fatal("expected next handler not to run")
+	}
+}
@@ -0,0 +1,48 @@
+package casefold
+
+import (
+	"fmt"
+	"io/fs"
+
+	"github.com/caddyserver/caddy/v2"
+)
+
+// Fold returns p in the canonical casing of mode, one of lower (the
+// default when mode is empty), upper, title, ascii or fold, exactly as the
+// handler transforms request paths with no other options set. It lets
+// other plugins and programs share the handler's case rules without an
+// HTTP request.
+func Fold(mode, p string) (string, error) {
+	c := &Casefold{Mode: mode, embedded: true}
+	step := c.modeName()
+	if step == "" {
+		step = "lower"
+	}
+	if stepKinds[step] != "case" {
+		return p, fmt.Errorf("mode %q is not a case mode: must be lower, upper, title, ascii or fold", mode)
+	}
+	if err := c.provisionStep(caddy.Context{}, step); err != nil {
+		return p, err
+	}
+	return c.fold.String(p), nil
+}
+
+// CanonicalFS resolves p, a slash-separated path such as /docs/readme.md,
+// against the directory root of fsys ("" or "." for fsys itself) as fs
+// mode does with its default options: each segment takes the casing of the
+// directory entry it matches case-insensitively, preferring an exact match
+// among colliding names, and dotfiles are not resolved. ok is false, and p
+// is returned as given, if some segment matches nothing.
+func CanonicalFS(fsys fs.FS, root, p string) (canon string, ok bool, err error) {
+	if root != "" && root != "." {
+		if fsys, err = fs.Sub(fsys, fsPath(root)); err != nil {
+			return p, false, err
+		}
+	}
+	c := &Casefold{Mode: "fs", fsys: fsys, embedded: true}
+	canon, ok, err = c.canonicalFS(p)
+	if err != nil || !ok || c.hidden(canon) {
+		return p, false, err
+	}
+	return canon, true, nil
+}
@@ -0,0 +1,48 @@
+package casefold
+
+import (
+	"testing"
+	"testing/fstest"
+)
+
+func TestFold(t *testing.T) {
+	for _, tc := range []struct{ mode, p, want string }{
+		{"", "/About/Straße", "/about/straße"},
+		{"fold", "/About/Straße", "/about/strasse"},
+		{"upper", "/docs/a", "/DOCS/A"},
+		{"ascii", "/Café", "/cafe"},
+		{"Title", "/about-us/our-team", "/About-Us/Our-Team"},
+	} {
+		got, err := Fold(tc.mode, tc.p)
+		if err != nil || got != tc.want {
+			t.Errorf("Fold(%q, %q) = %q, %v; want %q", tc.mode, tc.p, got, err, tc.want)
+		}
+	}
+	for _, mode := range []string{"fs", "flod"} {
+		if _, err := Fold(mode, "/x"); err == nil {
+			t.Errorf("Fold(%q): expected an error", mode)
+		}
+	}
+}
+
+func TestCanonicalFS(t *testing.T) {
+	fsys := fstest.MapFS{
+		"site/Docs/ReadMe.md": {},
+		"site/.Git/config":    {},
+	}
+	for _, tc := range []struct {
+		root, p, want string
+		ok            bool
+	}{
+		{"site", "/docs/readme.md", "/Docs/ReadMe.md", true},
+		{"/site", "/DOCS", "/Docs", true},
+		{"", "/SITE/docs/readme.MD", "/site/Docs/ReadMe.md", true},
+		{"site", "/docs/missing", "/docs/missing", false},
+		{"site", "/.git/config", "/.git/config", false},
+	} {
+		got, ok, err := CanonicalFS(fsys, tc.root, tc.p)
+		if err != nil || got != tc.want || ok != tc.ok {
+			t.Errorf("CanonicalFS(%q, %q) = %q, %v, %v; want %q, %v", tc.root, tc.p, got, ok, err, tc.want, tc.ok)
+		}
+	}
+}
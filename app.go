@@ -0,0 +1,258 @@
+package casefold
+
+import (
+	"fmt"
+
+	"github.com/caddyserver/caddy/v2"
+	"github.com/caddyserver/caddy/v2/caddyconfig"
+	"github.com/caddyserver/caddy/v2/caddyconfig/caddyfile"
+	"github.com/caddyserver/caddy/v2/caddyconfig/httpcaddyfile"
+)
+
+func init() {
+	caddy.RegisterModule(App{})
+	httpcaddyfile.RegisterGlobalOption("casefold", parseApp)
+}
+
+// App is the casefold app. It owns fs roots that handlers refer to by name
+// through Shared, so that site blocks serving the same tree use one cache,
+// index and watcher. Handlers on the same root with identical state
+// settings already share state; the app makes the sharing explicit and
+// keeps the settings in one place. Settings that decide how paths resolve,
+// such as Ambiguity, are among them, since cached resolutions depend on
+// them.
+type App struct {
+	// Shared maps names to the roots handlers can share.
+	Shared map[string]*SharedRoot `json:"shared,omitempty"`
+
+	roots map[string]*Casefold
+}
+
+// SharedRoot is an fs root and the settings shaping its shared state, with
+// the meaning they have on the handler.
+type SharedRoot struct {
+	Root             string         `json:"root"`
+	FileSystem       string         `json:"file_system,omitempty"`
+	Normalize        string         `json:"normalize,omitempty"`
+	CacheSize        int            `json:"cache_size,omitempty"`
+	CacheTTL         caddy.Duration `json:"cache_ttl,omitempty"`
+	NegativeCacheTTL caddy.Duration `json:"negative_cache_ttl,omitempty"`
+	DirCacheSize     int            `json:"dir_cache_size,omitempty"`
+	Preload          bool           `json:"preload,omitempty"`
+	PreloadWorkers   int            `json:"preload_workers,omitempty"`
+	IndexFile        string         `json:"index_file,omitempty"`
+	IndexStamp       string         `json:"index_stamp,omitempty"`
+	ReindexInterval  caddy.Duration `json:"reindex_interval,omitempty"`
+	Watch            bool           `json:"watch,omitempty"`
+	Ambiguity        string         `json:"ambiguity,omitempty"`
+	MaxSegments      int            `json:"max_segments,omitempty"`
+	MaxDirEntries    int            `json:"max_dir_entries,omitempty"`
+	ResolveTimeout   caddy.Duration `json:"resolve_timeout,omitempty"`
+	FullResolve      bool           `json:"full_resolve,omitempty"`
+}
+
+// CaddyModule returns the Caddy module information.
+func (App) CaddyModule() caddy.ModuleInfo {
+	return caddy.ModuleInfo{
+		ID:  "casefold",
+		New: func() caddy.Module { return new(App) },
+	}
+}
+
+// Provision builds the state of every shared root, so a preload happens
+// once, when the config loads.
+func (a *App) Provision(ctx caddy.Context) error {
+	a.roots = make(map[string]*Casefold, len(a.Shared))
+	for name, s := range a.Shared {
+		if s == nil || s.Root == "" {
+			return fmt.Errorf("shared %q: missing root", name)
+		}
+		if hasPlaceholder(caddy.NewReplacer().ReplaceKnown(s.Root, "")) {
+			return fmt.Errorf("shared %q: root %q: only global placeholders such as {env.*} are supported", name, s.Root)
+		}
+		fc := &Casefold{Mode: "fs", embedded: true}
+		s.apply(fc)
+		if err := fc.Provision(ctx); err != nil {
+			return fmt.Errorf("shared %q: %v", name, err)
+		}
+		a.roots[name] = fc
+		if err := fc.Validate(); err != nil {
+			return fmt.Errorf("shared %q: %v", name, err)
+		}
+	}
+	return nil
+}
+
+// Start implements caddy.App.
+func (a *App) Start() error { return nil }
+
+// Stop implements caddy.App.
+func (a *App) Stop() error { return nil }
+
+// Cleanup releases the app's hold on the shared state, which lives on while
+// handlers of a newer config still use it.
+func (a *App) Cleanup() error {
+	for name, fc := range a.roots {
+		if err := fc.Cleanup(); err != nil {
+			return err
+		}
+		delete(a.roots, name)
+	}
+	return nil
+}
+
+// apply copies s onto c.
+func (s *SharedRoot) apply(c *Casefold) {
+	c.Root = s.Root
+	c.FileSystem = s.FileSystem
+	c.Normalize = s.Normalize
+	c.CacheSize = s.CacheSize
+	c.CacheTTL = s.CacheTTL
+	c.NegativeCacheTTL = s.NegativeCacheTTL
+	c.DirCacheSize = s.DirCacheSize
+	c.Preload = s.Preload
+	c.PreloadWorkers = s.PreloadWorkers
+	c.IndexFile = s.IndexFile
+	c.IndexStamp = s.IndexStamp
+	c.ReindexInterval = s.ReindexInterval
+	c.Watch = s.Watch
+	c.Ambiguity = s.Ambiguity
+	c.MaxSegments = s.MaxSegments
+	c.MaxDirEntries = s.MaxDirEntries
+	c.ResolveTimeout = s.ResolveTimeout
+	c.FullResolve = s.FullResolve
+}
+
+// provisionShared gives c the root and state settings of its Shared entry
+// in the casefold app, so that c's fs state is the one the app holds.
+func (c *Casefold) provisionShared(ctx caddy.Context) error {
+	if c.Shared == "" {
+		return nil
+	}
+	app, err := ctx.App("casefold")
+	if err != nil {
+		return fmt.Errorf("loading casefold app: %v", err)
+	}
+	return c.useShared(app.(*App))
+}
+
+// useShared applies a's entry for c.Shared to c. c may not configure the
+// root, its state or how it resolves itself; Normalize may repeat the
+// entry's.
+func (c *Casefold) useShared(a *App) error {
+	s, ok := a.Shared[c.Shared]
+	if !ok {
+		return fmt.Errorf("shared %q: no such root in the casefold app", c.Shared)
+	}
+	own := c.Root != "" || c.FileSystem != "" || c.FS != nil || len(c.HostRoots) > 0 ||
+		c.CacheSize != 0 || c.CacheTTL != 0 || c.NegativeCacheTTL != 0 || c.DirCacheSize != 0 ||
+		c.Preload || c.PreloadWorkers != 0 || c.IndexFile != "" || c.IndexStamp != "" || c.ReindexInterval != 0 || c.Watch ||
+		c.Ambiguity != "" || c.MaxSegments != 0 || c.MaxDirEntries != 0 || c.ResolveTimeout != 0 || c.FullResolve
+	if own {
+		return fmt.Errorf("shared %q: root, roots, ambiguity, resolution limits and cache, index and watch settings belong to the casefold app", c.Shared)
+	}
+	if c.Normalize != "" && c.Normalize != s.Normalize {
+		return fmt.Errorf("shared %q: normalize %q differs from the shared root's %q", c.Shared, c.Normalize, s.Normalize)
+	}
+	s.apply(c)
+	return nil
+}
+
+// sharedOptions are the handler subdirectives a shared block accepts.
+var sharedOptions = map[string]bool{
+	"root": true, "file_system": true, "normalize": true, "cache_size": true, "cache_ttl": true,
+	"negative_cache_ttl": true, "dir_cache_size": true, "preload": true, "preload_workers": true,
+	"index_file": true, "index_stamp": true, "reindex_interval": true, "watch": true,
+	"ambiguity": true, "max_segments": true, "max_dir_entries": true, "resolve_timeout": true, "full_resolve": true,
+}
+
+// parseApp sets up the casefold app from the global option. Syntax:
+//
+//	casefold {
+//	    shared <name> {
+//	        root <path>
+//	        # and any of: file_system, normalize, cache_size, cache_ttl,
+//	        # negative_cache_ttl, dir_cache_size, preload, preload_workers,
+//	        # index_file, index_stamp, reindex_interval, watch, ambiguity,
+//	        # max_segments, max_dir_entries, resolve_timeout, full_resolve
+//	    }
+//	}
+//
+// The subdirectives take the arguments they take in the handler.
+func parseApp(d *caddyfile.Dispenser, _ any) (any, error) {
+	d.Next() // consume option name
+	app := &App{Shared: make(map[string]*SharedRoot)}
+	for d.NextBlock(0) {
+		if d.Val() != "shared" {
+			return nil, d.Errf("unrecognized casefold option %q", d.Val())
+		}
+		seg := d.NextSegment()
+		s, err := parseSharedRoot(seg)
+		if err != nil {
+			return nil, err
+		}
+		name := seg[1].Text
+		if _, dup := app.Shared[name]; dup {
+			return nil, d.Errf("shared %q defined twice", name)
+		}
+		app.Shared[name] = s
+	}
+	return httpcaddyfile.App{
+		Name:  "casefold",
+		Value: caddyconfig.JSON(app, nil),
+	}, nil
+}
+
+// parseSharedRoot parses a `shared <name> { ... }` segment, handing the
+// subdirectives to the handler's parser.
+func parseSharedRoot(seg caddyfile.Segment) (*SharedRoot, error) {
+	d := caddyfile.NewDispenser(seg)
+	d.Next() // shared
+	if !d.NextArg() {
+		return nil, d.ArgErr()
+	}
+	if d.NextArg() {
+		return nil, d.ArgErr()
+	}
+	for nesting := d.Nesting(); d.NextBlock(nesting); {
+		if !sharedOptions[d.Val()] {
+			return nil, d.Errf("%s is not a shared root setting", d.Val())
+		}
+		d.RemainingArgs()
+	}
+	d = caddyfile.NewDispenser(seg)
+	d.Next()
+	d.NextArg()
+	c := new(Casefold)
+	if err := c.unmarshalBlock(d, nil); err != nil {
+		return nil, err
+	}
+	if len(c.FallbackRoots) > 0 {
+		return nil, d.Err("a shared root takes one path")
+	}
+	return &SharedRoot{
+		Root:             c.Root,
+		FileSystem:       c.FileSystem,
+		Normalize:        c.Normalize,
+		CacheSize:        c.CacheSize,
+		CacheTTL:         c.CacheTTL,
+		NegativeCacheTTL: c.NegativeCacheTTL,
+		DirCacheSize:     c.DirCacheSize,
+		Preload:          c.Preload,
+		PreloadWorkers:   c.PreloadWorkers,
+		IndexFile:        c.IndexFile,
+		IndexStamp:       c.IndexStamp,
+		ReindexInterval:  c.ReindexInterval,
+		Watch:            c.Watch,
+		Ambiguity:        c.Ambiguity,
+		MaxSegments:      c.MaxSegments,
+		MaxDirEntries:    c.MaxDirEntries,
+		ResolveTimeout:   c.ResolveTimeout,
+		FullResolve:      c.FullResolve,
+	}, nil
+}
+
+// Interface guards
+var _ caddy.App = (*App)(nil)
+var _ caddy.Provisioner = (*App)(nil)
+var _ caddy.CleanerUpper = (*App)(nil)
@@ -0,0 +1,176 @@
+package casefold
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/caddyserver/caddy/v2"
+	"github.com/caddyserver/caddy/v2/caddyconfig/caddyfile"
+	"github.com/caddyserver/caddy/v2/caddyconfig/httpcaddyfile"
+)
+
+func TestAppShared(t *testing.T) {
+	root := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(root, "Docs"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	a := &App{Shared: map[string]*SharedRoot{"www": {Root: root, CacheSize: 100, Normalize: "nfc", Ambiguity: "first"}}}
+	if err := a.Provision(caddy.Context{}); err != nil {
+		t.Fatal(err)
+	}
+	defer a.Cleanup()
+
+	// two handlers configured differently still use the app's state
+	for _, h := range []*Casefold{
+		{Mode: "fs", Shared: "www"},
+		{Transforms: []string{"fs"}, Shared: "www", Redirect: true, Normalize: "nfc"},
+	} {
+		if err := h.useShared(a); err != nil {
+			t.Fatal(err)
+		}
+		h.Shared = "" // looked up; provision the rest as Provision does
+		if err := h.Provision(caddy.Context{}); err != nil {
+			t.Fatal(err)
+		}
+		if h.state == nil || h.state != a.roots["www"].state || h.Ambiguity != "first" {
+			t.Errorf("%v: expected the app's shared state and ambiguity", h.modeOrDefault())
+		}
+		if got, _ := h.transform(httptest.NewRequest(http.MethodGet, "/docs", nil), "/docs"); got != "/Docs" {
+			t.Errorf("expected /Docs, got %s", got)
+		}
+		_ = h.Cleanup()
+	}
+
+	for _, tc := range []struct {
+		h    *Casefold
+		want string
+	}{
+		{&Casefold{Mode: "fs", Shared: "assets"}, "no such root"},
+		{&Casefold{Mode: "fs", Shared: "www", Root: "/srv"}, "belong to the casefold app"},
+		{&Casefold{Mode: "fs", Shared: "www", CacheSize: 10}, "belong to the casefold app"},
+		{&Casefold{Mode: "fs", Shared: "www", Ambiguity: "error"}, "belong to the casefold app"},
+		{&Casefold{Mode: "fs", Shared: "www", MaxDirEntries: 100}, "belong to the casefold app"},
+		{&Casefold{Mode: "fs", Shared: "www", Normalize: "nfd"}, "differs"},
+	} {
+		if err := tc.h.useShared(a); err == nil || !strings.Contains(err.Error(), tc.want) {
+			t.Errorf("expected an error containing %q, got %v", tc.want, err)
+		}
+	}
+}
+
+// siteApp stands in for the http app in TestAppConfig: it loads casefold
+// handlers in a real config context, recording their fs state.
+type siteApp struct {
+	Handlers []json.RawMessage `json:"handlers"`
+}
+
+var siteStates []*fsState
+
+func init() {
+	caddy.RegisterModule(siteApp{})
+}
+
+func (siteApp) CaddyModule() caddy.ModuleInfo {
+	return caddy.ModuleInfo{ID: "casefold_test_sites", New: func() caddy.Module { return new(siteApp) }}
+}
+
+func (s *siteApp) Provision(ctx caddy.Context) error {
+	for _, raw := range s.Handlers {
+		mod, err := ctx.LoadModuleByID("http.handlers.casefold", raw)
+		if err != nil {
+			return err
+		}
+		siteStates = append(siteStates, mod.(*Casefold).state)
+	}
+	return nil
+}
+
+func (s *siteApp) Start() error { return nil }
+func (s *siteApp) Stop() error  { return nil }
+
+func TestAppConfig(t *testing.T) {
+	root := t.TempDir()
+	cfg := fmt.Sprintf(`{"apps": {
+		"casefold": {"shared": {"www": {"root": %q, "cache_size": 100}}},
+		"casefold_test_sites": {"handlers": [
+			{"mode": "fs", "shared": "www"},
+			{"mode": "fs", "shared": "www", "redirect": true}
+		]}
+	}}`, root)
+	var c caddy.Config
+	if err := json.Unmarshal([]byte(cfg), &c); err != nil {
+		t.Fatal(err)
+	}
+	siteStates = nil
+	if err := caddy.Validate(&c); err != nil {
+		t.Fatalf("expected the shared config to load: %v", err)
+	}
+	if len(siteStates) != 2 || siteStates[0] == nil || siteStates[0] != siteStates[1] {
+		t.Errorf("expected both handlers to share one state, got %v", siteStates)
+	}
+
+	bad := strings.Replace(cfg, `"redirect"`, `"cache_size": 5, "redirect"`, 1)
+	c = caddy.Config{}
+	if err := json.Unmarshal([]byte(bad), &c); err != nil {
+		t.Fatal(err)
+	}
+	if err := caddy.Validate(&c); err == nil || !strings.Contains(err.Error(), "belong to the casefold app") {
+		t.Errorf("expected a handler setting its own cache_size to fail, got %v", err)
+	}
+}
+
+func TestParseApp(t *testing.T) {
+	d := caddyfile.NewTestDispenser(`casefold {
+		shared www {
+			root /srv/www
+			cache_size 5000
+			preload
+			watch
+			ambiguity newest
+			max_segments 16
+		}
+	}`)
+	v, err := parseApp(d, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var app App
+	if err := json.Unmarshal(v.(httpcaddyfile.App).Value, &app); err != nil {
+		t.Fatal(err)
+	}
+	s := app.Shared["www"]
+	if s == nil || s.Root != "/srv/www" || s.CacheSize != 5000 || !s.Preload || !s.Watch || s.Ambiguity != "newest" || s.MaxSegments != 16 {
+		t.Errorf("unexpected shared root %+v", s)
+	}
+
+	for _, input := range []string{
+		`casefold { shared www { root /srv/www
+			redirect } }`,
+		`casefold { shared { root /srv } }`,
+		`casefold { shared www { root /a /b } }`,
+		`casefold { roots x }`,
+	} {
+		if _, err := parseApp(caddyfile.NewTestDispenser(input), nil); err == nil {
+			t.Errorf("expected %q to fail", input)
+		}
+	}
+}
+
+func TestUnmarshalShared(t *testing.T) {
+	var c Casefold
+	if err := c.UnmarshalCaddyfile(caddyfile.NewTestDispenser(`casefold {
+		shared docs
+		redirect
+	}`)); err != nil {
+		t.Fatal(err)
+	}
+	if c.Shared != "docs" || c.Mode != "fs" || !c.Redirect {
+		t.Errorf("expected shared docs in fs mode with redirect, got shared %q, mode %q, redirect %v", c.Shared, c.Mode, c.Redirect)
+	}
+}
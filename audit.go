@@ -0,0 +1,34 @@
+package casefold
+
+import (
+	"net/http"
+
+	"github.com/caddyserver/caddy/v2"
+	"github.com/caddyserver/caddy/v2/modules/caddyhttp"
+	"go.uber.org/zap"
+)
+
+// servePassive passes r on unchanged in audit and shadow modes, recording
+// what the handler would have done with it: audit counts and logs would-be
+// rewrites, shadow exposes the would-be path. Transform errors (ambiguous
+// fs paths) never fail the request; the shadow path is then the original.
+func (c *Casefold) servePassive(w http.ResponseWriter, r *http.Request, next caddyhttp.Handler, orig, transformed string, err error) error {
+	if err != nil {
+		if c.Audit && c.log != nil {
+			c.log.Info("casefold audit: transform failed", zap.String("path", orig), zap.Error(err))
+		}
+		transformed = orig
+	} else if transformed != orig && c.Audit {
+		casefoldMetrics.rewrites.WithLabelValues(c.modeOrDefault(), "audit").Inc()
+		c.auditLog.Log(r, "audit", orig, transformed, c.modeOrDefault())
+		c.emitRewritten(r, "audit", orig, transformed)
+	}
+	if c.Shadow {
+		caddyhttp.SetVar(r.Context(), "casefold.shadow_path", transformed)
+		if repl, ok := r.Context().Value(caddy.ReplacerCtxKey).(*caddy.Replacer); ok {
+			repl.Set("http.casefold.shadow_path", transformed)
+		}
+	}
+	c.annotate(r, orig, orig, false)
+	return next.ServeHTTP(w, r)
+}
@@ -0,0 +1,82 @@
+package casefold
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/caddyserver/caddy/v2"
+	"github.com/caddyserver/caddy/v2/modules/caddyhttp"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+func TestAuditMode(t *testing.T) {
+	c := &Casefold{Mode: "lower", Audit: true, Redirect: true, FoldQueryKeys: true}
+	if err := c.Provision(caddy.Context{}); err != nil {
+		t.Fatal(err)
+	}
+	core, logs := observer.New(zapcore.InfoLevel)
+	c.auditLog.log = zap.New(core)
+	audits := testutil.ToFloat64(casefoldMetrics.rewrites.WithLabelValues("lower", "audit"))
+
+	for _, target := range []string{"/Mixed/Case?Key=1", "/already/lower"} {
+		rr := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, target, nil)
+		if err := c.ServeHTTP(rr, req, recordHandler{t}); err != nil {
+			t.Fatal(err)
+		}
+		if rr.Code != http.StatusOK {
+			t.Fatalf("%s: expected the request to be served, got %d", target, rr.Code)
+		}
+		if req.URL.RequestURI() != target {
+			t.Fatalf("expected request untouched, got %s", req.URL.RequestURI())
+		}
+		if rr.Header().Get("X-Original-URI") != "" {
+			t.Fatal("expected no original URI header in audit mode")
+		}
+	}
+
+	if d := testutil.ToFloat64(casefoldMetrics.rewrites.WithLabelValues("lower", "audit")) - audits; d != 1 {
+		t.Fatalf("expected 1 audited rewrite, got %v", d)
+	}
+	if logs.Len() != 1 {
+		t.Fatalf("expected 1 audit log entry, got %d", logs.Len())
+	}
+	if ent := logs.All()[0]; ent.Level != zapcore.InfoLevel || ent.ContextMap()["to"] != "/mixed/case" {
+		t.Fatalf("unexpected audit entry: %s %v", ent.Level, ent.ContextMap())
+	}
+}
+
+func TestShadowMode(t *testing.T) {
+	c := &Casefold{Mode: "lower", Shadow: true}
+	if err := c.Provision(caddy.Context{}); err != nil {
+		t.Fatal(err)
+	}
+	for in, want := range map[string]string{
+		"/Docs/A": "/docs/a",
+		"/docs/b": "/docs/b",
+	} {
+		repl := caddy.NewReplacer()
+		vars := map[string]any{}
+		req := httptest.NewRequest(http.MethodGet, "http://example.test"+in, nil)
+		ctx := context.WithValue(req.Context(), caddy.ReplacerCtxKey, repl)
+		req = req.WithContext(context.WithValue(ctx, caddyhttp.VarsCtxKey, vars))
+		rr := httptest.NewRecorder()
+		if err := c.ServeHTTP(rr, req, recordHandler{t}); err != nil {
+			t.Fatal(err)
+		}
+		if got := rr.Header().Get("X-Final-Path"); got != in {
+			t.Errorf("%s: expected path untouched, got %s", in, got)
+		}
+		if got := repl.ReplaceAll("{http.casefold.shadow_path}", ""); got != want {
+			t.Errorf("%s: expected shadow placeholder %s, got %q", in, want, got)
+		}
+		if vars["casefold.shadow_path"] != want || vars["casefold.rewritten"] != false {
+			t.Errorf("%s: unexpected vars %v", in, vars)
+		}
+	}
+}
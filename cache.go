@@ -0,0 +1,157 @@
+package casefold
+
+import (
+	"container/list"
+	"strings"
+	"sync"
+	"time"
+)
+
+// resolutionCache is a bounded, concurrency-safe LRU cache of fs-mode
+// canonical resolutions. Entries optionally expire after ttl.
+type resolutionCache struct {
+	mu    sync.Mutex
+	size  int
+	ttl   time.Duration
+	ll    *list.List
+	items map[string]*list.Element
+	now   func() time.Time
+	// hits and misses count Get outcomes since the cache was created.
+	hits, misses uint64
+}
+
+type cacheEntry struct {
+	key     string
+	value   string
+	expires time.Time
+}
+
+// newResolutionCache returns a cache holding at most size entries. A zero
+// ttl means entries never expire and are only evicted by size.
+func newResolutionCache(size int, ttl time.Duration) *resolutionCache {
+	return &resolutionCache{
+		size:  size,
+		ttl:   ttl,
+		ll:    list.New(),
+		items: make(map[string]*list.Element, size),
+		now:   time.Now,
+	}
+}
+
+// Get returns the cached value for key and marks it as recently used. An
+// empty value is a cached miss (see PutMiss).
+func (rc *resolutionCache) Get(key string) (string, bool) {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	el, ok := rc.items[key]
+	if !ok {
+		rc.misses++
+		return "", false
+	}
+	ent := el.Value.(*cacheEntry)
+	if !ent.expires.IsZero() && rc.now().After(ent.expires) {
+		rc.removeElement(el)
+		rc.misses++
+		return "", false
+	}
+	rc.ll.MoveToFront(el)
+	rc.hits++
+	return ent.value, true
+}
+
+// Put stores value under key, evicting the least recently used entry if the
+// cache is full.
+func (rc *resolutionCache) Put(key, value string) {
+	rc.put(key, value, rc.ttl)
+}
+
+// PutMiss records that key does not resolve, for ttl rather than the
+// cache's own TTL. Misses share the cache's size bound with resolutions.
+func (rc *resolutionCache) PutMiss(key string, ttl time.Duration) {
+	rc.put(key, "", ttl)
+}
+
+func (rc *resolutionCache) put(key, value string, ttl time.Duration) {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	var expires time.Time
+	if ttl > 0 {
+		expires = rc.now().Add(ttl)
+	}
+	if el, ok := rc.items[key]; ok {
+		ent := el.Value.(*cacheEntry)
+		ent.value, ent.expires = value, expires
+		rc.ll.MoveToFront(el)
+		return
+	}
+	rc.items[key] = rc.ll.PushFront(&cacheEntry{key: key, value: value, expires: expires})
+	for rc.ll.Len() > rc.size {
+		rc.removeElement(rc.ll.Back())
+	}
+}
+
+// Invalidate removes key and every entry keyed below it (key + "/..."), so
+// renaming or removing a directory drops all resolutions that went through it.
+func (rc *resolutionCache) Invalidate(key string) {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	prefix := strings.TrimSuffix(key, "/") + "/"
+	for k, el := range rc.items {
+		if k == key || strings.HasPrefix(k, prefix) {
+			rc.removeElement(el)
+		}
+	}
+}
+
+// Len returns the number of entries currently held.
+func (rc *resolutionCache) Len() int {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	return rc.ll.Len()
+}
+
+// cacheEntryOverhead approximates the per-entry bookkeeping (list element,
+// entry struct, map slot) on top of the key and value bytes.
+const cacheEntryOverhead = 160
+
+// cacheStats is a point-in-time summary of a resolutionCache.
+type cacheStats struct {
+	Entries  int     `json:"entries"`
+	Capacity int     `json:"capacity"`
+	Hits     uint64  `json:"hits"`
+	Misses   uint64  `json:"misses"`
+	HitRatio float64 `json:"hit_ratio"`
+	// MemoryBytes is an estimate of the memory held by the entries.
+	MemoryBytes int `json:"memory_bytes"`
+}
+
+// Stats reports the cache's size, usage and hit ratio.
+func (rc *resolutionCache) Stats() cacheStats {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	st := cacheStats{Entries: rc.ll.Len(), Capacity: rc.size, Hits: rc.hits, Misses: rc.misses}
+	if total := rc.hits + rc.misses; total > 0 {
+		st.HitRatio = float64(rc.hits) / float64(total)
+	}
+	for el := rc.ll.Front(); el != nil; el = el.Next() {
+		ent := el.Value.(*cacheEntry)
+		st.MemoryBytes += len(ent.key) + len(ent.value) + cacheEntryOverhead
+	}
+	return st
+}
+
+// Purge removes every entry and returns how many there were. Hit and miss
+// counts are kept.
+func (rc *resolutionCache) Purge() int {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	n := rc.ll.Len()
+	rc.ll.Init()
+	rc.items = make(map[string]*list.Element, rc.size)
+	return n
+}
+
+func (rc *resolutionCache) removeElement(el *list.Element) {
+	rc.ll.Remove(el)
+	delete(rc.items, el.Value.(*cacheEntry).key)
+}
@@ -0,0 +1,70 @@
+package casefold
+
+import (
+	"testing"
+	"time"
+)
+
+func TestResolutionCacheEviction(t *testing.T) {
+	rc := newResolutionCache(2, 0)
+	rc.Put("/a", "/A")
+	rc.Put("/b", "/B")
+	if _, ok := rc.Get("/a"); !ok { // /a becomes most recently used
+		t.Fatal("expected /a to be cached")
+	}
+	rc.Put("/c", "/C")
+	if _, ok := rc.Get("/b"); ok {
+		t.Fatal("expected least recently used /b to be evicted")
+	}
+	if got, ok := rc.Get("/a"); !ok || got != "/A" {
+		t.Fatalf("expected /a -> /A, got %q %v", got, ok)
+	}
+	if rc.Len() != 2 {
+		t.Fatalf("expected 2 entries, got %d", rc.Len())
+	}
+}
+
+func TestResolutionCacheTTL(t *testing.T) {
+	now := time.Unix(1000, 0)
+	rc := newResolutionCache(10, time.Minute)
+	rc.now = func() time.Time { return now }
+	rc.Put("/a", "/A")
+	if _, ok := rc.Get("/a"); !ok {
+		t.Fatal("expected fresh entry")
+	}
+	now = now.Add(2 * time.Minute)
+	if _, ok := rc.Get("/a"); ok {
+		t.Fatal("expected entry to expire")
+	}
+	if rc.Len() != 0 {
+		t.Fatalf("expected expired entry removed, got %d entries", rc.Len())
+	}
+}
+
+func TestResolutionCacheMiss(t *testing.T) {
+	now := time.Unix(1000, 0)
+	rc := newResolutionCache(10, time.Hour)
+	rc.now = func() time.Time { return now }
+	rc.PutMiss("/missing", time.Minute)
+	if got, ok := rc.Get("/missing"); !ok || got != "" {
+		t.Fatalf("expected cached miss, got %q %v", got, ok)
+	}
+	now = now.Add(2 * time.Minute)
+	if _, ok := rc.Get("/missing"); ok {
+		t.Fatal("expected miss to expire before the cache TTL")
+	}
+}
+
+func TestResolutionCacheInvalidate(t *testing.T) {
+	rc := newResolutionCache(10, 0)
+	rc.Put("/docs", "/Docs")
+	rc.Put("/docs/a.txt", "/Docs/A.txt")
+	rc.Put("/docsx", "/DocsX")
+	rc.Invalidate("/docs")
+	if rc.Len() != 1 {
+		t.Fatalf("expected only /docsx to remain, got %d entries", rc.Len())
+	}
+	if _, ok := rc.Get("/docsx"); !ok {
+		t.Fatal("expected sibling with shared prefix to survive")
+	}
+}
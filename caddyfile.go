@@ -0,0 +1,858 @@
+package casefold
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/caddyserver/caddy/v2"
+	"github.com/caddyserver/caddy/v2/caddyconfig"
+	"github.com/caddyserver/caddy/v2/caddyconfig/caddyfile"
+	"github.com/caddyserver/caddy/v2/caddyconfig/httpcaddyfile"
+	"github.com/caddyserver/caddy/v2/modules/caddyhttp"
+)
+
+// parseCasefold sets up the handler from Caddyfile tokens. Unlike plain
+// UnmarshalCaddyfile, it can resolve the site's named matchers.
+func parseCasefold(h httpcaddyfile.Helper) (caddyhttp.MiddlewareHandler, error) { //nolint:revive
+	c := new(Casefold)
+	err := c.unmarshalCaddyfile(h.Dispenser, &h)
+	return c, err
+}
+
+// UnmarshalCaddyfile implements caddyfile.Unmarshaler. Syntax:
+//
+//	casefold {
+//	    mode <lower|upper|title|ascii|fold|fs|resolver|map>
+//	    strict <on|off>     # fail on an unknown mode and ignored settings
+//	    transforms <step> [<step>...]  # ordered steps instead of mode, e.g. nfc fold fs
+//	    locale <tag>        # language-specific case rules (lower/upper/title/ascii)
+//	    accept_language <tag> [<tag>...]  # per-request locale from Accept-Language
+//	    normalize <nfc|nfd> # Unicode normalization before folding/comparison
+//	    transliterate <cyrillic|greek> [...]  # romanize scripts before matching
+//	    mixed_scripts <block|log|fold>  # segments mixing lookalike scripts (/pаypal)
+//	    collapse_slashes    # /a//b -> /a/b before transforming
+//	    dot_segments <keep|resolve|reject>  # what to do with . and .. segments
+//	    trailing_slash <keep|add|remove>  # directories get a slash, files lose it (in fs mode)
+//	    replace <from> <to> # fixed mapping overriding the case mode
+//	    root <path> [<path>...]  # for fs mode; more paths are tried in order
+//	    shared <name>       # for fs mode: a root of the casefold app (global option)
+//	    roots { <host> <path> ... }  # fs mode root per hostname
+//	    full_resolve        # scan directories even on case-insensitive filesystems
+//	    hide <pattern> [<pattern>...]  # never resolve to these in fs mode
+//	    show_hidden         # let fs mode resolve dotfiles
+//	    max_path_length <n> [reject]  # pass longer paths through, or 414
+//	    reject_invalid_paths  # 400 for control characters, NUL or bad UTF-8
+//	    reserved_names <skip|reject>  # Windows device names (CON, NUL.txt, COM1...)
+//	    max_segments <n>    # deeper paths are not resolved (default 64)
+//	    max_dir_entries <n> # give up on directories larger than this
+//	    resolve_timeout <duration>  # time limit for one fs resolution
+//	    file_system <name>  # resolve fs mode against a registered filesystem
+//	    cache_size <n>      # fs mode resolution cache entries
+//	    cache_ttl <duration>
+//	    negative_cache_ttl <duration>  # also cache paths that do not resolve
+//	    dir_cache_size <n>  # directory listings reused until their mtime changes
+//	    preload             # index root at startup (fs mode)
+//	    preload_workers <n> # directories read concurrently while preloading
+//	    reindex_interval <duration>  # rebuild the preloaded index periodically
+//	    index_file <path>   # persist the preloaded index between restarts
+//	    index_stamp <version>
+//	    watch               # invalidate cache entries on fs changes
+//	    ambiguity <prefer_exact|first|newest|error|multiple_choices>
+//	    fallback <none|lower|fold|not_found>  # for paths fs mode cannot resolve
+//	    resolver <module> [...]  # implies mode resolver
+//	    transform <module> [...] # configure a transform module for transforms
+//	    map_file <path>     # JSON/CSV mapping; implies mode map
+//	    exclude <pattern|@name> [<pattern|@name>...]
+//	    exclude_ignore_case # match exclude patterns case-insensitively
+//	    exclude_file <path> # one pattern per line; reloaded on change
+//	    exclude_url <url> [<interval>]  # polled with ETag (default every 5m)
+//	    only <pattern> [<pattern>...]
+//	    exclude_match { <matchers...> }  # skip requests matching these matchers
+//	    apply_to <@name...> | { <matchers...> }  # only handle requests matching these
+//	    rule <pattern> [<pattern>...] { <subdirectives...> }  # per-path config
+//	    host <name> [<name>...] { <subdirectives...> }  # per-host config
+//	    name <id>           # admin API name (default "default")
+//	    methods <method> [<method>...]  # only fold these methods (default all)
+//	    bypass_header <name> [<value>]  # requests with this header opt out
+//	    skip_signed_urls    # leave pre-signed (S3, GCS, Azure, CloudFront) URLs alone
+//	    skip_query_params <name> [<name>...]
+//	    skip_authorized     # leave requests with an Authorization header alone
+//	    skip_upgrade <on|off>  # leave WebSocket/Upgrade requests alone (default on)
+//	    skip_grpc <on|off>  # leave gRPC calls alone (default on)
+//	    sample_percent <0-100>  # apply to only a share of requests
+//	    sample_by <ip|path> # what sample_percent hashes (default ip)
+//	    fold_query_keys
+//	    fold_host           # lowercase the Host header too
+//	    canonical_query     # fold keys and sort parameters
+//	    fold_query_values <key> [<key>...]
+//	    rewrite_request_uri <on|off>
+//	    original_uri_header <name>
+//	    suppress_response_header
+//	    canonical_link      # Link: <...>; rel="canonical" on rewrites
+//	    content_location    # Content-Location: <path> on rewrites
+//	    server_timing       # Server-Timing: casefold;dur=<ms>
+//	    events              # emit casefold.rewritten / casefold.conflict
+//	    audit               # count and log would-be rewrites, change nothing
+//	    shadow              # expose the would-be path, change nothing
+//	    redirect [<301|302|307|308>]
+//	    redirect_drop_query
+//	    redirect_methods <method> [<method>...]  # redirect these, rewrite the rest
+//	    retry_on_404        # transform only if the unchanged path 404s
+//	    encoded_slashes <keep|decode|reject>  # how to treat %2F (default keep)
+//	    percent_hex <upper|lower>  # normalize the case of %xx escapes
+//	    candidates          # {http.casefold.candidates.0..3} for try_files
+//	    suggest [<n>]       # "did you mean" paths for unresolved fs lookups (default 3)
+//	    suggest_header <name>  # also send the suggestions in this response header
+//	    verbose
+//	    log_fields          # add the decision to access log entries
+//	    log_sample <n>      # debug-log one in every n rewrites
+//	}
+//
+// Multiple 'exclude' lines are allowed; each can take one or more patterns.
+// Likewise 'replace' may be repeated, one mapping per line. Each
+// 'apply_to' or 'exclude_match' block is one matcher set; a request matches
+// if it matches any set. Named matchers (@name) defined in the site can be
+// given to 'apply_to' and 'exclude' in place of a block or glob.
+func (c *Casefold) UnmarshalCaddyfile(d *caddyfile.Dispenser) error {
+	return c.unmarshalCaddyfile(d, nil)
+}
+
+// unmarshalCaddyfile parses the directive; h, if not nil, resolves named
+// matchers.
+func (c *Casefold) unmarshalCaddyfile(d *caddyfile.Dispenser, h *httpcaddyfile.Helper) error {
+	for d.Next() { // 'casefold'
+		if d.NextArg() {
+			return d.ArgErr()
+		}
+		if err := c.unmarshalBlock(d, h); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// unmarshalBlock parses the subdirectives in the block opened at the
+// cursor's line.
+func (c *Casefold) unmarshalBlock(d *caddyfile.Dispenser, h *httpcaddyfile.Helper) error {
+	// impliedMode records that map_file or resolver, not the user, set Mode
+	impliedMode := false
+	for nesting := d.Nesting(); d.NextBlock(nesting); {
+		switch d.Val() {
+		case "mode":
+			v, err := singleArg(d)
+			if err != nil {
+				return err
+			}
+			c.Mode = v
+		case "strict":
+			on, err := onOffArg(d)
+			if err != nil {
+				return err
+			}
+			c.Strict = on
+		case "transforms":
+			args := d.RemainingArgs()
+			if len(args) == 0 {
+				return d.ArgErr()
+			}
+			c.Transforms = append(c.Transforms, args...)
+			if impliedMode {
+				c.Mode = ""
+			}
+		case "locale":
+			v, err := singleArg(d)
+			if err != nil {
+				return err
+			}
+			c.Locale = v
+		case "accept_language":
+			args := d.RemainingArgs()
+			if len(args) == 0 {
+				return d.ArgErr()
+			}
+			c.AcceptLanguageLocales = append(c.AcceptLanguageLocales, args...)
+		case "normalize":
+			v, err := singleArg(d)
+			if err != nil {
+				return err
+			}
+			if _, err := parseNormalizer(v); err != nil {
+				return d.Err(err.Error())
+			}
+			c.Normalize = v
+		case "transliterate":
+			args := d.RemainingArgs()
+			if len(args) == 0 {
+				return d.ArgErr()
+			}
+			if _, err := newTransliterator(args); err != nil {
+				return d.Err(err.Error())
+			}
+			c.Transliterate = append(c.Transliterate, args...)
+		case "mixed_scripts":
+			v, err := singleArg(d)
+			if err != nil {
+				return err
+			}
+			if v != mixedScriptsBlock && v != mixedScriptsLog && v != mixedScriptsFold {
+				return d.Errf("invalid mixed_scripts %q", v)
+			}
+			c.MixedScripts = v
+		case "collapse_slashes":
+			if d.NextArg() {
+				return d.ArgErr()
+			}
+			c.CollapseSlashes = true
+		case "dot_segments":
+			v, err := singleArg(d)
+			if err != nil {
+				return err
+			}
+			if v == "" || !validDotSegments(v) {
+				return d.Errf("invalid dot_segments %q", v)
+			}
+			c.DotSegments = v
+		case "trailing_slash":
+			v, err := singleArg(d)
+			if err != nil {
+				return err
+			}
+			if v == "" || !validTrailingSlash(v) {
+				return d.Errf("invalid trailing_slash %q", v)
+			}
+			c.TrailingSlash = v
+		case "replace":
+			args := d.RemainingArgs()
+			if len(args) != 2 {
+				return d.ArgErr()
+			}
+			if c.Replace == nil {
+				c.Replace = make(map[string]string)
+			}
+			c.Replace[args[0]] = args[1]
+		case "root":
+			roots := d.RemainingArgs()
+			if len(roots) == 0 {
+				return d.ArgErr()
+			}
+			c.Root = roots[0]
+			if len(roots) > 1 {
+				c.FallbackRoots = roots[1:]
+			}
+		case "hide":
+			args := d.RemainingArgs()
+			if len(args) == 0 {
+				return d.ArgErr()
+			}
+			c.Hide = append(c.Hide, args...)
+		case "show_hidden":
+			if d.NextArg() {
+				return d.ArgErr()
+			}
+			c.ShowHidden = true
+		case "max_segments", "max_dir_entries":
+			opt := d.Val()
+			v, err := singleArg(d)
+			if err != nil {
+				return err
+			}
+			n, err := strconv.Atoi(v)
+			if err != nil || n < 1 {
+				return d.Errf("invalid %s %q", opt, v)
+			}
+			if opt == "max_segments" {
+				c.MaxSegments = n
+			} else {
+				c.MaxDirEntries = n
+			}
+		case "max_path_length":
+			args := d.RemainingArgs()
+			if len(args) == 0 || len(args) > 2 {
+				return d.ArgErr()
+			}
+			n, err := strconv.Atoi(args[0])
+			if err != nil || n < 1 {
+				return d.Errf("invalid max_path_length %q", args[0])
+			}
+			c.MaxPathLength = n
+			if len(args) == 2 {
+				if args[1] != "reject" {
+					return d.Errf("invalid max_path_length action %q: want reject", args[1])
+				}
+				c.RejectLongPaths = true
+			}
+		case "reject_invalid_paths":
+			if d.NextArg() {
+				return d.ArgErr()
+			}
+			c.RejectInvalidPaths = true
+		case "reserved_names":
+			v, err := singleArg(d)
+			if err != nil {
+				return err
+			}
+			if v != reservedNamesSkip && v != reservedNamesReject {
+				return d.Errf("invalid reserved_names %q", v)
+			}
+			c.ReservedNames = v
+		case "resolve_timeout":
+			v, err := singleArg(d)
+			if err != nil {
+				return err
+			}
+			dur, err := caddy.ParseDuration(v)
+			if err != nil || dur <= 0 {
+				return d.Errf("invalid resolve_timeout %q", v)
+			}
+			c.ResolveTimeout = caddy.Duration(dur)
+		case "full_resolve":
+			if d.NextArg() {
+				return d.ArgErr()
+			}
+			c.FullResolve = true
+		case "roots":
+			if d.NextArg() {
+				return d.ArgErr()
+			}
+			for nesting := d.Nesting(); d.NextBlock(nesting); {
+				host := d.Val()
+				root, err := singleArg(d)
+				if err != nil {
+					return err
+				}
+				if c.HostRoots == nil {
+					c.HostRoots = make(map[string]string)
+				}
+				c.HostRoots[host] = root
+			}
+		case "file_system":
+			v, err := singleArg(d)
+			if err != nil {
+				return err
+			}
+			c.FileSystem = v
+		case "cache_size":
+			v, err := singleArg(d)
+			if err != nil {
+				return err
+			}
+			n, err := strconv.Atoi(v)
+			if err != nil || n < 0 {
+				return d.Errf("invalid cache_size %q", v)
+			}
+			c.CacheSize = n
+		case "cache_ttl":
+			v, err := singleArg(d)
+			if err != nil {
+				return err
+			}
+			dur, err := caddy.ParseDuration(v)
+			if err != nil {
+				return d.Errf("invalid cache_ttl %q: %v", v, err)
+			}
+			c.CacheTTL = caddy.Duration(dur)
+		case "dir_cache_size":
+			v, err := singleArg(d)
+			if err != nil {
+				return err
+			}
+			n, err := strconv.Atoi(v)
+			if err != nil || n < 1 {
+				return d.Errf("invalid dir_cache_size %q", v)
+			}
+			c.DirCacheSize = n
+		case "negative_cache_ttl":
+			v, err := singleArg(d)
+			if err != nil {
+				return err
+			}
+			dur, err := caddy.ParseDuration(v)
+			if err != nil || dur <= 0 {
+				return d.Errf("invalid negative_cache_ttl %q", v)
+			}
+			c.NegativeCacheTTL = caddy.Duration(dur)
+		case "preload":
+			if d.NextArg() {
+				return d.ArgErr()
+			}
+			c.Preload = true
+		case "preload_workers":
+			v, err := singleArg(d)
+			if err != nil {
+				return err
+			}
+			n, err := strconv.Atoi(v)
+			if err != nil || n < 1 {
+				return d.Errf("invalid preload_workers %q", v)
+			}
+			c.PreloadWorkers = n
+		case "reindex_interval":
+			v, err := singleArg(d)
+			if err != nil {
+				return err
+			}
+			dur, err := caddy.ParseDuration(v)
+			if err != nil || dur <= 0 {
+				return d.Errf("invalid reindex_interval %q", v)
+			}
+			c.ReindexInterval = caddy.Duration(dur)
+		case "index_file":
+			v, err := singleArg(d)
+			if err != nil {
+				return err
+			}
+			c.IndexFile = v
+		case "index_stamp":
+			v, err := singleArg(d)
+			if err != nil {
+				return err
+			}
+			c.IndexStamp = v
+		case "watch":
+			if d.NextArg() {
+				return d.ArgErr()
+			}
+			c.Watch = true
+		case "ambiguity":
+			v, err := singleArg(d)
+			if err != nil {
+				return err
+			}
+			if !validAmbiguity(v) {
+				return d.Errf("invalid ambiguity policy %q", v)
+			}
+			c.Ambiguity = v
+		case "fallback":
+			v, err := singleArg(d)
+			if err != nil {
+				return err
+			}
+			switch v {
+			case fallbackNone, fallbackLower, fallbackFold, fallbackNotFound:
+			default:
+				return d.Errf("invalid fallback %q", v)
+			}
+			c.Fallback = v
+		case "shared":
+			v, err := singleArg(d)
+			if err != nil {
+				return err
+			}
+			c.Shared = v
+			if c.Mode == "" && len(c.Transforms) == 0 {
+				c.Mode, impliedMode = "fs", true
+			}
+		case "map_file":
+			v, err := singleArg(d)
+			if err != nil {
+				return err
+			}
+			c.MapFile = v
+			if c.Mode == "" && len(c.Transforms) == 0 {
+				c.Mode, impliedMode = "map", true
+			}
+		case "resolver":
+			if !d.NextArg() {
+				return d.ArgErr()
+			}
+			name := d.Val()
+			unm, err := caddyfile.UnmarshalModule(d, "http.handlers.casefold.resolvers."+name)
+			if err != nil {
+				return err
+			}
+			c.ResolverRaw = caddyconfig.JSONModuleObject(unm, "resolver", name, nil)
+			if c.Mode == "" && len(c.Transforms) == 0 {
+				c.Mode, impliedMode = "resolver", true
+			}
+		case "transform":
+			if !d.NextArg() {
+				return d.ArgErr()
+			}
+			name := d.Val()
+			unm, err := caddyfile.UnmarshalModule(d, transformNamespace+"."+name)
+			if err != nil {
+				return err
+			}
+			if c.TransformModules == nil {
+				c.TransformModules = make(caddy.ModuleMap)
+			}
+			c.TransformModules[name] = caddyconfig.JSON(unm, nil)
+		case "exclude_ignore_case":
+			if d.NextArg() {
+				return d.ArgErr()
+			}
+			c.ExcludeIgnoreCase = true
+		case "rule":
+			paths := d.RemainingArgs()
+			if len(paths) == 0 {
+				return d.ArgErr()
+			}
+			rule := &PathRule{Paths: paths}
+			if err := rule.unmarshalBlock(d, h); err != nil {
+				return err
+			}
+			c.Rules = append(c.Rules, rule)
+		case "host":
+			names := d.RemainingArgs()
+			if len(names) == 0 {
+				return d.ArgErr()
+			}
+			hc := new(Casefold)
+			if err := hc.unmarshalBlock(d, h); err != nil {
+				return err
+			}
+			if c.Hosts == nil {
+				c.Hosts = make(map[string]*Casefold)
+			}
+			for _, name := range names {
+				if _, dup := c.Hosts[name]; dup {
+					return d.Errf("host %s configured twice", name)
+				}
+				c.Hosts[name] = hc
+			}
+		case "exclude_file":
+			v, err := singleArg(d)
+			if err != nil {
+				return err
+			}
+			c.ExcludeFile = v
+		case "exclude_url":
+			if !d.NextArg() {
+				return d.ArgErr()
+			}
+			c.ExcludeURL = d.Val()
+			if d.NextArg() {
+				dur, err := caddy.ParseDuration(d.Val())
+				if err != nil {
+					return d.Errf("invalid exclude_url interval %q: %v", d.Val(), err)
+				}
+				c.ExcludeURLInterval = caddy.Duration(dur)
+			}
+			if d.NextArg() {
+				return d.ArgErr()
+			}
+		case "only":
+			args := d.RemainingArgs()
+			if len(args) == 0 {
+				return d.ArgErr()
+			}
+			c.Only = append(c.Only, args...)
+		case "exclude":
+			if !d.NextArg() {
+				return d.ArgErr()
+			}
+			for ok := true; ok; ok = d.NextArg() {
+				if !strings.HasPrefix(d.Val(), "@") {
+					c.Exclude = append(c.Exclude, d.Val())
+					continue
+				}
+				set, err := namedMatcherSet(d, h)
+				if err != nil {
+					return err
+				}
+				c.ExcludeMatchRaw = append(c.ExcludeMatchRaw, set)
+			}
+		case "apply_to":
+			named := false
+			for d.NextArg() {
+				if !strings.HasPrefix(d.Val(), "@") {
+					return d.Errf("apply_to: expected a named matcher or a matcher block, got %q", d.Val())
+				}
+				set, err := namedMatcherSet(d, h)
+				if err != nil {
+					return err
+				}
+				c.ApplyToRaw = append(c.ApplyToRaw, set)
+				named = true
+			}
+			if named {
+				break
+			}
+			set, err := caddyhttp.ParseCaddyfileNestedMatcherSet(d)
+			if err != nil {
+				return err
+			}
+			c.ApplyToRaw = append(c.ApplyToRaw, set)
+		case "exclude_match":
+			set, err := caddyhttp.ParseCaddyfileNestedMatcherSet(d)
+			if err != nil {
+				return err
+			}
+			c.ExcludeMatchRaw = append(c.ExcludeMatchRaw, set)
+		case "name":
+			v, err := singleArg(d)
+			if err != nil {
+				return err
+			}
+			c.Name = v
+		case "methods":
+			args := d.RemainingArgs()
+			if len(args) == 0 {
+				return d.ArgErr()
+			}
+			for _, m := range args {
+				c.Methods = append(c.Methods, strings.ToUpper(m))
+			}
+		case "bypass_header":
+			args := d.RemainingArgs()
+			if len(args) < 1 || len(args) > 2 {
+				return d.ArgErr()
+			}
+			c.BypassHeader = args[0]
+			if len(args) == 2 {
+				c.BypassValue = args[1]
+			}
+		case "skip_signed_urls":
+			if d.NextArg() {
+				return d.ArgErr()
+			}
+			c.SkipSignedURLs = true
+		case "skip_query_params":
+			args := d.RemainingArgs()
+			if len(args) == 0 {
+				return d.ArgErr()
+			}
+			c.SkipQueryParams = append(c.SkipQueryParams, args...)
+		case "skip_authorized":
+			if d.NextArg() {
+				return d.ArgErr()
+			}
+			c.SkipAuthorized = true
+		case "skip_upgrade":
+			on, err := onOffArg(d)
+			if err != nil {
+				return err
+			}
+			c.SkipUpgrade = &on
+		case "skip_grpc":
+			on, err := onOffArg(d)
+			if err != nil {
+				return err
+			}
+			c.SkipGRPC = &on
+		case "sample_percent":
+			v, err := singleArg(d)
+			if err != nil {
+				return err
+			}
+			pct, err := strconv.ParseFloat(strings.TrimSuffix(v, "%"), 64)
+			if err != nil || pct < 0 || pct > 100 {
+				return d.Errf("invalid sample_percent %q: must be between 0 and 100", v)
+			}
+			c.SamplePercent = &pct
+		case "sample_by":
+			v, err := singleArg(d)
+			if err != nil {
+				return err
+			}
+			if v != "ip" && v != "path" {
+				return d.Errf("invalid sample_by %q: must be ip or path", v)
+			}
+			c.SampleBy = v
+		case "fold_host":
+			if d.NextArg() {
+				return d.ArgErr()
+			}
+			c.FoldHost = true
+		case "fold_query_keys":
+			if d.NextArg() {
+				return d.ArgErr()
+			}
+			c.FoldQueryKeys = true
+		case "canonical_query":
+			if d.NextArg() {
+				return d.ArgErr()
+			}
+			c.CanonicalQuery = true
+		case "fold_query_values":
+			args := d.RemainingArgs()
+			if len(args) == 0 {
+				return d.ArgErr()
+			}
+			c.FoldQueryValues = append(c.FoldQueryValues, args...)
+		case "original_uri_header":
+			v, err := singleArg(d)
+			if err != nil {
+				return err
+			}
+			c.OriginalURIHeader = v
+		case "suppress_response_header":
+			if d.NextArg() {
+				return d.ArgErr()
+			}
+			c.SuppressResponseHeader = true
+		case "canonical_link":
+			if d.NextArg() {
+				return d.ArgErr()
+			}
+			c.CanonicalLink = true
+		case "content_location":
+			if d.NextArg() {
+				return d.ArgErr()
+			}
+			c.ContentLocation = true
+		case "events":
+			if d.NextArg() {
+				return d.ArgErr()
+			}
+			c.Events = true
+		case "server_timing":
+			if d.NextArg() {
+				return d.ArgErr()
+			}
+			c.ServerTiming = true
+		case "rewrite_request_uri":
+			on, err := onOffArg(d)
+			if err != nil {
+				return err
+			}
+			c.RewriteRequestURI = &on
+		case "audit":
+			if d.NextArg() {
+				return d.ArgErr()
+			}
+			c.Audit = true
+		case "shadow":
+			if d.NextArg() {
+				return d.ArgErr()
+			}
+			c.Shadow = true
+		case "redirect":
+			c.Redirect = true
+			if d.NextArg() {
+				code, err := strconv.Atoi(d.Val())
+				if err != nil {
+					return d.Errf("invalid redirect status code %q", d.Val())
+				}
+				c.RedirectCode = code
+			}
+			if d.NextArg() {
+				return d.ArgErr()
+			}
+		case "redirect_methods":
+			args := d.RemainingArgs()
+			if len(args) == 0 {
+				return d.ArgErr()
+			}
+			c.Redirect = true
+			for _, m := range args {
+				c.RedirectMethods = append(c.RedirectMethods, strings.ToUpper(m))
+			}
+		case "suggest":
+			c.Suggest = 3
+			if d.NextArg() {
+				n, err := strconv.Atoi(d.Val())
+				if err != nil || n < 1 {
+					return d.Errf("invalid suggest count %q", d.Val())
+				}
+				c.Suggest = n
+			}
+			if d.NextArg() {
+				return d.ArgErr()
+			}
+		case "suggest_header":
+			v, err := singleArg(d)
+			if err != nil {
+				return err
+			}
+			c.SuggestHeader = v
+		case "candidates":
+			if d.NextArg() {
+				return d.ArgErr()
+			}
+			c.Candidates = true
+		case "percent_hex":
+			v, err := singleArg(d)
+			if err != nil {
+				return err
+			}
+			if v != percentHexUpper && v != percentHexLower {
+				return d.Errf("invalid percent_hex %q", v)
+			}
+			c.PercentHex = v
+		case "encoded_slashes":
+			v, err := singleArg(d)
+			if err != nil {
+				return err
+			}
+			if !validEncodedSlashes(v) {
+				return d.Errf("invalid encoded_slashes %q", v)
+			}
+			c.EncodedSlashes = v
+		case "retry_on_404":
+			if d.NextArg() {
+				return d.ArgErr()
+			}
+			c.RetryOn404 = true
+		case "redirect_drop_query":
+			if d.NextArg() {
+				return d.ArgErr()
+			}
+			c.RedirectDropQuery = true
+		case "verbose":
+			if d.NextArg() {
+				return d.ArgErr()
+			}
+			c.Verbose = true
+		case "log_sample":
+			v, err := singleArg(d)
+			if err != nil {
+				return err
+			}
+			n, err := strconv.Atoi(v)
+			if err != nil || n < 1 {
+				return d.Errf("invalid log_sample %q: must be a positive integer", v)
+			}
+			c.LogSample = n
+		case "log_fields":
+			if d.NextArg() {
+				return d.ArgErr()
+			}
+			c.LogFields = true
+		default:
+			return d.Errf("unrecognized casefold subdirective %q", d.Val())
+		}
+	}
+	return nil
+}
+
+// namedMatcherSet returns the matcher set of the @name token at the
+// dispenser's cursor, as defined in the enclosing site.
+func namedMatcherSet(d *caddyfile.Dispenser, h *httpcaddyfile.Helper) (caddy.ModuleMap, error) {
+	if h == nil {
+		return nil, d.Errf("named matcher %s can only be used in a site block", d.Val())
+	}
+	d.Prev() // MatcherToken reads the token again
+	set, _, err := h.MatcherToken()
+	return set, err
+}
+
+// singleArg consumes exactly one argument for the current subdirective.
+func singleArg(d *caddyfile.Dispenser) (string, error) {
+	if !d.NextArg() {
+		return "", d.ArgErr()
+	}
+	v := d.Val()
+	if d.NextArg() {
+		return "", d.ArgErr()
+	}
+	return v, nil
+}
+
+// onOffArg consumes exactly one "on" or "off" argument.
+func onOffArg(d *caddyfile.Dispenser) (bool, error) {
+	v, err := singleArg(d)
+	if err != nil {
+		return false, err
+	}
+	switch v {
+	case "on":
+		return true, nil
+	case "off":
+		return false, nil
+	}
+	return false, d.Errf("expected on or off, got %q", v)
+}
+
+// Interface guard
+var _ caddyfile.Unmarshaler = (*Casefold)(nil)
@@ -0,0 +1,278 @@
+package casefold
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/caddyserver/caddy/v2"
+	"github.com/caddyserver/caddy/v2/caddyconfig/caddyfile"
+	"github.com/caddyserver/caddy/v2/caddyconfig/httpcaddyfile"
+)
+
+func TestUnmarshalCaddyfile(t *testing.T) {
+	d := caddyfile.NewTestDispenser(`casefold {
+		mode fs
+		strict on
+		root /srv/www /srv/generated
+		roots {
+			shop.example.com /srv/shop
+			*.example.com /srv/tenants/{http.request.host}
+		}
+		ambiguity newest
+		fallback not_found
+		full_resolve
+		hide *.bak /private/*
+		show_hidden
+		max_path_length 2048 reject
+		reject_invalid_paths
+		reserved_names skip
+		negative_cache_ttl 30s
+		dir_cache_size 1000
+		preload_workers 16
+		reindex_interval 10m
+		max_segments 32
+		max_dir_entries 10000
+		resolve_timeout 50ms
+		accept_language tr az
+		normalize nfc
+		transliterate cyrillic greek
+		mixed_scripts fold
+		collapse_slashes
+		dot_segments resolve
+		trailing_slash add
+		replace ß ß
+		replace Æ ae
+		exclude /api/* /Media/*.ZIP
+		exclude /raw/*
+		exclude_ignore_case
+		exclude_file /etc/caddy/excludes.txt
+		exclude_url https://config.example.com/casefold/excludes 30s
+		only /docs/* /blog/*
+		name site
+		methods get HEAD
+		skip_grpc off
+		skip_signed_urls
+		skip_authorized
+		skip_query_params token hmac
+		bypass_header X-No-Casefold 1
+		sample_percent 12.5%
+		sample_by path
+		audit
+		shadow
+		candidates
+		suggest 5
+		suggest_header X-Did-You-Mean
+		redirect 301
+		redirect_drop_query
+		redirect_methods get HEAD
+		retry_on_404
+		fold_host
+		encoded_slashes reject
+		percent_hex upper
+		rewrite_request_uri off
+		verbose
+		log_fields
+		log_sample 100
+	}`)
+	var c Casefold
+	if err := c.UnmarshalCaddyfile(d); err != nil {
+		t.Fatal(err)
+	}
+	if c.Mode != "fs" || !c.Strict || c.Normalize != "nfc" || c.Ambiguity != "newest" || c.Fallback != "not_found" || !c.FullResolve || !c.ShowHidden || c.MaxPathLength != 2048 || !c.RejectLongPaths || !c.RejectInvalidPaths || c.ReservedNames != "skip" || c.NegativeCacheTTL != caddy.Duration(30*time.Second) || c.DirCacheSize != 1000 || c.PreloadWorkers != 16 || c.ReindexInterval != caddy.Duration(10*time.Minute) || c.MaxSegments != 32 || c.MaxDirEntries != 10000 || c.ResolveTimeout != caddy.Duration(50*time.Millisecond) || !reflect.DeepEqual(c.Hide, []string{"*.bak", "/private/*"}) || c.Name != "site" || !c.ExcludeIgnoreCase || c.ExcludeFile != "/etc/caddy/excludes.txt" || c.ExcludeURL != "https://config.example.com/casefold/excludes" || c.ExcludeURLInterval != caddy.Duration(30*time.Second) || c.SamplePercent == nil || *c.SamplePercent != 12.5 || c.SampleBy != "path" || c.Root != "/srv/www" || !c.Verbose || !c.LogFields || c.LogSample != 100 || !c.Audit || !c.Shadow || !c.Candidates || c.Suggest != 5 || c.SuggestHeader != "X-Did-You-Mean" || !c.Redirect || c.RedirectCode != 301 || !c.RedirectDropQuery || !reflect.DeepEqual(c.RedirectMethods, []string{"GET", "HEAD"}) || !c.RetryOn404 || !c.FoldHost || c.EncodedSlashes != "reject" || c.PercentHex != "upper" || !c.CollapseSlashes || c.MixedScripts != "fold" || c.TrailingSlash != "add" || c.DotSegments != "resolve" {
+		t.Fatalf("unexpected config: %+v", c)
+	}
+	if c.BypassHeader != "X-No-Casefold" || c.BypassValue != "1" {
+		t.Fatalf("unexpected bypass header %q: %q", c.BypassHeader, c.BypassValue)
+	}
+	if want := []string{"token", "hmac"}; !c.SkipSignedURLs || !c.SkipAuthorized || !reflect.DeepEqual(c.SkipQueryParams, want) {
+		t.Fatalf("expected skip_signed_urls and skip_query_params %v, got %v %v", want, c.SkipSignedURLs, c.SkipQueryParams)
+	}
+	if c.SkipGRPC == nil || *c.SkipGRPC || c.SkipUpgrade != nil {
+		t.Fatal("expected skip_grpc off and skip_upgrade unset")
+	}
+	if c.RewriteRequestURI == nil || *c.RewriteRequestURI {
+		t.Fatal("expected rewrite_request_uri off")
+	}
+	if want := []string{"cyrillic", "greek"}; !reflect.DeepEqual(c.Transliterate, want) {
+		t.Fatalf("expected transliterate %v, got %v", want, c.Transliterate)
+	}
+	if want := map[string]string{"ß": "ß", "Æ": "ae"}; !reflect.DeepEqual(c.Replace, want) {
+		t.Fatalf("expected replace %v, got %v", want, c.Replace)
+	}
+	if want := []string{"GET", "HEAD"}; !reflect.DeepEqual(c.Methods, want) {
+		t.Fatalf("expected methods %v, got %v", want, c.Methods)
+	}
+	if want := map[string]string{"shop.example.com": "/srv/shop", "*.example.com": "/srv/tenants/{http.request.host}"}; !reflect.DeepEqual(c.HostRoots, want) {
+		t.Fatalf("expected roots %v, got %v", want, c.HostRoots)
+	}
+	if want := []string{"/srv/generated"}; !reflect.DeepEqual(c.FallbackRoots, want) {
+		t.Fatalf("expected fallback roots %v, got %v", want, c.FallbackRoots)
+	}
+	if want := []string{"tr", "az"}; !reflect.DeepEqual(c.AcceptLanguageLocales, want) {
+		t.Fatalf("expected accept_language %v, got %v", want, c.AcceptLanguageLocales)
+	}
+	if want := []string{"/docs/*", "/blog/*"}; !reflect.DeepEqual(c.Only, want) {
+		t.Fatalf("expected only %v, got %v", want, c.Only)
+	}
+	if want := []string{"/api/*", "/Media/*.ZIP", "/raw/*"}; !reflect.DeepEqual(c.Exclude, want) {
+		t.Fatalf("expected excludes %v, got %v", want, c.Exclude)
+	}
+}
+
+func TestUnmarshalCaddyfileTransforms(t *testing.T) {
+	d := caddyfile.NewTestDispenser(`casefold {
+		map_file /etc/caddy/paths.csv
+		transforms nfc lower
+		transforms map
+	}`)
+	var c Casefold
+	if err := c.UnmarshalCaddyfile(d); err != nil {
+		t.Fatal(err)
+	}
+	if c.Mode != "" || c.MapFile != "/etc/caddy/paths.csv" {
+		t.Fatalf("expected no implied mode alongside transforms, got %+v", c)
+	}
+	if want := []string{"nfc", "lower", "map"}; !reflect.DeepEqual(c.Transforms, want) {
+		t.Fatalf("expected transforms %v, got %v", want, c.Transforms)
+	}
+}
+
+func TestUnmarshalCaddyfileRules(t *testing.T) {
+	d := caddyfile.NewTestDispenser(`casefold {
+		rule /docs/* {
+			mode fold
+			exclude /docs/API/*
+		}
+		rule /downloads/* /files/* {
+			mode fs
+			root /srv/files
+		}
+	}`)
+	var c Casefold
+	if err := c.UnmarshalCaddyfile(d); err != nil {
+		t.Fatal(err)
+	}
+	if len(c.Rules) != 2 {
+		t.Fatalf("expected 2 rules, got %d", len(c.Rules))
+	}
+	docs, files := c.Rules[0], c.Rules[1]
+	if docs.Mode != "fold" || !reflect.DeepEqual(docs.Exclude, []string{"/docs/API/*"}) || !reflect.DeepEqual(docs.Paths, []string{"/docs/*"}) {
+		t.Fatalf("unexpected docs rule: %+v", docs)
+	}
+	if files.Mode != "fs" || files.Root != "/srv/files" || !reflect.DeepEqual(files.Paths, []string{"/downloads/*", "/files/*"}) {
+		t.Fatalf("unexpected files rule: %+v", files)
+	}
+	if c.Mode != "" || c.Exclude != nil {
+		t.Fatalf("expected rule options to stay in their rules, got %+v", c)
+	}
+}
+
+func TestUnmarshalCaddyfileHosts(t *testing.T) {
+	d := caddyfile.NewTestDispenser(`casefold {
+		mode lower
+		host a.example.com b.example.com {
+			mode fs
+			root /srv/tenants
+		}
+		host *.example.org {
+			rule /docs/* {
+				mode fold
+			}
+		}
+	}`)
+	var c Casefold
+	if err := c.UnmarshalCaddyfile(d); err != nil {
+		t.Fatal(err)
+	}
+	if c.Mode != "lower" || len(c.Hosts) != 3 {
+		t.Fatalf("unexpected config: %+v", c)
+	}
+	if a := c.Hosts["a.example.com"]; a == nil || a != c.Hosts["b.example.com"] || a.Mode != "fs" || a.Root != "/srv/tenants" {
+		t.Fatalf("expected a and b to share one fs config, got %+v", a)
+	}
+	if org := c.Hosts["*.example.org"]; org == nil || len(org.Rules) != 1 || org.Rules[0].Mode != "fold" {
+		t.Fatalf("unexpected wildcard host config: %+v", org)
+	}
+	if err := new(Casefold).UnmarshalCaddyfile(caddyfile.NewTestDispenser(`casefold {
+		host a.example.com {
+		}
+		host a.example.com {
+		}
+	}`)); err == nil {
+		t.Fatal("expected duplicate host to fail")
+	}
+}
+
+func TestCaddyfileNamedMatchers(t *testing.T) {
+	input := `{
+	order casefold first
+}
+:8080 {
+	@api path /api/*
+	@get method GET
+	casefold {
+		exclude @api /raw/*
+		apply_to @get
+	}
+}`
+	out, _, err := caddyfile.Adapter{ServerType: httpcaddyfile.ServerType{}}.Adapt([]byte(input), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		`"exclude":["/raw/*"]`,
+		`"exclude_match":[{"path":["/api/*"]}]`,
+		`"apply_to":[{"method":["GET"]}]`,
+	} {
+		if !strings.Contains(string(out), want) {
+			t.Errorf("expected %s in adapted config: %s", want, out)
+		}
+	}
+
+	var c Casefold
+	if err := c.UnmarshalCaddyfile(caddyfile.NewTestDispenser(`casefold {
+		exclude @api
+	}`)); err == nil {
+		t.Fatal("expected named matchers to require a site block")
+	}
+}
+
+func TestUnmarshalCaddyfileErrors(t *testing.T) {
+	for _, input := range []string{
+		`casefold extra`,
+		`casefold {
+			mode
+		}`,
+		`casefold {
+			mode fold lower
+		}`,
+		`casefold {
+			exclude
+		}`,
+		`casefold {
+			redirect permanent
+		}`,
+		`casefold {
+			rewrite_request_uri maybe
+		}`,
+		`casefold {
+			transliterate klingon
+		}`,
+		`casefold {
+			replace ß
+		}`,
+		`casefold {
+			sample_percent 101
+		}`,
+		`casefold {
+			bogus
+		}`,
+	} {
+		var c Casefold
+		if err := c.UnmarshalCaddyfile(caddyfile.NewTestDispenser(input)); err == nil {
+			t.Errorf("expected error for input %q", input)
+		}
+	}
+}
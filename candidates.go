@@ -0,0 +1,58 @@
+package casefold
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/caddyserver/caddy/v2"
+	"github.com/caddyserver/caddy/v2/modules/caddyhttp"
+)
+
+// candidateCount is how many {http.casefold.candidates.N} placeholders
+// Candidates sets.
+const candidateCount = 4
+
+// candidates returns the distinct casings of orig worth trying, in order:
+// as sent, lowercased, title-cased and transformed (the fs casing in fs
+// mode).
+func candidates(orig, transformed string) []string {
+	out := make([]string, 0, candidateCount)
+	for _, p := range []string{
+		orig,
+		lowerCaser{}.String(orig),
+		titleCaser{lowerCaser{}, upperCaser{}}.String(orig),
+		transformed,
+	} {
+		dup := false
+		for _, q := range out {
+			dup = dup || q == p
+		}
+		if !dup {
+			out = append(out, p)
+		}
+	}
+	return out
+}
+
+// publishCandidates exposes candidates(orig, transformed) as the
+// casefold.candidates var, {http.casefold.candidates} (space-separated) and
+// {http.casefold.candidates.0} to {http.casefold.candidates.3}. Indices
+// past the last distinct candidate repeat the first, so try_files never
+// sees an empty entry.
+func (c *Casefold) publishCandidates(r *http.Request, orig, transformed string) {
+	cands := candidates(orig, transformed)
+	caddyhttp.SetVar(r.Context(), "casefold.candidates", cands)
+	repl, ok := r.Context().Value(caddy.ReplacerCtxKey).(*caddy.Replacer)
+	if !ok {
+		return
+	}
+	repl.Set("http.casefold.candidates", strings.Join(cands, " "))
+	for i := 0; i < candidateCount; i++ {
+		p := cands[0]
+		if i < len(cands) {
+			p = cands[i]
+		}
+		repl.Set("http.casefold.candidates."+strconv.Itoa(i), p)
+	}
+}
@@ -0,0 +1,63 @@
+package casefold
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/caddyserver/caddy/v2"
+	"github.com/caddyserver/caddy/v2/modules/caddyhttp"
+)
+
+func TestCandidates(t *testing.T) {
+	for _, tc := range []struct {
+		orig, transformed string
+		want              []string
+	}{
+		{"/about-US/Team.HTML", "/About-Us/team.html", []string{"/about-US/Team.HTML", "/about-us/team.html", "/About-Us/Team.html", "/About-Us/team.html"}},
+		{"/docs", "/docs", []string{"/docs", "/Docs"}},
+		{"/Docs", "/docs", []string{"/Docs", "/docs"}},
+	} {
+		if got := candidates(tc.orig, tc.transformed); !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("candidates(%q, %q) = %q, want %q", tc.orig, tc.transformed, got, tc.want)
+		}
+	}
+}
+
+func TestPublishCandidates(t *testing.T) {
+	root := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(root, "Docs"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(root, "Docs", "README.md"), nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	c := &Casefold{Mode: "fs", Root: root, Shadow: true, Candidates: true}
+	if err := c.Provision(caddy.Context{}); err != nil {
+		t.Fatal(err)
+	}
+	defer c.Cleanup()
+	repl := caddy.NewReplacer()
+	vars := map[string]any{}
+	req := httptest.NewRequest(http.MethodGet, "http://example.test/docs/readme.md", nil)
+	ctx := context.WithValue(req.Context(), caddy.ReplacerCtxKey, repl)
+	req = req.WithContext(context.WithValue(ctx, caddyhttp.VarsCtxKey, vars))
+	rr := httptest.NewRecorder()
+	if err := c.ServeHTTP(rr, req, recordHandler{t}); err != nil {
+		t.Fatal(err)
+	}
+	if got := rr.Header().Get("X-Final-Path"); got != "/docs/readme.md" {
+		t.Errorf("shadow: expected the path left alone, got %s", got)
+	}
+	got := repl.ReplaceAll("{http.casefold.candidates.0}|{http.casefold.candidates.1}|{http.casefold.candidates.2}|{http.casefold.candidates.3}", "")
+	if want := "/docs/readme.md|/Docs/Readme.md|/Docs/README.md|/docs/readme.md"; got != want {
+		t.Errorf("expected %q, got %q", want, got)
+	}
+	if want := []string{"/docs/readme.md", "/Docs/Readme.md", "/Docs/README.md"}; !reflect.DeepEqual(vars["casefold.candidates"], want) {
+		t.Errorf("expected var %q, got %v", want, vars["casefold.candidates"])
+	}
+}
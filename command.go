@@ -0,0 +1,159 @@
+package casefold
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/caddyserver/caddy/v2"
+	caddycmd "github.com/caddyserver/caddy/v2/cmd"
+	"github.com/spf13/cobra"
+)
+
+func init() {
+	caddycmd.RegisterCommand(caddycmd.Command{
+		Name:  "casefold",
+		Short: "Offline tools for the casefold handler",
+		Long: `
+Tools for checking how the casefold handler will treat a site without
+running a server.`,
+		CobraFunc: func(cmd *cobra.Command) {
+			check := &cobra.Command{
+				Use:   "check-collisions [--root <path>] [--format text|json]",
+				Short: "Reports names that collide under case folding",
+				Long: `
+Walks the root directory and reports files and directories whose paths are
+identical once lowercased (e.g. Readme.md and README.md). fs mode can only
+route such paths to one of the candidates, so resolve them before enabling
+it. Exits with status 1 if any collision is found.`,
+				Example: "caddy casefold check-collisions --root /srv/www --format json",
+				RunE:    caddycmd.WrapCommandFuncForCobra(cmdCheckCollisions),
+			}
+			check.Flags().StringP("root", "r", ".", "The root directory to scan")
+			check.Flags().StringP("format", "f", "text", "Output format: text or json")
+			cmd.AddCommand(check)
+
+			resolve := &cobra.Command{
+				Use:   "resolve [--mode <mode>] [--root <path>] [--map-file <path>] <path>...",
+				Short: "Prints the path the handler would route to",
+				Long: `
+Transforms each path the way the casefold handler would and prints the
+result, one per line, so behavior can be checked without sending requests.
+fs mode resolves against --root and map mode against --map-file; paths that
+cannot be resolved are printed unchanged. resolver mode needs a full config
+and is not supported here.`,
+				Example: "caddy casefold resolve --mode fs --root /srv/www /DOCS/intro.html",
+				Args:    cobra.MinimumNArgs(1),
+				RunE:    caddycmd.WrapCommandFuncForCobra(cmdResolve),
+			}
+			resolve.Flags().StringP("mode", "m", "lower", "Mode: lower, upper, title, ascii, fold, fs or map")
+			resolve.Flags().StringP("root", "r", ".", "The root directory for fs mode")
+			resolve.Flags().String("map-file", "", "The mapping file for map mode")
+			cmd.AddCommand(resolve)
+		},
+	})
+}
+
+// collision is one folded path shared by several entries.
+type collision struct {
+	Path       string   `json:"path"`
+	Candidates []string `json:"candidates"`
+}
+
+func cmdCheckCollisions(fl caddycmd.Flags) (int, error) {
+	n, err := checkCollisions(os.Stdout, os.DirFS(fl.String("root")), fl.String("root"), fl.String("format"))
+	if err != nil {
+		return caddy.ExitCodeFailedStartup, err
+	}
+	if n > 0 {
+		return caddy.ExitCodeFailedStartup, fmt.Errorf("%d case collisions found", n)
+	}
+	return caddy.ExitCodeSuccess, nil
+}
+
+// checkCollisions indexes fsys and writes its case collisions to w in the
+// given format, returning how many there were.
+func checkCollisions(w io.Writer, fsys fs.FS, root, format string) (int, error) {
+	if format != "text" && format != "json" {
+		return 0, fmt.Errorf("unknown format %q: must be text or json", format)
+	}
+	idx, err := buildIndex(fsys, "")
+	if err != nil {
+		return 0, err
+	}
+	conflicts := idx.Conflicts()
+	found := make([]collision, 0, len(conflicts))
+	for key, cands := range conflicts {
+		found = append(found, collision{Path: key, Candidates: cands})
+	}
+	sort.Slice(found, func(i, j int) bool { return found[i].Path < found[j].Path })
+
+	if format == "json" {
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return len(found), enc.Encode(map[string]any{"root": root, "collisions": found})
+	}
+	for _, c := range found {
+		if _, err := fmt.Fprintln(w, c.Path); err != nil {
+			return 0, err
+		}
+		for _, cand := range c.Candidates {
+			if _, err := fmt.Fprintf(w, "\t%s\n", cand); err != nil {
+				return 0, err
+			}
+		}
+	}
+	if len(found) == 0 {
+		_, err = fmt.Fprintf(w, "no case collisions under %s\n", root)
+	}
+	return len(found), err
+}
+
+func cmdResolve(fl caddycmd.Flags) (int, error) {
+	ctx, cancel := caddy.NewContext(caddy.Context{Context: context.Background()})
+	defer cancel()
+	c := &Casefold{Mode: fl.String("mode"), Root: fl.String("root"), MapFile: fl.String("map-file"), embedded: true}
+	if err := resolvePaths(ctx, os.Stdout, c, fl.Args()); err != nil {
+		return caddy.ExitCodeFailedStartup, err
+	}
+	return caddy.ExitCodeSuccess, nil
+}
+
+// resolvePaths provisions c and writes the transformed form of each path.
+func resolvePaths(ctx caddy.Context, w io.Writer, c *Casefold, paths []string) error {
+	switch mode := c.modeName(); mode {
+	case "", "lower", "upper", "title", "ascii", "fold", "fs", "map":
+	case "resolver":
+		return fmt.Errorf("resolver mode is not supported offline")
+	default:
+		return fmt.Errorf("unknown mode %q", mode)
+	}
+	if err := c.Provision(ctx); err != nil {
+		return err
+	}
+	defer c.Cleanup()
+	for _, p := range paths {
+		if !strings.HasPrefix(p, "/") {
+			p = "/" + p
+		}
+		r, err := http.NewRequest(http.MethodGet, "/", nil)
+		if err != nil {
+			return err
+		}
+		r.URL.Path = p
+		canon, err := c.transform(r, p)
+		if err != nil {
+			return err
+		}
+		if _, err := fmt.Fprintln(w, canon); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,94 @@
+package casefold
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"github.com/caddyserver/caddy/v2"
+)
+
+func TestCheckCollisions(t *testing.T) {
+	fsys := fstest.MapFS{
+		"README.md":      &fstest.MapFile{},
+		"Readme.md":      &fstest.MapFile{},
+		"Docs/a.txt":     &fstest.MapFile{},
+		"docs/b.txt":     &fstest.MapFile{},
+		"unique/File.go": &fstest.MapFile{},
+	}
+	var buf bytes.Buffer
+	n, err := checkCollisions(&buf, fsys, "/srv", "text")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 2 {
+		t.Fatalf("expected 2 collisions, got %d:\n%s", n, buf.String())
+	}
+	want := "/docs\n\t/Docs\n\t/docs\n/readme.md\n\t/README.md\n\t/Readme.md\n"
+	if buf.String() != want {
+		t.Fatalf("expected\n%s\ngot\n%s", want, buf.String())
+	}
+
+	buf.Reset()
+	if _, err := checkCollisions(&buf, fsys, "/srv", "json"); err != nil {
+		t.Fatal(err)
+	}
+	var report struct {
+		Root       string      `json:"root"`
+		Collisions []collision `json:"collisions"`
+	}
+	if err := json.Unmarshal(buf.Bytes(), &report); err != nil {
+		t.Fatal(err)
+	}
+	if report.Root != "/srv" || len(report.Collisions) != 2 || !reflect.DeepEqual(report.Collisions[1].Candidates, []string{"/README.md", "/Readme.md"}) {
+		t.Fatalf("unexpected report: %+v", report)
+	}
+}
+
+func TestCheckCollisionsNone(t *testing.T) {
+	var buf bytes.Buffer
+	n, err := checkCollisions(&buf, fstest.MapFS{"a": &fstest.MapFile{}}, "/srv", "text")
+	if err != nil || n != 0 || !strings.Contains(buf.String(), "no case collisions") {
+		t.Fatalf("expected no collisions, got %d %v %q", n, err, buf.String())
+	}
+	if _, err := checkCollisions(&buf, fstest.MapFS{}, "/srv", "yaml"); err == nil {
+		t.Fatal("expected unknown format error")
+	}
+}
+
+func TestResolvePaths(t *testing.T) {
+	root := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(root, "Docs"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	mapFile := filepath.Join(t.TempDir(), "map.csv")
+	if err := os.WriteFile(mapFile, []byte("/old,/New\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	for _, tc := range []struct {
+		c     *Casefold
+		paths []string
+		want  string
+	}{
+		{&Casefold{Mode: "lower"}, []string{"/A/B", "c"}, "/a/b\n/c\n"},
+		{&Casefold{Mode: "fs", Root: root}, []string{"/docs", "/missing"}, "/Docs\n/missing\n"},
+		{&Casefold{Mode: "map", MapFile: mapFile}, []string{"/OLD"}, "/New\n"},
+	} {
+		var buf bytes.Buffer
+		if err := resolvePaths(caddy.Context{}, &buf, tc.c, tc.paths); err != nil {
+			t.Fatal(err)
+		}
+		if buf.String() != tc.want {
+			t.Errorf("%s: expected %q, got %q", tc.c.Mode, tc.want, buf.String())
+		}
+	}
+	if err := resolvePaths(caddy.Context{}, io.Discard, &Casefold{Mode: "resolver"}, []string{"/a"}); err == nil {
+		t.Fatal("expected resolver mode to be rejected")
+	}
+}
@@ -0,0 +1,108 @@
+package casefold
+
+import (
+	"container/list"
+	"io/fs"
+	"sync"
+	"time"
+)
+
+// dirCache is a bounded LRU of directory listings, keyed by directory and
+// validated against the directory's modification time and size, so hot
+// directories are scanned once and rescanned only after they change.
+type dirCache struct {
+	mu    sync.Mutex
+	size  int
+	ll    *list.List
+	items map[string]*list.Element
+}
+
+// dirListing is a directory's entry names grouped by folded form, each
+// group in lexical order, as of mtime and size.
+type dirListing struct {
+	dir    string
+	mtime  time.Time
+	size   int64
+	byFold map[string][]string
+}
+
+func newDirCache(size int) *dirCache {
+	return &dirCache{size: size, ll: list.New(), items: make(map[string]*list.Element, size)}
+}
+
+// get returns the listing of dir if it is still current for fi.
+func (dc *dirCache) get(dir string, fi fs.FileInfo) *dirListing {
+	dc.mu.Lock()
+	defer dc.mu.Unlock()
+	el, ok := dc.items[dir]
+	if !ok {
+		return nil
+	}
+	dl := el.Value.(*dirListing)
+	if !dl.mtime.Equal(fi.ModTime()) || dl.size != fi.Size() {
+		dc.ll.Remove(el)
+		delete(dc.items, dir)
+		return nil
+	}
+	dc.ll.MoveToFront(el)
+	return dl
+}
+
+func (dc *dirCache) put(dl *dirListing) {
+	dc.mu.Lock()
+	defer dc.mu.Unlock()
+	if el, ok := dc.items[dl.dir]; ok {
+		el.Value = dl
+		dc.ll.MoveToFront(el)
+		return
+	}
+	dc.items[dl.dir] = dc.ll.PushFront(dl)
+	for dc.ll.Len() > dc.size {
+		el := dc.ll.Back()
+		dc.ll.Remove(el)
+		delete(dc.items, el.Value.(*dirListing).dir)
+	}
+}
+
+// Len returns the number of directories currently held.
+func (dc *dirCache) Len() int {
+	dc.mu.Lock()
+	defer dc.mu.Unlock()
+	return dc.ll.Len()
+}
+
+// matchNames returns the entries of dir whose folded name is folded, in
+// lexical order. fi is dir's FileInfo when the directory cache is in use
+// and nil otherwise; directories without a modification time, as in some
+// virtual filesystems, are never cached.
+func (c *Casefold) matchNames(dir string, fi fs.FileInfo, folded string, deadline time.Time) ([]string, error) {
+	var dc *dirCache
+	if c.state != nil && fi != nil && !fi.ModTime().IsZero() {
+		dc = c.state.dirs
+	}
+	if dc != nil {
+		if dl := dc.get(dir, fi); dl != nil {
+			return dl.byFold[folded], nil
+		}
+	}
+	entries, err := c.readDir(dir, deadline)
+	if err != nil {
+		return nil, err
+	}
+	if dc == nil {
+		var names []string
+		for _, e := range entries {
+			if c.norm.fold(e.Name()) == folded {
+				names = append(names, e.Name())
+			}
+		}
+		return names, nil
+	}
+	dl := &dirListing{dir: dir, mtime: fi.ModTime(), size: fi.Size(), byFold: make(map[string][]string, len(entries))}
+	for _, e := range entries {
+		key := c.norm.fold(e.Name())
+		dl.byFold[key] = append(dl.byFold[key], e.Name())
+	}
+	dc.put(dl)
+	return dl.byFold[folded], nil
+}
@@ -0,0 +1,72 @@
+package casefold
+
+import (
+	"io/fs"
+	"testing"
+	"testing/fstest"
+	"time"
+)
+
+// countingFS counts directory reads.
+type countingFS struct {
+	fstest.MapFS
+	reads int
+}
+
+func (f *countingFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	f.reads++
+	return f.MapFS.ReadDir(name)
+}
+
+func TestDirCache(t *testing.T) {
+	t0 := time.Unix(1000, 0)
+	fsys := &countingFS{MapFS: fstest.MapFS{
+		".":                 &fstest.MapFile{Mode: fs.ModeDir, ModTime: t0},
+		"Docs":              &fstest.MapFile{Mode: fs.ModeDir, ModTime: t0},
+		"Docs/Guide.HTML":   &fstest.MapFile{ModTime: t0},
+		"Docs/Install.HTML": &fstest.MapFile{ModTime: t0},
+	}}
+	c := &Casefold{Mode: "fs", fsys: fsys}
+	c.state = &fsState{fsys: fsys, dirs: newDirCache(8)}
+
+	for _, p := range []string{"/docs/guide.html", "/DOCS/install.html", "/docs/GUIDE.html"} {
+		if _, ok := c.resolveFS(p); !ok {
+			t.Fatalf("%s did not resolve", p)
+		}
+	}
+	if fsys.reads != 2 {
+		t.Fatalf("expected 2 directory reads, got %d", fsys.reads)
+	}
+
+	// a deploy adds a file and bumps the directory's mtime
+	fsys.MapFS["Docs/FAQ.HTML"] = &fstest.MapFile{ModTime: t0}
+	fsys.MapFS["Docs"].ModTime = t0.Add(time.Second)
+	if got, ok := c.resolveFS("/docs/faq.html"); !ok || got != "/Docs/FAQ.HTML" {
+		t.Fatalf("expected /Docs/FAQ.HTML after the change, got %q %v", got, ok)
+	}
+	if fsys.reads != 3 {
+		t.Fatalf("expected only the changed directory to be reread, got %d reads", fsys.reads)
+	}
+
+	// no modification time: never cached
+	fsys.MapFS["Docs"].ModTime = time.Time{}
+	c.resolveFS("/docs/faq.html")
+	c.resolveFS("/docs/faq.html")
+	if fsys.reads != 5 {
+		t.Fatalf("expected directories without mtime to be reread, got %d reads", fsys.reads)
+	}
+}
+
+func TestDirCacheEviction(t *testing.T) {
+	dc := newDirCache(1)
+	fi := fstest.MapFS{"a": &fstest.MapFile{Mode: fs.ModeDir, ModTime: time.Unix(1, 0)}}
+	info, err := fs.Stat(fi, "a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	dc.put(&dirListing{dir: "a", mtime: info.ModTime(), size: info.Size()})
+	dc.put(&dirListing{dir: "b", mtime: info.ModTime(), size: info.Size()})
+	if dc.get("a", info) != nil || dc.get("b", info) == nil || dc.Len() != 1 {
+		t.Fatal("expected the least recently used listing to be evicted")
+	}
+}
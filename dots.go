@@ -0,0 +1,67 @@
+package casefold
+
+import (
+	"fmt"
+	"strings"
+)
+
+// DotSegments policies.
+const (
+	dotSegmentsKeep    = "keep"
+	dotSegmentsResolve = "resolve"
+	dotSegmentsReject  = "reject"
+)
+
+func validDotSegments(p string) bool {
+	switch p {
+	case "", dotSegmentsKeep, dotSegmentsResolve, dotSegmentsReject:
+		return true
+	}
+	return false
+}
+
+// hasDotSegment reports whether p has a "." or ".." segment.
+func hasDotSegment(p string) bool {
+	for _, seg := range strings.Split(p, "/") {
+		if seg == "." || seg == ".." {
+			return true
+		}
+	}
+	return false
+}
+
+// resolveDotSegments removes the "." and ".." segments of p as RFC 3986
+// section 5.2.4 does: ".." drops the segment before it, never climbing
+// above the root, and a path ending in a dot segment ends in a slash.
+// Unlike path.Clean it keeps empty segments and a trailing slash.
+func resolveDotSegments(p string) string {
+	if !hasDotSegment(p) {
+		return p
+	}
+	segs := strings.Split(strings.TrimPrefix(p, "/"), "/")
+	out := make([]string, 0, len(segs))
+	for i, seg := range segs {
+		switch seg {
+		case ".":
+		case "..":
+			if len(out) > 0 {
+				out = out[:len(out)-1]
+			}
+		default:
+			out = append(out, seg)
+			continue
+		}
+		if i == len(segs)-1 {
+			out = append(out, "")
+		}
+	}
+	return "/" + strings.Join(out, "/")
+}
+
+// rejectDotSegments fails a path with dot segments under the reject policy.
+func (c *Casefold) rejectDotSegments(p string) error {
+	if c.DotSegments == dotSegmentsReject && hasDotSegment(p) {
+		return fmt.Errorf("dot segment in path %q", p)
+	}
+	return nil
+}
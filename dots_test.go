@@ -0,0 +1,51 @@
+package casefold
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/caddyserver/caddy/v2"
+	"github.com/caddyserver/caddy/v2/modules/caddyhttp"
+)
+
+func TestDotSegments(t *testing.T) {
+	for p, want := range map[string]string{
+		"/a/./b/../c": "/a/c",
+		"/a/b/..":     "/a/",
+		"/a/.":        "/a/",
+		"/../../a":    "/a",
+		"/..":         "/",
+		"/a//b/../c/": "/a//c/",
+		"/a/..b/.c":   "/a/..b/.c",
+	} {
+		if got := resolveDotSegments(p); got != want {
+			t.Errorf("resolveDotSegments(%q) = %q, want %q", p, got, want)
+		}
+	}
+
+	for policy, want := range map[string]string{"": "/docs/../admin", "keep": "/docs/../admin", "resolve": "/admin"} {
+		c := &Casefold{Mode: "lower", DotSegments: policy}
+		if err := c.Provision(caddy.Context{}); err != nil {
+			t.Fatal(err)
+		}
+		rr := httptest.NewRecorder()
+		if err := c.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/Docs/../Admin", nil), recordHandler{t}); err != nil {
+			t.Fatal(err)
+		}
+		if got := rr.Header().Get("X-Final-Path"); got != want {
+			t.Errorf("%q: expected %s, got %s", policy, want, got)
+		}
+	}
+
+	c := &Casefold{Mode: "lower", DotSegments: "reject"}
+	if err := c.Provision(caddy.Context{}); err != nil {
+		t.Fatal(err)
+	}
+	err := c.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/Docs/%2e%2e/Admin", nil), recordHandler{t})
+	var herr caddyhttp.HandlerError
+	if !errors.As(err, &herr) || herr.StatusCode != http.StatusBadRequest {
+		t.Errorf("reject: expected 400, got %v", err)
+	}
+}
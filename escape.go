@@ -0,0 +1,141 @@
+package casefold
+
+import (
+	"net/url"
+	"strings"
+	"unicode/utf8"
+)
+
+// escapedRune is one rune of a decoded path segment and how the client
+// wrote it: esc is its percent-encoded form, or empty if sent literally.
+type escapedRune struct {
+	r   rune
+	esc string
+}
+
+// decodeSegment splits the escaped path segment seg into runes, keeping
+// the escape sequence of each one that was percent-encoded. ok is false if
+// seg is not valid escaping of UTF-8 text.
+func decodeSegment(seg string) (out []escapedRune, ok bool) {
+	for len(seg) > 0 {
+		if seg[0] != '%' {
+			r, n := utf8.DecodeRuneInString(seg)
+			out = append(out, escapedRune{r: r})
+			seg = seg[n:]
+			continue
+		}
+		// gather the escapes making up one UTF-8 sequence
+		var raw []byte
+		i := 0
+		for i+3 <= len(seg) && seg[i] == '%' {
+			b, err := url.PathUnescape(seg[i : i+3])
+			if err != nil {
+				return nil, false
+			}
+			raw = append(raw, b[0])
+			i += 3
+			if utf8.FullRune(raw) {
+				break
+			}
+		}
+		if i == 0 || !utf8.FullRune(raw) {
+			return nil, false
+		}
+		r, n := utf8.DecodeRune(raw)
+		if n != len(raw) {
+			return nil, false
+		}
+		out = append(out, escapedRune{r: r, esc: seg[:i]})
+		seg = seg[i:]
+	}
+	return out, true
+}
+
+// escapeLike escapes the decoded path p the way like, the path as the
+// client escaped it, was escaped: runes the client percent-encoded stay
+// encoded (with their original escape when the rune is unchanged), and
+// others are escaped only where a path requires it. Segments whose rune
+// count the transform changed fall back to the default escaping. In p and
+// like alike, slashMark and %2F mark an encoded slash.
+func escapeLike(p, like string) string {
+	segs := strings.Split(p, "/")
+	likeSegs := strings.Split(like, "/")
+	for i, seg := range segs {
+		var orig []escapedRune
+		if len(segs) == len(likeSegs) {
+			orig, _ = decodeSegment(likeSegs[i])
+		}
+		segs[i] = escapeSegment(seg, orig)
+	}
+	return strings.Join(segs, "/")
+}
+
+// escapeSegment escapes seg, mirroring orig rune by rune if they have the
+// same length.
+func escapeSegment(seg string, orig []escapedRune) string {
+	if utf8.RuneCountInString(seg) != len(orig) {
+		orig = nil
+	}
+	var b strings.Builder
+	i := 0
+	for _, r := range seg {
+		switch s := string(r); {
+		case s == slashMark:
+			b.WriteString("%2F")
+		case orig != nil && orig[i].esc != "" && orig[i].r == r:
+			b.WriteString(orig[i].esc)
+		case orig != nil && orig[i].esc != "":
+			b.WriteString(percentEncode(s))
+		default:
+			b.WriteString((&url.URL{Path: s}).EscapedPath())
+		}
+		i++
+	}
+	return b.String()
+}
+
+// PercentHex cases.
+const (
+	percentHexUpper = "upper"
+	percentHexLower = "lower"
+)
+
+// normalizeHex returns raw, or the default escaping of p if raw is empty,
+// with the hex digits of its escapes in upper or lower case. The result is
+// empty if it is the default escaping of p.
+func normalizeHex(p, raw string, upper bool) string {
+	def := (&url.URL{Path: p}).EscapedPath()
+	if raw == "" {
+		raw = def
+	}
+	b := []byte(raw)
+	for i := 0; i+2 < len(b); i++ {
+		if b[i] != '%' {
+			continue
+		}
+		for j := i + 1; j <= i+2; j++ {
+			if upper && 'a' <= b[j] && b[j] <= 'f' {
+				b[j] -= 'a' - 'A'
+			} else if !upper && 'A' <= b[j] && b[j] <= 'F' {
+				b[j] += 'a' - 'A'
+			}
+		}
+		i += 2
+	}
+	if n := string(b); n != def {
+		return n
+	}
+	return ""
+}
+
+// percentEncode escapes every byte of s.
+func percentEncode(s string) string {
+	const hex = "0123456789ABCDEF"
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		b.WriteByte('%')
+		b.WriteByte(hex[s[i]>>4])
+		b.WriteByte(hex[s[i]&15])
+	}
+	return b.String()
+}
@@ -0,0 +1,80 @@
+package casefold
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/caddyserver/caddy/v2"
+	"github.com/caddyserver/caddy/v2/modules/caddyhttp"
+)
+
+func TestEscapeLike(t *testing.T) {
+	for _, tc := range []struct{ p, like, want string }{
+		{"/café menu", "/Caf%c3%a9%20Menu", "/caf%c3%a9%20menu"}, // unchanged runes keep their escapes
+		{"/café", "/CAF%C3%89", "/caf%C3%A9"},                    // changed ones are re-encoded
+		{"/a:b", "/A%3AB", "/a%3Ab"},                             // reserved characters stay encoded
+		{"/a:b", "/A:B", "/a:b"},                                 // or literal
+		{"/strasse/x", "/Stra%C3%9Fe/X", "/strasse/x"},           // length changed: default escaping
+		{"/a b/c", "/A%20B/C/D", "/a%20b/c"},                     // segment count changed
+		{"/a" + slashMark + "b", "/A%2fB", "/a%2Fb"},             // encoded slash, always as %2F
+	} {
+		if got := escapeLike(tc.p, tc.like); got != tc.want {
+			t.Errorf("escapeLike(%q, %q) = %q, want %q", tc.p, tc.like, got, tc.want)
+		}
+	}
+}
+
+func TestEscapingPreserved(t *testing.T) {
+	c := &Casefold{Mode: "lower"}
+	if err := c.Provision(caddy.Context{}); err != nil {
+		t.Fatal(err)
+	}
+	for target, want := range map[string]string{
+		"/Caf%C3%A9%20Menu":  "/caf%C3%A9%20menu",
+		"/Caf%c3%a9%20Menu":  "/caf%c3%a9%20menu",
+		"/Docs/%5BDraft%5D":  "/docs/%5Bdraft%5D",
+		"/Docs/A%2FB%3bPart": "/docs/a%2Fb%3bpart",
+	} {
+		var got *http.Request
+		next := caddyhttp.HandlerFunc(func(_ http.ResponseWriter, r *http.Request) error {
+			got = r
+			return nil
+		})
+		if err := c.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, target, nil), next); err != nil {
+			t.Fatal(err)
+		}
+		if got.URL.EscapedPath() != want || got.RequestURI != want {
+			t.Errorf("%s: expected %s, got escaped path %s, RequestURI %s", target, want, got.URL.EscapedPath(), got.RequestURI)
+		}
+	}
+}
+
+func TestPercentHex(t *testing.T) {
+	c := &Casefold{Mode: "lower", PercentHex: "upper"}
+	if err := c.Provision(caddy.Context{}); err != nil {
+		t.Fatal(err)
+	}
+	for target, want := range map[string]string{
+		"/Caf%c3%a9":     "/caf%C3%A9",
+		"/caf%c3%a9":     "/caf%C3%A9", // only the escapes change
+		"/docs/a%2fb":    "/docs/a%2Fb",
+		"/caf%C3%A9":     "/caf%C3%A9",
+		"/a%20b/%5bx%5d": "/a%20b/%5Bx%5D",
+	} {
+		var got *http.Request
+		next := caddyhttp.HandlerFunc(func(_ http.ResponseWriter, r *http.Request) error {
+			got = r
+			return nil
+		})
+		if err := c.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, target, nil), next); err != nil {
+			t.Fatal(err)
+		}
+		if got.URL.EscapedPath() != want || got.RequestURI != want {
+			t.Errorf("%s: expected %s, got escaped path %s, RequestURI %s", target, want, got.URL.EscapedPath(), got.RequestURI)
+		}
+	}
+	if err := (&Casefold{Mode: "lower", PercentHex: "mixed"}).Provision(caddy.Context{}); err == nil {
+		t.Error("expected an invalid percent_hex to be rejected")
+	}
+}
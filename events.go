@@ -0,0 +1,56 @@
+package casefold
+
+import (
+	"net/http"
+
+	"github.com/caddyserver/caddy/v2"
+	"github.com/caddyserver/caddy/v2/modules/caddyevents"
+)
+
+// Event names emitted through the events app when Events is enabled.
+const (
+	eventRewritten = "casefold.rewritten"
+	eventConflict  = "casefold.conflict"
+)
+
+// eventEmitter is the part of *caddyevents.App the handler uses.
+type eventEmitter interface {
+	Emit(ctx caddy.Context, eventName string, data map[string]any) caddy.Event
+}
+
+// provisionEvents connects c to the events app.
+func (c *Casefold) provisionEvents(ctx caddy.Context) error {
+	app, err := ctx.App("events")
+	if err != nil {
+		return err
+	}
+	c.events = app.(*caddyevents.App)
+	return nil
+}
+
+// emitRewritten announces that r's path was changed from orig to canon,
+// either by rewriting the request or by redirecting ("rewrite"/"redirect").
+func (c *Casefold) emitRewritten(r *http.Request, action, orig, canon string) {
+	if c.events == nil {
+		return
+	}
+	c.events.Emit(c.ctx, eventRewritten, map[string]any{
+		"original_path": orig,
+		"path":          canon,
+		"mode":          c.modeOrDefault(),
+		"action":        action,
+		"host":          r.Host,
+	})
+}
+
+// emitConflict announces that several entries share the folded path key.
+func (c *Casefold) emitConflict(key string, candidates []string) {
+	if c.events == nil {
+		return
+	}
+	c.events.Emit(c.ctx, eventConflict, map[string]any{
+		"root":       c.rootID(),
+		"path":       key,
+		"candidates": candidates,
+	})
+}
@@ -0,0 +1,84 @@
+package casefold
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"testing"
+
+	"github.com/caddyserver/caddy/v2"
+)
+
+type recordedEvent struct {
+	name string
+	data map[string]any
+}
+
+type fakeEmitter struct {
+	mu     sync.Mutex
+	events []recordedEvent
+}
+
+func (f *fakeEmitter) Emit(_ caddy.Context, name string, data map[string]any) caddy.Event {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.events = append(f.events, recordedEvent{name, data})
+	return caddy.Event{}
+}
+
+func TestCasefoldEmitsRewritten(t *testing.T) {
+	c := &Casefold{Mode: "lower"}
+	if err := c.Provision(caddy.Context{}); err != nil {
+		t.Fatal(err)
+	}
+	em := new(fakeEmitter)
+	c.events = em
+	for _, target := range []string{"/Foo", "/bar"} {
+		req := httptest.NewRequest(http.MethodGet, "http://example.test"+target, nil)
+		if err := c.ServeHTTP(httptest.NewRecorder(), req, recordHandler{t}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(em.events) != 1 || em.events[0].name != eventRewritten {
+		t.Fatalf("expected one %s event, got %v", eventRewritten, em.events)
+	}
+	want := map[string]any{"original_path": "/Foo", "path": "/foo", "mode": "lower", "action": "rewrite", "host": "example.test"}
+	if !reflect.DeepEqual(em.events[0].data, want) {
+		t.Fatalf("expected data %v, got %v", want, em.events[0].data)
+	}
+}
+
+func TestCasefoldEmitsConflict(t *testing.T) {
+	root := t.TempDir()
+	for _, name := range []string{"README.md", "Readme.md"} {
+		if err := os.WriteFile(filepath.Join(root, name), nil, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	probe := filepath.Join(root, "readme.MD")
+	if _, err := os.Stat(probe); err == nil {
+		t.Skip("filesystem is case-insensitive")
+	}
+	c := &Casefold{Mode: "fs", Root: root}
+	if err := c.Provision(caddy.Context{}); err != nil {
+		t.Fatal(err)
+	}
+	defer c.Cleanup()
+	em := new(fakeEmitter)
+	c.events = em
+	if _, ok := c.resolveFS("/readme.MD"); !ok {
+		t.Fatal("expected path to resolve")
+	}
+	if len(em.events) != 1 || em.events[0].name != eventConflict {
+		t.Fatalf("expected one %s event, got %v", eventConflict, em.events)
+	}
+	if got := em.events[0].data["candidates"]; !reflect.DeepEqual(got, []string{"/README.md", "/Readme.md"}) {
+		t.Fatalf("unexpected candidates %v", got)
+	}
+	if got := em.events[0].data["path"]; got != "/readme.md" {
+		t.Fatalf("expected folded path /readme.md, got %v", got)
+	}
+}
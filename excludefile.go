@@ -0,0 +1,115 @@
+package casefold
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/fsnotify/fsnotify"
+	"go.uber.org/zap"
+)
+
+// excludeFile keeps the patterns of an exclude_file loaded into an
+// excludeList, reloading them whenever the file changes. If a reload fails,
+// the previous patterns stay in effect.
+type excludeFile struct {
+	file    string
+	list    *excludeList
+	watcher *fsnotify.Watcher
+	done    chan struct{}
+	log     *zap.Logger
+}
+
+// newExcludeFile loads file into list and starts watching it. Call Close to
+// stop.
+func newExcludeFile(file string, list *excludeList, log *zap.Logger) (*excludeFile, error) {
+	ef := &excludeFile{file: file, list: list, log: log}
+	if err := ef.load(); err != nil {
+		return nil, err
+	}
+	w, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, err
+	}
+	// watch the directory, as MapResolver does, to survive atomic renames
+	if err := w.Add(filepath.Dir(file)); err != nil {
+		_ = w.Close()
+		return nil, fmt.Errorf("watching exclude file %s: %v", file, err)
+	}
+	ef.watcher = w
+	ef.done = make(chan struct{})
+	go ef.watch()
+	return ef, nil
+}
+
+func (ef *excludeFile) watch() {
+	defer close(ef.done)
+	target := filepath.Clean(ef.file)
+	for {
+		select {
+		case ev, ok := <-ef.watcher.Events:
+			if !ok {
+				return
+			}
+			if filepath.Clean(ev.Name) != target || !(ev.Has(fsnotify.Write) || ev.Has(fsnotify.Create)) {
+				continue
+			}
+			if err := ef.load(); err != nil {
+				ef.log.Error("casefold exclude file reload failed; keeping previous patterns", zap.String("file", ef.file), zap.Error(err))
+				continue
+			}
+			ef.log.Info("casefold exclude file reloaded", zap.String("file", ef.file))
+		case err, ok := <-ef.watcher.Errors:
+			if !ok {
+				return
+			}
+			ef.log.Warn("casefold exclude file watcher error", zap.Error(err))
+		}
+	}
+}
+
+// load parses the file and swaps its patterns in.
+func (ef *excludeFile) load() error {
+	f, err := os.Open(ef.file)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	patterns, err := parseExcludePatterns(f)
+	if err != nil {
+		return fmt.Errorf("parsing exclude file %s: %v", ef.file, err)
+	}
+	ef.list.SetSource(ef.file, patterns)
+	return nil
+}
+
+// parseExcludePatterns reads one pattern per line. Blank lines and lines
+// starting with '#' are ignored; surrounding whitespace is trimmed.
+func parseExcludePatterns(r io.Reader) ([]string, error) {
+	var patterns []string
+	sc := bufio.NewScanner(r)
+	for sc.Scan() {
+		line := strings.TrimSpace(sc.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		patterns = append(patterns, line)
+	}
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+	if err := validateExcludes(patterns); err != nil {
+		return nil, err
+	}
+	return patterns, nil
+}
+
+// Close stops watching the file.
+func (ef *excludeFile) Close() error {
+	err := ef.watcher.Close()
+	<-ef.done
+	return err
+}
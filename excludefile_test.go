@@ -0,0 +1,90 @@
+package casefold
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/caddyserver/caddy/v2"
+)
+
+func TestParseExcludePatterns(t *testing.T) {
+	patterns, err := parseExcludePatterns(strings.NewReader("# managed by platform\n/api/*\n\n  /Media/*.ZIP  \n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"/api/*", "/Media/*.ZIP"}; !reflect.DeepEqual(patterns, want) {
+		t.Errorf("expected %v, got %v", want, patterns)
+	}
+	if _, err := parseExcludePatterns(strings.NewReader("/ok/*\n[a-\n")); err == nil {
+		t.Error("expected error for malformed pattern")
+	}
+}
+
+func TestExcludeFileReload(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "excludes.txt")
+	if err := os.WriteFile(file, []byte("/Api/*\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	c := &Casefold{Exclude: []string{"/Raw/*"}, ExcludeFile: file}
+	if err := c.Provision(caddy.Context{}); err != nil {
+		t.Fatal(err)
+	}
+	defer c.Cleanup()
+	serve := func(p string) string {
+		rr := httptest.NewRecorder()
+		if err := c.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, p, nil), recordHandler{t}); err != nil {
+			t.Fatal(err)
+		}
+		return rr.Header().Get("X-Final-Path")
+	}
+	if got := serve("/Api/Items"); got != "/Api/Items" {
+		t.Fatalf("expected file pattern to exclude, got %s", got)
+	}
+	if got := serve("/Raw/Blob"); got != "/Raw/Blob" {
+		t.Fatalf("expected configured pattern to exclude, got %s", got)
+	}
+	replaceFile(t, file, "/Media/*\n")
+	deadline := time.Now().Add(2 * time.Second)
+	for serve("/Api/Items") != "/api/items" && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if got := serve("/Api/Items"); got != "/api/items" {
+		t.Fatalf("expected reload to drop old pattern, got %s", got)
+	}
+	if got := serve("/Media/Clip"); got != "/Media/Clip" {
+		t.Fatalf("expected reloaded pattern to exclude, got %s", got)
+	}
+
+	// a broken reload keeps the previous patterns
+	replaceFile(t, file, "[a-\n")
+	time.Sleep(100 * time.Millisecond)
+	if want := []string{"/Raw/*", "/Media/*"}; !reflect.DeepEqual(c.excludes.All(), want) {
+		t.Fatalf("expected %v after failed reload, got %v", want, c.excludes.All())
+	}
+}
+
+func TestExcludeFileMissing(t *testing.T) {
+	c := &Casefold{ExcludeFile: filepath.Join(t.TempDir(), "missing.txt")}
+	if err := c.Provision(caddy.Context{}); err == nil {
+		t.Fatal("expected missing exclude file to fail provisioning")
+	}
+}
+
+// replaceFile swaps file's content by renaming, so the watcher never sees a
+// truncated, empty file in between.
+func replaceFile(t *testing.T, file, content string) {
+	t.Helper()
+	tmp := file + ".tmp"
+	if err := os.WriteFile(tmp, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Rename(tmp, file); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,197 @@
+package casefold
+
+import (
+	"fmt"
+	"path"
+	"sort"
+	"sync"
+	"sync/atomic"
+)
+
+// excludeList is the live set of exclude patterns of one handler. It starts
+// as the configured Exclude and can be patched at runtime through the admin
+// API; patterns loaded from external sources such as exclude_file are kept
+// apart and replaced wholesale on reload. Readers never block.
+type excludeList struct {
+	mu       sync.Mutex // serializes writers
+	patterns atomic.Pointer[[]string]
+	// sources maps an external source to its patterns; guarded by mu.
+	sources map[string][]string
+	// all is patterns followed by every source's, deduplicated.
+	all atomic.Pointer[[]string]
+	// set is all, compiled for matching with key.
+	set atomic.Pointer[excludeSet]
+	key func(string) string
+}
+
+// newExcludeList returns a list starting with patterns, which must be
+// valid. key, if non-nil, maps patterns and paths before they are compared.
+func newExcludeList(patterns []string, key func(string) string) *excludeList {
+	el := &excludeList{sources: make(map[string][]string), key: key}
+	el.store(append([]string(nil), patterns...))
+	return el
+}
+
+// Match returns a pattern matching p, or "" if none does.
+func (el *excludeList) Match(p string) string {
+	return el.set.Load().match(p)
+}
+
+// Patterns returns the current patchable patterns. The slice must not be
+// modified.
+func (el *excludeList) Patterns() []string {
+	return *el.patterns.Load()
+}
+
+// All returns the patchable patterns followed by those of every source.
+// The slice must not be modified.
+func (el *excludeList) All() []string {
+	return *el.all.Load()
+}
+
+// SetSource replaces the patterns loaded from source.
+func (el *excludeList) SetSource(source string, patterns []string) {
+	el.mu.Lock()
+	defer el.mu.Unlock()
+	el.sources[source] = append([]string(nil), patterns...)
+	el.store(el.Patterns())
+}
+
+// store swaps in the patchable patterns and recomputes All and its
+// compiled form. Callers other than newExcludeList must hold mu.
+func (el *excludeList) store(patterns []string) {
+	el.patterns.Store(&patterns)
+	names := make([]string, 0, len(el.sources))
+	for name := range el.sources {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	all := make([]string, 0, len(patterns))
+	seen := make(map[string]struct{}, len(patterns))
+	add := func(p string) {
+		if _, ok := seen[p]; !ok {
+			seen[p] = struct{}{}
+			all = append(all, p)
+		}
+	}
+	for _, p := range patterns {
+		add(p)
+	}
+	for _, name := range names {
+		for _, p := range el.sources[name] {
+			add(p)
+		}
+	}
+	el.all.Store(&all)
+	el.set.Store(compileExcludes(all, el.key))
+}
+
+// Add appends the patterns not already present and reports how many were
+// added.
+func (el *excludeList) Add(patterns ...string) int {
+	el.mu.Lock()
+	defer el.mu.Unlock()
+	cur := el.Patterns()
+	next := append([]string(nil), cur...)
+	for _, p := range patterns {
+		if !containsString(next, p) {
+			next = append(next, p)
+		}
+	}
+	el.store(next)
+	return len(next) - len(cur)
+}
+
+// Remove drops the given patterns and reports how many were removed.
+func (el *excludeList) Remove(patterns ...string) int {
+	el.mu.Lock()
+	defer el.mu.Unlock()
+	cur := el.Patterns()
+	next := make([]string, 0, len(cur))
+	for _, p := range cur {
+		if !containsString(patterns, p) {
+			next = append(next, p)
+		}
+	}
+	el.store(next)
+	return len(cur) - len(next)
+}
+
+func containsString(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// validateExcludes reports the first malformed pattern.
+func validateExcludes(patterns []string) error {
+	for _, p := range patterns {
+		if _, err := path.Match(p, ""); err != nil {
+			return fmt.Errorf("invalid exclude pattern %q: %v", p, err)
+		}
+	}
+	return nil
+}
+
+// handlers tracks provisioned handlers by Name so the admin API can reach
+// their exclude lists.
+var handlers = struct {
+	sync.RWMutex
+	byName map[string]map[*Casefold]struct{}
+}{byName: make(map[string]map[*Casefold]struct{})}
+
+// defaultHandlerName is the admin API name of handlers without a Name.
+const defaultHandlerName = "default"
+
+func (c *Casefold) handlerName() string {
+	if c.Name != "" {
+		return c.Name
+	}
+	return defaultHandlerName
+}
+
+func registerHandler(c *Casefold) {
+	handlers.Lock()
+	defer handlers.Unlock()
+	name := c.handlerName()
+	if handlers.byName[name] == nil {
+		handlers.byName[name] = make(map[*Casefold]struct{})
+	}
+	handlers.byName[name][c] = struct{}{}
+}
+
+func unregisterHandler(c *Casefold) {
+	handlers.Lock()
+	defer handlers.Unlock()
+	name := c.handlerName()
+	delete(handlers.byName[name], c)
+	if len(handlers.byName[name]) == 0 {
+		delete(handlers.byName, name)
+	}
+}
+
+// handlersNamed returns the live handlers registered under name.
+func handlersNamed(name string) []*Casefold {
+	handlers.RLock()
+	defer handlers.RUnlock()
+	out := make([]*Casefold, 0, len(handlers.byName[name]))
+	for c := range handlers.byName[name] {
+		out = append(out, c)
+	}
+	return out
+}
+
+// handlerNames returns the names with at least one live handler, sorted.
+func handlerNames() []string {
+	handlers.RLock()
+	defer handlers.RUnlock()
+	names := make([]string, 0, len(handlers.byName))
+	for name := range handlers.byName {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
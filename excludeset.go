@@ -0,0 +1,134 @@
+package casefold
+
+import "strings"
+
+// excludeSet is a compiled list of exclude patterns. Patterns without glob
+// syntax are looked up in a map, "<literal>/**" prefixes and "<literal>/*"
+// children in a trie of path segments, "/**/*<literal>" suffixes are string
+// comparisons, and only the rest go through globMatch. Exact, prefix and
+// child matching thus cost O(path length) however many patterns there are.
+type excludeSet struct {
+	exact    map[string]string // key -> pattern
+	prefixes *prefixNode
+	suffixes []literalPattern
+	globs    []literalPattern
+	// key maps patterns and paths to the form they are compared in.
+	key func(string) string
+}
+
+// literalPattern pairs a pattern with the keyed literal (or, for globs, the
+// keyed pattern) it is matched by.
+type literalPattern struct {
+	pattern string
+	lit     string
+}
+
+// compileExcludes classifies patterns, which must be valid (see
+// validateExcludes). key, if non-nil, is applied to every pattern here and
+// to paths in match.
+func compileExcludes(patterns []string, key func(string) string) *excludeSet {
+	if key == nil {
+		key = func(s string) string { return s }
+	}
+	es := &excludeSet{exact: make(map[string]string), prefixes: new(prefixNode), key: key}
+	for _, p := range patterns {
+		if p == "" {
+			continue
+		}
+		k := key(p)
+		switch {
+		case isLiteral(k):
+			if _, ok := es.exact[k]; !ok {
+				es.exact[k] = p
+			}
+		case strings.HasSuffix(k, "/**") && isLiteral(k[:len(k)-3]):
+			if n := es.prefixes.node(k[:len(k)-3]); n.pattern == "" {
+				n.pattern = p
+			}
+		case strings.HasSuffix(k, "/*") && isLiteral(k[:len(k)-2]):
+			if n := es.prefixes.node(k[:len(k)-2]); n.child == "" {
+				n.child = p
+			}
+		case strings.HasPrefix(k, "/**/*") && isLiteral(k[5:]) && !strings.Contains(k[5:], "/"):
+			es.suffixes = append(es.suffixes, literalPattern{p, k[5:]})
+		default:
+			es.globs = append(es.globs, literalPattern{p, k})
+		}
+	}
+	return es
+}
+
+// match returns a pattern matching p, or "" if none does.
+func (es *excludeSet) match(p string) string {
+	p = es.key(p)
+	if pat, ok := es.exact[p]; ok {
+		return pat
+	}
+	if pat := es.prefixes.match(p); pat != "" {
+		return pat
+	}
+	if strings.HasPrefix(p, "/") {
+		for _, lp := range es.suffixes {
+			if strings.HasSuffix(p, lp.lit) {
+				return lp.pattern
+			}
+		}
+	}
+	for _, lp := range es.globs {
+		if globMatch(lp.lit, p) {
+			return lp.pattern
+		}
+	}
+	return ""
+}
+
+// prefixNode is a trie of path segments. A node's pattern is set when a
+// "<literal>/**" pattern ends there, covering the node's path and every
+// path below it, and its child when a "<literal>/*" pattern does, covering
+// the paths exactly one segment below it.
+type prefixNode struct {
+	pattern  string
+	child    string
+	children map[string]*prefixNode
+}
+
+// node returns the node for the prefix lit, adding it if needed.
+func (n *prefixNode) node(lit string) *prefixNode {
+	for _, seg := range strings.Split(lit, "/") {
+		child, ok := n.children[seg]
+		if !ok {
+			if n.children == nil {
+				n.children = make(map[string]*prefixNode)
+			}
+			child = new(prefixNode)
+			n.children[seg] = child
+		}
+		n = child
+	}
+	return n
+}
+
+// match returns the pattern of the shortest prefix of p, in whole segments,
+// or of the node p is one segment below, or "". As with path.Match, that
+// segment may be empty.
+func (n *prefixNode) match(p string) string {
+	for more := true; more; {
+		var seg string
+		seg, p, more = strings.Cut(p, "/")
+		if n = n.children[seg]; n == nil {
+			return ""
+		}
+		if n.pattern != "" {
+			return n.pattern
+		}
+		if more && n.child != "" && !strings.Contains(p, "/") {
+			return n.child
+		}
+	}
+	return ""
+}
+
+// isLiteral reports whether s contains no glob syntax.
+func isLiteral(s string) bool {
+	return !strings.ContainsAny(s, `*?[\`)
+}
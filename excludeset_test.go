@@ -0,0 +1,112 @@
+package casefold
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/caddyserver/caddy/v2"
+)
+
+func TestCompileExcludes(t *testing.T) {
+	es := compileExcludes([]string{"/Health", "/static/**", "/**/*.ZIP", "/api/*", "/**"}, nil)
+	if len(es.exact) != 1 || len(es.prefixes.children) != 1 || len(es.suffixes) != 1 || len(es.globs) != 0 {
+		t.Fatalf("unexpected classification: %d exact, %d prefix roots, %d suffixes, %d globs",
+			len(es.exact), len(es.prefixes.children), len(es.suffixes), len(es.globs))
+	}
+	if got := es.match("/anything/Else"); got != "/**" {
+		t.Errorf("expected /** to cover every path, got %q", got)
+	}
+
+	es = compileExcludes([]string{"/Health", "/static/**", "/**/*.ZIP", "/api/*", "/docs/v?/*", ""}, nil)
+	if len(es.globs) != 1 {
+		t.Fatalf("expected only /docs/v?/* to stay a glob, got %d globs", len(es.globs))
+	}
+	for _, tc := range []struct{ path, want string }{
+		{"/Health", "/Health"},
+		{"/health", ""},
+		{"/static", "/static/**"},
+		{"/static/css/Site.css", "/static/**"},
+		{"/staticfiles", ""},
+		{"/a/b/Media.ZIP", "/**/*.ZIP"},
+		{"/api/Items", "/api/*"},
+		{"/api/v1/Items", ""},
+		{"/api/", "/api/*"},
+		{"/api", ""},
+		{"/docs/v2/Intro", "/docs/v?/*"},
+	} {
+		if got := es.match(tc.path); got != tc.want {
+			t.Errorf("match(%q) = %q, want %q", tc.path, got, tc.want)
+		}
+	}
+
+	folded := compileExcludes([]string{"/API/**"}, strings.ToLower)
+	if got := folded.match("/api/Items"); got != "/API/**" {
+		t.Errorf("expected keyed match to report the original pattern, got %q", got)
+	}
+}
+
+func TestInvalidExcludeFailsProvision(t *testing.T) {
+	c := &Casefold{Exclude: []string{"/ok/*", "/bad/[a-"}}
+	if err := c.Provision(caddy.Context{}); err == nil {
+		t.Fatal("expected malformed exclude pattern to fail provisioning")
+	}
+}
+
+func TestChildTrie(t *testing.T) {
+	patterns := make([]string, 0, 5000)
+	for i := range 5000 {
+		patterns = append(patterns, fmt.Sprintf("/api/v%d/*", i))
+	}
+	patterns = append(patterns, "/api/v7/Admin/**", "/*")
+	es := compileExcludes(patterns, nil)
+	if len(es.globs) != 0 {
+		t.Fatalf("expected every pattern in the trie, got %d globs", len(es.globs))
+	}
+	for _, tc := range []struct{ path, want string }{
+		{"/api/v4999/CaseSensitive", "/api/v4999/*"},
+		{"/api/v7/Admin", "/api/v7/*"},
+		{"/api/v7/Admin/Users", "/api/v7/Admin/**"},
+		{"/api/v1/a/b", ""},
+		{"/api/v5000/a", ""},
+		{"/Top", "/*"},
+		{"/api", "/*"},
+	} {
+		if got, want := es.match(tc.path), tc.want; got != want {
+			t.Errorf("match(%q) = %q, want %q", tc.path, got, want)
+		}
+		// the trie must agree with plain glob matching
+		var glob string
+		for _, p := range patterns {
+			if globMatch(p, tc.path) {
+				glob = p
+				break
+			}
+		}
+		if (glob == "") != (tc.want == "") {
+			t.Errorf("globMatch disagrees on %q: %q", tc.path, glob)
+		}
+	}
+}
+
+func TestPrefixTrie(t *testing.T) {
+	patterns := make([]string, 0, 5000)
+	for i := range 5000 {
+		patterns = append(patterns, fmt.Sprintf("/tenants/t%d/**", i))
+	}
+	patterns = append(patterns, "/tenants/t1/Deep/**")
+	es := compileExcludes(patterns, nil)
+	for _, tc := range []struct{ path, want string }{
+		{"/tenants/t4999", "/tenants/t4999/**"},
+		{"/tenants/t1/Deep/File", "/tenants/t1/**"}, // shortest prefix wins
+		{"/tenants/t42/a/b/c", "/tenants/t42/**"},
+		{"/tenants/t5000/a", ""},
+		{"/tenants/t4", "/tenants/t4/**"},
+		{"/tenants/t4x", ""},
+		{"/tenants", ""},
+	} {
+		if got := es.match(tc.path); got != tc.want {
+			t.Errorf("match(%q) = %q, want %q", tc.path, got, tc.want)
+		}
+	}
+}
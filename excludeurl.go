@@ -0,0 +1,132 @@
+package casefold
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// defaultExcludeURLInterval is how often exclude_url is polled by default.
+const defaultExcludeURLInterval = 5 * time.Minute
+
+// excludeURLStartupWait is how long provisioning waits for the first fetch
+// before going on without its patterns.
+var excludeURLStartupWait = 2 * time.Second
+
+// excludeURL polls an HTTP(S) endpoint serving exclude patterns in the
+// exclude_file format and keeps them loaded into an excludeList. Requests
+// are conditional on the last ETag, so an unchanged list costs a 304. Failed
+// fetches are logged and the previous patterns stay in effect.
+type excludeURL struct {
+	url      string
+	interval time.Duration
+	list     *excludeList
+	client   *http.Client
+	etag     string
+	// ctx ends polling and aborts a fetch in flight on Close.
+	ctx    context.Context
+	cancel context.CancelFunc
+	done   chan struct{}
+	log    *zap.Logger
+}
+
+// newExcludeURL fetches rawURL once and then polls it every interval until
+// Close. The first fetch runs in the background and is waited for only
+// excludeURLStartupWait, so a slow endpoint does not hold up config loads.
+// An unreachable or slow endpoint at startup is only logged: patterns are
+// applied once a fetch succeeds.
+func newExcludeURL(rawURL string, interval time.Duration, list *excludeList, log *zap.Logger) (*excludeURL, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf("invalid exclude_url %q: must be an absolute http or https URL", rawURL)
+	}
+	if interval < 0 {
+		return nil, fmt.Errorf("invalid exclude_url_interval %s: must not be negative", interval)
+	}
+	if interval == 0 {
+		interval = defaultExcludeURLInterval
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	eu := &excludeURL{
+		url:      rawURL,
+		interval: interval,
+		list:     list,
+		client:   &http.Client{Timeout: 30 * time.Second},
+		ctx:      ctx,
+		cancel:   cancel,
+		done:     make(chan struct{}),
+		log:      log,
+	}
+	ready := make(chan struct{})
+	go eu.poll(ready)
+	select {
+	case <-ready:
+	case <-time.After(excludeURLStartupWait):
+		log.Warn("casefold exclude_url is slow to answer; starting without its patterns", zap.String("url", rawURL), zap.Duration("waited", excludeURLStartupWait))
+	}
+	return eu, nil
+}
+
+// poll fetches the list, closes ready, and fetches it again every interval.
+func (eu *excludeURL) poll(ready chan<- struct{}) {
+	defer close(eu.done)
+	if err := eu.fetch(); err != nil && eu.ctx.Err() == nil {
+		eu.log.Warn("casefold exclude_url fetch failed; will retry", zap.String("url", eu.url), zap.Error(err))
+	}
+	close(ready)
+	t := time.NewTicker(eu.interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-eu.ctx.Done():
+			return
+		case <-t.C:
+			if err := eu.fetch(); err != nil && eu.ctx.Err() == nil {
+				eu.log.Error("casefold exclude_url fetch failed; keeping previous patterns", zap.String("url", eu.url), zap.Error(err))
+			}
+		}
+	}
+}
+
+// fetch downloads the pattern list unless it is unchanged since the last
+// successful fetch.
+func (eu *excludeURL) fetch() error {
+	req, err := http.NewRequestWithContext(eu.ctx, http.MethodGet, eu.url, nil)
+	if err != nil {
+		return err
+	}
+	if eu.etag != "" {
+		req.Header.Set("If-None-Match", eu.etag)
+	}
+	resp, err := eu.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	switch resp.StatusCode {
+	case http.StatusNotModified:
+		return nil
+	case http.StatusOK:
+	default:
+		return fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	patterns, err := parseExcludePatterns(resp.Body)
+	if err != nil {
+		return fmt.Errorf("parsing exclude patterns: %v", err)
+	}
+	eu.list.SetSource(eu.url, patterns)
+	eu.etag = resp.Header.Get("ETag")
+	eu.log.Info("casefold exclude_url loaded", zap.String("url", eu.url), zap.Int("patterns", len(patterns)))
+	return nil
+}
+
+// Close stops polling, aborting a fetch in flight.
+func (eu *excludeURL) Close() error {
+	eu.cancel()
+	<-eu.done
+	return nil
+}
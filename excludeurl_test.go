@@ -0,0 +1,130 @@
+package casefold
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/caddyserver/caddy/v2"
+)
+
+func TestExcludeURLPolling(t *testing.T) {
+	var (
+		mu          sync.Mutex
+		body        = "/Api/*\n"
+		etag        = `"v1"`
+		notModified int
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		if r.Header.Get("If-None-Match") == etag {
+			notModified++
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("ETag", etag)
+		_, _ = w.Write([]byte(body))
+	}))
+	defer srv.Close()
+
+	c := &Casefold{ExcludeURL: srv.URL, ExcludeURLInterval: caddy.Duration(10 * time.Millisecond)}
+	if err := c.Provision(caddy.Context{}); err != nil {
+		t.Fatal(err)
+	}
+	defer c.Cleanup()
+	if want := []string{"/Api/*"}; !reflect.DeepEqual(c.excludes.All(), want) {
+		t.Fatalf("expected %v after initial fetch, got %v", want, c.excludes.All())
+	}
+
+	waitFor := func(cond func() bool) bool {
+		deadline := time.Now().Add(2 * time.Second)
+		for !cond() && time.Now().Before(deadline) {
+			time.Sleep(5 * time.Millisecond)
+		}
+		return cond()
+	}
+	if !waitFor(func() bool { mu.Lock(); defer mu.Unlock(); return notModified > 0 }) {
+		t.Fatal("expected conditional polls to get 304 Not Modified")
+	}
+
+	mu.Lock()
+	body, etag = "/Media/*\n", `"v2"`
+	mu.Unlock()
+	if !waitFor(func() bool { return reflect.DeepEqual(c.excludes.All(), []string{"/Media/*"}) }) {
+		t.Fatalf("expected updated patterns, got %v", c.excludes.All())
+	}
+
+	mu.Lock()
+	body, etag = "[a-\n", `"v3"`
+	mu.Unlock()
+	time.Sleep(50 * time.Millisecond)
+	if want := []string{"/Media/*"}; !reflect.DeepEqual(c.excludes.All(), want) {
+		t.Fatalf("expected %v after a broken update, got %v", want, c.excludes.All())
+	}
+}
+
+func TestExcludeURLSlowAtStartup(t *testing.T) {
+	release := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-release:
+			_, _ = w.Write([]byte("/Api/*\n"))
+		}
+	}))
+	defer srv.Close()
+	defer func(wait time.Duration) { excludeURLStartupWait = wait }(excludeURLStartupWait)
+	excludeURLStartupWait = 20 * time.Millisecond
+
+	started := time.Now()
+	c := &Casefold{ExcludeURL: srv.URL}
+	if err := c.Provision(caddy.Context{}); err != nil {
+		t.Fatal(err)
+	}
+	if took := time.Since(started); took > time.Second {
+		t.Fatalf("expected provisioning not to wait for a slow endpoint, took %s", took)
+	}
+	if got := c.excludes.All(); len(got) != 0 {
+		t.Fatalf("expected no patterns before the fetch completes, got %v", got)
+	}
+	close(release)
+	deadline := time.Now().Add(2 * time.Second)
+	for !reflect.DeepEqual(c.excludes.All(), []string{"/Api/*"}) && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	if want := []string{"/Api/*"}; !reflect.DeepEqual(c.excludes.All(), want) {
+		t.Fatalf("expected %v once the endpoint answered, got %v", want, c.excludes.All())
+	}
+	if err := c.Cleanup(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Cleanup aborts a fetch that never answers
+	hang := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { <-r.Context().Done() }))
+	defer hang.Close()
+	c = &Casefold{ExcludeURL: hang.URL}
+	if err := c.Provision(caddy.Context{}); err != nil {
+		t.Fatal(err)
+	}
+	started = time.Now()
+	if err := c.Cleanup(); err != nil {
+		t.Fatal(err)
+	}
+	if took := time.Since(started); took > time.Second {
+		t.Errorf("expected cleanup to abort the fetch, took %s", took)
+	}
+}
+
+func TestExcludeURLInvalid(t *testing.T) {
+	for _, u := range []string{"ftp://example.com/excludes", "/excludes.txt", "http://"} {
+		c := &Casefold{ExcludeURL: u}
+		if err := c.Provision(caddy.Context{}); err == nil {
+			t.Errorf("expected %q to fail provisioning", u)
+			_ = c.Cleanup()
+		}
+	}
+}
@@ -0,0 +1,45 @@
+package casefold
+
+import (
+	"errors"
+	"fmt"
+
+	"golang.org/x/text/cases"
+)
+
+// Fallback policies for paths fs mode cannot resolve.
+const (
+	fallbackNone     = "none"
+	fallbackLower    = "lower"
+	fallbackFold     = "fold"
+	fallbackNotFound = "not_found"
+)
+
+// errFSNotFound fails requests under fallback not_found.
+var errFSNotFound = errors.New("path does not resolve on disk")
+
+// provisionFallback validates Fallback and prepares its caser.
+func (c *Casefold) provisionFallback() error {
+	switch c.Fallback {
+	case "", fallbackNone, fallbackNotFound:
+	case fallbackLower:
+		c.fallbackCaser = c.replace.wrap(lowerCaser{})
+	case fallbackFold:
+		c.fallbackCaser = c.replace.wrap(cases.Fold())
+	default:
+		return fmt.Errorf("invalid fallback %q: must be none, lower, fold or not_found", c.Fallback)
+	}
+	return nil
+}
+
+// fsFallback applies Fallback to p, which fs mode could not resolve. Hidden
+// paths are never rewritten, so a fallback cannot expose their casing.
+func (c *Casefold) fsFallback(p string) (string, bool, error) {
+	switch {
+	case c.Fallback == fallbackNotFound:
+		return p, false, errFSNotFound
+	case c.fallbackCaser != nil && !c.hidden(p):
+		return c.fallbackCaser.String(c.norm.String(p)), true, nil
+	}
+	return p, false, nil
+}
@@ -0,0 +1,60 @@
+package casefold
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/caddyserver/caddy/v2"
+	"github.com/caddyserver/caddy/v2/modules/caddyhttp"
+)
+
+func TestFallback(t *testing.T) {
+	root := t.TempDir()
+	if err := os.WriteFile(filepath.Join(root, "Index.HTML"), nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	serve := func(fallback, p string) (string, error) {
+		t.Helper()
+		c := &Casefold{Mode: "fs", Root: root, Fallback: fallback}
+		if err := c.Provision(caddy.Context{}); err != nil {
+			t.Fatal(err)
+		}
+		defer c.Cleanup()
+		rr := httptest.NewRecorder()
+		err := c.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, p, nil), recordHandler{t})
+		return rr.Header().Get("X-Final-Path"), err
+	}
+	for _, tc := range []struct{ fallback, path, want string }{
+		{"", "/Missing/Page.HTML", "/Missing/Page.HTML"},
+		{"none", "/Missing/Page.HTML", "/Missing/Page.HTML"},
+		{"lower", "/Missing/Page.HTML", "/missing/page.html"},
+		{"fold", "/Missing/STRASSE", "/missing/strasse"},
+		{"lower", "/index.html", "/Index.HTML"},
+		{"lower", "/.GIT/Config", "/.GIT/Config"}, // hidden paths keep their casing
+	} {
+		got, err := serve(tc.fallback, tc.path)
+		if err != nil {
+			t.Fatalf("%s %s: %v", tc.fallback, tc.path, err)
+		}
+		if got != tc.want {
+			t.Errorf("fallback %q, %s: expected %s, got %s", tc.fallback, tc.path, tc.want, got)
+		}
+	}
+
+	_, err := serve("not_found", "/Missing")
+	var herr caddyhttp.HandlerError
+	if !errors.As(err, &herr) || herr.StatusCode != http.StatusNotFound {
+		t.Errorf("not_found: expected 404, got %v", err)
+	}
+	if got, err := serve("not_found", "/INDEX.html"); err != nil || got != "/Index.HTML" {
+		t.Errorf("not_found: existing path got %q %v", got, err)
+	}
+
+	if err := (&Casefold{Mode: "fs", Fallback: "upper"}).Provision(caddy.Context{}); err == nil {
+		t.Error("invalid fallback accepted")
+	}
+}
@@ -0,0 +1,67 @@
+package casefold
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"unicode"
+)
+
+// detectCaseInsensitive reports whether the local filesystem holding root
+// ignores case, as NTFS and default APFS volumes do. It creates a
+// mixed-case probe file in root and stats its swapped-case name; if root is
+// not writable it tries an existing entry instead. ok is false when neither
+// probe was possible.
+func detectCaseInsensitive(root string) (insensitive, ok bool) {
+	if f, err := os.CreateTemp(root, ".casefold-Probe-*"); err == nil {
+		name := f.Name()
+		_ = f.Close()
+		defer os.Remove(name)
+		return statsSwapped(root, filepath.Base(name)), true
+	}
+	entries, err := os.ReadDir(root)
+	if err != nil {
+		return false, false
+	}
+	for _, e := range entries {
+		if swapCase(e.Name()) != e.Name() {
+			return statsSwapped(root, e.Name()), true
+		}
+	}
+	return false, false
+}
+
+// statsSwapped reports whether name, with its case swapped, resolves to the
+// same entry of dir.
+func statsSwapped(dir, name string) bool {
+	orig, err := os.Stat(filepath.Join(dir, name))
+	if err != nil {
+		return false
+	}
+	swapped, err := os.Stat(filepath.Join(dir, swapCase(name)))
+	if err != nil {
+		return false
+	}
+	return os.SameFile(orig, swapped)
+}
+
+func swapCase(s string) string {
+	return strings.Map(func(r rune) rune {
+		if unicode.IsUpper(r) {
+			return unicode.ToLower(r)
+		}
+		return unicode.ToUpper(r)
+	}, s)
+}
+
+// statDisk is resolveDisk on a case-insensitive filesystem: one Stat tells
+// whether p resolves at all, and the filesystem serves it in any casing, so
+// p is kept as given. It is not cacheable, since the first casing seen is
+// not canonical.
+func (c *Casefold) statDisk(clean string) fsResult {
+	if _, err := fs.Stat(c.fsys, fsPath(clean)); err != nil {
+		return fsResult{canon: clean}
+	}
+	return fsResult{canon: clean, ok: true}
+}
@@ -0,0 +1,58 @@
+package casefold
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/caddyserver/caddy/v2"
+)
+
+func TestDetectCaseInsensitive(t *testing.T) {
+	root := t.TempDir()
+	insensitive, ok := detectCaseInsensitive(root)
+	if !ok {
+		t.Fatal("expected a writable root to be probed")
+	}
+	// the probe must agree with what the filesystem actually does
+	if err := os.WriteFile(filepath.Join(root, "Probe.txt"), nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	_, err := os.Stat(filepath.Join(root, "pROBE.TXT"))
+	if want := err == nil; insensitive != want {
+		t.Fatalf("detected case-insensitive=%v, but swapped-case stat succeeded=%v", insensitive, want)
+	}
+	entries, _ := os.ReadDir(root)
+	if len(entries) != 1 {
+		t.Fatalf("expected the probe file to be removed, got %d entries", len(entries))
+	}
+}
+
+func TestCaseInsensitiveStatResolution(t *testing.T) {
+	root := t.TempDir()
+	if err := os.WriteFile(filepath.Join(root, "ReadMe.md"), nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	for _, full := range []bool{false, true} {
+		c := &Casefold{Mode: "fs", Root: root, FullResolve: full}
+		if err := c.Provision(caddy.Context{}); err != nil {
+			t.Fatal(err)
+		}
+		// pretend the probe found a case-insensitive volume
+		c.state.caseInsensitive = true
+		if got, ok, _ := c.canonicalFS("/ReadMe.md"); !ok || got != "/ReadMe.md" {
+			t.Errorf("full_resolve %v: expected existing path resolved as given, got %q %v", full, got, ok)
+		}
+		if _, ok, _ := c.canonicalFS("/Missing.md"); ok {
+			t.Errorf("full_resolve %v: expected missing path to fail", full)
+		}
+		got, ok, _ := c.canonicalFS("/readme.MD")
+		if full && (!ok || got != "/ReadMe.md") {
+			t.Errorf("expected full_resolve to scan directories, got %q %v", got, ok)
+		}
+		if !full && got != "/readme.MD" {
+			t.Errorf("expected stat strategy to keep the request casing, got %q", got)
+		}
+		_ = c.Cleanup()
+	}
+}
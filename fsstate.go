@@ -0,0 +1,250 @@
+package casefold
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"reflect"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/caddyserver/caddy/v2"
+	"go.uber.org/zap"
+	"golang.org/x/sync/singleflight"
+)
+
+// fsStates shares fs-mode resources between handler instances, so the
+// resolution cache, preloaded index and watcher for a root survive graceful
+// config reloads instead of being rebuilt from scratch.
+var fsStates = caddy.NewUsagePool()
+
+// fsState holds the fs-mode resources for one root. It is shared by every
+// handler configured with the same root, cache, ambiguity and resolution
+// limit settings.
+type fsState struct {
+	// root is the rootID the state was built for.
+	root string
+	fsys fs.FS
+	// norm is the Unicode normalization applied to cache and index keys.
+	norm    normalizer
+	cache   *resolutionCache
+	dirs    *dirCache
+	index   *pathIndex
+	watcher *rootWatcher
+	// flight coalesces concurrent disk resolutions of the same path.
+	flight singleflight.Group
+	// caseInsensitive records that the root's filesystem ignores case.
+	caseInsensitive bool
+	// stopReindex ends the periodic rebuild of index, if one runs.
+	stopReindex chan struct{}
+	// log, indexFile, indexStamp and workers are the settings of the
+	// handler that built the state, kept for the rebuild, which outlives
+	// that handler across reloads.
+	log        *zap.Logger
+	indexFile  string
+	indexStamp string
+	workers    int
+}
+
+// fsStateKey identifies the shared state a handler uses. Settings that shape
+// the state are part of the key so differently configured handlers on the
+// same root never share incompatible resources. The Ambiguity policy is one
+// of them: cached resolutions are the choices it made, and a handler with
+// another policy must not be answered from them. The resolution limits and
+// FullResolve are others, so a stricter handler never reuses walks a looser
+// one was allowed to make.
+func (c *Casefold) fsStateKey() string {
+	return fmt.Sprintf("%s|cache=%d/%s/%s|dirs=%d|preload=%t|index=%s@%s|reindex=%s|watch=%t|norm=%s|ambiguity=%s|limits=%d/%d/%s|full=%t",
+		c.rootID(), c.CacheSize, time.Duration(c.CacheTTL), time.Duration(c.NegativeCacheTTL), c.DirCacheSize, c.Preload, c.IndexFile, c.IndexStamp, time.Duration(c.ReindexInterval), c.Watch, c.norm, c.Ambiguity,
+		c.maxSegments(), c.MaxDirEntries, time.Duration(c.ResolveTimeout), c.FullResolve)
+}
+
+// rootID names the tree fs mode resolves against: Root on the local disk,
+// or Root within the named FileSystem or the injected FS.
+func (c *Casefold) rootID() string {
+	if c.fsID != "" {
+		return c.fsID + ":" + c.Root
+	}
+	if c.FileSystem != "" {
+		return c.FileSystem + ":" + c.Root
+	}
+	return c.Root
+}
+
+// onLocalDisk reports whether fs mode resolves against the local disk
+// rather than a FileSystem or an injected FS.
+func (c *Casefold) onLocalDisk() bool {
+	return c.FileSystem == "" && c.FS == nil
+}
+
+// fsIdentities numbers injected filesystems that cannot be told apart by
+// address.
+var fsIdentities atomic.Int64
+
+// fsIdentity names an injected FS in state keys: by address for reference
+// types, so handlers given the same filesystem share state, and by a fresh
+// number otherwise.
+func fsIdentity(fsys fs.FS) string {
+	switch v := reflect.ValueOf(fsys); v.Kind() {
+	case reflect.Pointer, reflect.Map, reflect.Func, reflect.Chan, reflect.UnsafePointer:
+		return fmt.Sprintf("%T@%x", fsys, v.Pointer())
+	}
+	return fmt.Sprintf("%T#%d", fsys, fsIdentities.Add(1))
+}
+
+// newFSState builds the resources configured on c for c.fsys.
+func (c *Casefold) newFSState() (*fsState, error) {
+	st := &fsState{root: c.rootID(), fsys: c.fsys, norm: c.norm, log: c.log,
+		indexFile: c.IndexFile, indexStamp: c.IndexStamp, workers: c.preloadWorkers()}
+	if c.onLocalDisk() {
+		insensitive, ok := detectCaseInsensitive(c.Root)
+		st.caseInsensitive = insensitive
+		if insensitive {
+			c.log.Info("casefold detected a case-insensitive filesystem", zap.String("root", c.Root), zap.Bool("full_resolve", c.FullResolve))
+		} else if !ok {
+			c.log.Debug("casefold could not probe root for case sensitivity; assuming case-sensitive", zap.String("root", c.Root))
+		}
+	}
+	if c.CacheSize > 0 {
+		st.cache = newResolutionCache(c.CacheSize, time.Duration(c.CacheTTL))
+	}
+	if c.DirCacheSize > 0 {
+		st.dirs = newDirCache(c.DirCacheSize)
+	}
+	if c.Preload {
+		idx, err := c.preloadIndex()
+		if err != nil {
+			return nil, err
+		}
+		st.index = idx
+		c.reportCollisions(idx)
+		if c.ReindexInterval > 0 {
+			st.stopReindex = make(chan struct{})
+			go st.reindexLoop(time.Duration(c.ReindexInterval), st.stopReindex)
+		}
+	}
+	if c.Watch {
+		if st.cache == nil && st.index == nil {
+			c.log.Warn("casefold watch requires cache_size or preload; not watching")
+		} else if !c.onLocalDisk() {
+			c.log.Warn("casefold watch is only supported on the local filesystem; not watching", zap.String("root", c.rootID()))
+		} else {
+			w, err := newRootWatcher(c.Root, c.log, st.changed)
+			if err != nil {
+				return nil, fmt.Errorf("watching root %s: %v", c.Root, err)
+			}
+			st.watcher = w
+		}
+	}
+	return st, nil
+}
+
+// preloadIndex loads the fs index from IndexFile when a fresh snapshot
+// exists, and otherwise walks Root (saving a new snapshot if configured).
+func (c *Casefold) preloadIndex() (*pathIndex, error) {
+	if c.IndexFile != "" {
+		idx, err := loadSnapshot(c.IndexFile, c.fsys, c.rootID(), c.IndexStamp, c.norm)
+		if err == nil {
+			c.log.Info("casefold loaded fs index snapshot", zap.String("root", c.rootID()), zap.String("file", c.IndexFile), zap.Int("paths", idx.Len()))
+			return idx, nil
+		}
+		if !errors.Is(err, fs.ErrNotExist) {
+			c.log.Info("casefold ignoring fs index snapshot", zap.String("file", c.IndexFile), zap.Error(err))
+		}
+	}
+	started := time.Now()
+	var found atomic.Int64
+	stop := make(chan struct{})
+	go c.logPreloadProgress(&found, started, stop)
+	idx, err := buildIndexParallel(c.fsys, c.norm, c.preloadWorkers(), &found)
+	close(stop)
+	if err != nil {
+		return nil, fmt.Errorf("preloading root %s: %v", c.rootID(), err)
+	}
+	c.log.Info("casefold preloaded fs index", zap.String("root", c.rootID()), zap.Int("paths", idx.Len()), zap.Duration("took", time.Since(started)))
+	if c.IndexFile != "" {
+		if err := saveSnapshot(c.IndexFile, c.rootID(), c.IndexStamp, started, idx); err != nil {
+			c.log.Warn("casefold failed to save fs index snapshot", zap.String("file", c.IndexFile), zap.Error(err))
+		}
+	}
+	return idx, nil
+}
+
+// preloadProgressInterval is how often a running preload logs progress.
+var preloadProgressInterval = 10 * time.Second
+
+// logPreloadProgress logs how many entries a preload has found every
+// preloadProgressInterval until stop is closed.
+func (c *Casefold) logPreloadProgress(found *atomic.Int64, started time.Time, stop <-chan struct{}) {
+	t := time.NewTicker(preloadProgressInterval)
+	defer t.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-t.C:
+			c.log.Info("casefold preloading fs index", zap.String("root", c.rootID()), zap.Int64("paths", found.Load()), zap.Duration("elapsed", time.Since(started)))
+		}
+	}
+}
+
+// collisionReportLimit caps how many collisions the startup report lists.
+const collisionReportLimit = 10
+
+// reportCollisions logs a summary of the case collisions in a freshly
+// preloaded index, and emits an event for each of them, so colliding names
+// are noticed at startup rather than when a request hits one.
+func (c *Casefold) reportCollisions(idx *pathIndex) {
+	conflicts := idx.Conflicts()
+	if len(conflicts) == 0 {
+		return
+	}
+	keys := make([]string, 0, len(conflicts))
+	for key := range conflicts {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		c.emitConflict(key, conflicts[key])
+	}
+	shown := keys
+	if len(shown) > collisionReportLimit {
+		shown = shown[:collisionReportLimit]
+	}
+	offenders := make([]string, 0, len(shown))
+	for _, key := range shown {
+		offenders = append(offenders, strings.Join(conflicts[key], " | "))
+	}
+	c.log.Warn("casefold found case collisions in root; only one candidate of each is reachable by case-insensitive requests",
+		zap.String("root", c.rootID()),
+		zap.Int("count", len(keys)),
+		zap.Strings("first", offenders))
+}
+
+// changed is the watcher callback: it drops cached resolutions at or below
+// rel and refreshes the preloaded index.
+func (st *fsState) changed(rel string) {
+	if st.cache != nil {
+		st.cache.Invalidate(st.norm.fold(rel))
+	}
+	if st.index != nil {
+		st.index.Refresh(st.fsys, rel)
+	}
+}
+
+// Destruct implements caddy.Destructor; it runs once the last handler using
+// this state has been cleaned up.
+func (st *fsState) Destruct() error {
+	if st.stopReindex != nil {
+		close(st.stopReindex)
+	}
+	if st.watcher != nil {
+		return st.watcher.Close()
+	}
+	return nil
+}
+
+// Interface guard
+var _ caddy.Destructor = (*fsState)(nil)
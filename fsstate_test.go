@@ -0,0 +1,83 @@
+package casefold
+
+import (
+	"fmt"
+	"testing"
+	"testing/fstest"
+
+	"github.com/caddyserver/caddy/v2"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+func TestFSStateSharedAcrossReloads(t *testing.T) {
+	root := t.TempDir()
+	oldCfg := &Casefold{Mode: "fs", Root: root, CacheSize: 16}
+	if err := oldCfg.Provision(caddy.Context{}); err != nil {
+		t.Fatal(err)
+	}
+	oldCfg.state.cache.Put("/warm", "/Warm")
+
+	// a reload provisions the new handler before cleaning up the old one
+	newCfg := &Casefold{Mode: "fs", Root: root, CacheSize: 16}
+	if err := newCfg.Provision(caddy.Context{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := oldCfg.Cleanup(); err != nil {
+		t.Fatal(err)
+	}
+	if newCfg.state != oldCfg.state {
+		t.Fatal("expected state to be shared between identical configs")
+	}
+	if _, ok := newCfg.state.cache.Get("/warm"); !ok {
+		t.Fatal("expected warm cache entry to survive the reload")
+	}
+
+	other := &Casefold{Mode: "fs", Root: root, CacheSize: 32}
+	if err := other.Provision(caddy.Context{}); err != nil {
+		t.Fatal(err)
+	}
+	defer other.Cleanup()
+	if other.state == newCfg.state {
+		t.Fatal("expected differently sized cache not to share state")
+	}
+
+	if err := newCfg.Cleanup(); err != nil {
+		t.Fatal(err)
+	}
+	if refs, ok := fsStates.References(newCfg.stateKey); ok || refs != 0 {
+		t.Fatalf("expected state to be released, got %d references", refs)
+	}
+}
+
+func TestReportCollisions(t *testing.T) {
+	fsys := fstest.MapFS{"README.md": &fstest.MapFile{}, "Readme.md": &fstest.MapFile{}}
+	for i := 0; i < collisionReportLimit+2; i++ {
+		fsys[fmt.Sprintf("dir%02d/A", i)] = &fstest.MapFile{}
+		fsys[fmt.Sprintf("dir%02d/a", i)] = &fstest.MapFile{}
+	}
+	idx, err := buildIndex(fsys, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	core, logs := observer.New(zapcore.WarnLevel)
+	em := new(fakeEmitter)
+	c := &Casefold{Root: "/srv", log: zap.New(core), events: em}
+	c.reportCollisions(idx)
+
+	if logs.Len() != 1 {
+		t.Fatalf("expected one report entry, got %d", logs.Len())
+	}
+	fields := logs.All()[0].ContextMap()
+	if fields["count"] != int64(collisionReportLimit+3) {
+		t.Fatalf("expected count %d, got %v", collisionReportLimit+3, fields["count"])
+	}
+	first := fields["first"].([]any)
+	if len(first) != collisionReportLimit || first[0] != "/dir00/A | /dir00/a" {
+		t.Fatalf("unexpected offenders: %v", first)
+	}
+	if len(em.events) != collisionReportLimit+3 {
+		t.Fatalf("expected an event per collision, got %d", len(em.events))
+	}
+}
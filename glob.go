@@ -0,0 +1,46 @@
+package casefold
+
+import (
+	"path"
+	"strings"
+)
+
+// globMatch reports whether name matches pattern. Patterns use path.Match
+// syntax, extended with "**": a path segment consisting of just "**"
+// matches zero or more whole segments, so "/static/**" matches /static and
+// everything below it and "/**/*.zip" matches a .zip file at any depth.
+// Malformed patterns never match; see validateExcludes.
+func globMatch(pattern, name string) bool {
+	if !strings.Contains(pattern, "**") {
+		ok, _ := path.Match(pattern, name)
+		return ok
+	}
+	return matchSegments(strings.Split(pattern, "/"), strings.Split(name, "/"))
+}
+
+func matchSegments(pat, segs []string) bool {
+	for len(pat) > 0 {
+		if pat[0] == "**" {
+			for len(pat) > 1 && pat[1] == "**" {
+				pat = pat[1:]
+			}
+			if len(pat) == 1 {
+				return true
+			}
+			for i := 0; i <= len(segs); i++ {
+				if matchSegments(pat[1:], segs[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+		if len(segs) == 0 {
+			return false
+		}
+		if ok, _ := path.Match(pat[0], segs[0]); !ok {
+			return false
+		}
+		pat, segs = pat[1:], segs[1:]
+	}
+	return len(segs) == 0
+}
@@ -0,0 +1,29 @@
+package casefold
+
+import "testing"
+
+func TestGlobMatch(t *testing.T) {
+	for _, tc := range []struct {
+		pattern, name string
+		want          bool
+	}{
+		{"/api/*", "/api/Items", true},
+		{"/api/*", "/api/v1/Items", false},
+		{"/static/**", "/static", true},
+		{"/static/**", "/static/css/Site.CSS", true},
+		{"/static/**", "/Static/css", false},
+		{"/static/**", "/staticfiles/x", false},
+		{"/**/*.ZIP", "/Media.ZIP", true},
+		{"/**/*.ZIP", "/a/b/c/Media.ZIP", true},
+		{"/**/*.ZIP", "/a/b/Media.zip", false},
+		{"/docs/**/Intro.html", "/docs/Intro.html", true},
+		{"/docs/**/Intro.html", "/docs/v1/guide/Intro.html", true},
+		{"/docs/**/**/Intro.html", "/docs/v1/Intro.html", true},
+		{"/a**b", "/axxb", true}, // not a whole segment: plain path.Match
+		{"/[a-/**", "/x/y", false},
+	} {
+		if got := globMatch(tc.pattern, tc.name); got != tc.want {
+			t.Errorf("globMatch(%q, %q) = %v, want %v", tc.pattern, tc.name, got, tc.want)
+		}
+	}
+}
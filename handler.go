@@ -1,11 +1,19 @@
 package casefold
 
 import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
 	"net/http"
+	"net/url"
 	"os"
 	"path"
 	"path/filepath"
+	"strconv"
 	"strings"
+	"time"
+	"unicode/utf8"
 
 	"github.com/caddyserver/caddy/v2"
 	"github.com/caddyserver/caddy/v2/caddyconfig/httpcaddyfile"
@@ -39,25 +47,553 @@ import (
 type Casefold struct {
 	// Mode selects the transformation applied to the path. Supported values:
 	//  - "lower" (default): simple ASCII + Unicode ToLower
+	//  - "upper": Unicode ToUpper, for content trees stored in upper case
+	//  - "title": capitalize each word of each segment (/About-Us/Our-Team)
 	//  - "fold": Unicode case folding (locale-independent)
+	//  - "ascii": strip diacritics and lowercase, so /Café matches /cafe
 	//  - "fs": canonicalize each existing path segment to the actual filesystem casing
+	//  - "resolver": ask the configured Resolver module for the canonical path
+	//  - "map": look the path up in MapFile (see MapResolver)
 	Mode string `json:"mode,omitempty"`
 
-	// Root is required for mode "fs" and denotes the filesystem root directory
-	// that request paths are resolved against for canonical casing. If empty
-	// when mode=fs, the middleware skips canonicalization.
+	// Strict makes Provision fail on settings it otherwise accepts with a
+	// warning: an unknown Mode (else treated as lower), a Locale fold mode
+	// ignores, and a Watch that cannot watch.
+	Strict bool `json:"strict,omitempty"`
+
+	// Transforms, when set, replaces Mode with an ordered list of steps, each
+	// applied to the previous step's output: any mode name, "nfc" and "nfd"
+	// (Unicode normalization), or the name of a transform module (see
+	// TransformModules), e.g. ["nfc", "fold", "fs"]. At most one
+	// case mapping step, one fs step and one resolver or map step may
+	// appear. A lookup step that cannot resolve the path leaves the request
+	// untouched.
+	Transforms []string `json:"transforms,omitempty"`
+
+	// Locale applies the case rules of a language (BCP 47 tag, e.g. "tr",
+	// "az", "el", "lt") in lower, upper, title and ascii modes, so Turkish dotted/dotless I and
+	// similar mappings are respected. By default the language-neutral
+	// Unicode mapping is used.
+	Locale string `json:"locale,omitempty"`
+
+	// AcceptLanguageLocales picks the lower/upper/title/ascii mode locale per request from the
+	// Accept-Language header, among the listed tags. Requests without a
+	// matching language use Locale (or the language-neutral mapping).
+	AcceptLanguageLocales []string `json:"accept_language_locales,omitempty"`
+
+	// Normalize applies a Unicode normalization form, "nfc" or "nfd", to the
+	// path before it is folded, and to directory entry names before fs mode
+	// compares them. macOS filesystems typically store NFD while clients
+	// send NFC, so accented names otherwise fail to match.
+	Normalize string `json:"normalize,omitempty"`
+
+	// Transliterate romanizes the letters of the listed scripts ("cyrillic",
+	// "greek") to ASCII before the path is transformed, in every mode, so
+	// /Москва and /moskva reach the same content.
+	Transliterate []string `json:"transliterate,omitempty"`
+
+	// MixedScripts guards against segments mixing lookalike scripts, such
+	// as a Cyrillic а in an otherwise Latin /pаypal: "block" fails them
+	// with 400, "log" logs a warning and carries on, and "fold" replaces
+	// their lookalike letters with the Latin ones (/paypal) before the path
+	// is transformed. Segments written in one script are left alone.
+	MixedScripts string `json:"mixed_scripts,omitempty"`
+
+	// CollapseSlashes turns runs of slashes into one (/a//b///c becomes
+	// /a/b/c) before the path is transformed. Encoded slashes (%2F) are
+	// left alone.
+	CollapseSlashes bool `json:"collapse_slashes,omitempty"`
+
+	// DotSegments decides what happens to "." and ".." segments: "keep"
+	// (the default) passes them through to the mode, "resolve" removes them
+	// as a browser would (/a/./b/../c becomes /a/c) before the path is
+	// transformed, and "reject" fails the request with 400. fs mode looks
+	// up the cleaned path either way.
+	DotSegments string `json:"dot_segments,omitempty"`
+
+	// TrailingSlash is "keep" (the default: the path ends in a slash if the
+	// request's did), "add" or "remove". With an fs step, add only applies
+	// to directories and remove only to files, matching what file_server
+	// redirects to, so a request is redirected at most once.
+	TrailingSlash string `json:"trailing_slash,omitempty"`
+
+	// Replace maps substrings to fixed replacements in the case modes,
+	// overriding or extending the caser: {"ß": "ß"} stops fold mode from
+	// expanding ß, {"Æ": "ae", "æ": "ae"} adds a slug convention. Keys are
+	// matched exactly as written, longest first, and their replacements are
+	// not case mapped further.
+	Replace map[string]string `json:"replace,omitempty"`
+
+	// Root is the filesystem root directory that fs mode resolves request
+	// paths against for canonical casing. If empty, the site root set by
+	// the root directive ({http.vars.root}) is used per request; requests
+	// without one are passed through. Global placeholders such as
+	// {env.SITE_ROOT} are expanded at provision; a root with request
+	// placeholders such as {http.vars.root} is expanded per request, with
+	// separate caches for each distinct value.
 	Root string `json:"root,omitempty"`
 
+	// FallbackRoots are further fs mode roots, tried in order when a path
+	// does not fully resolve under Root. They share Root's cache, preload,
+	// watch and ambiguity settings, and may use placeholders the same way.
+	FallbackRoots []string `json:"fallback_roots,omitempty"`
+
+	// FullResolve keeps the per-segment directory scan of fs mode on
+	// filesystems detected as case-insensitive (NTFS, default APFS). There,
+	// fs mode otherwise only stats the path: the filesystem serves it in any
+	// casing, so it is passed through unchanged when it exists. Set this to
+	// rewrite such paths to their on-disk casing anyway, e.g. for redirect.
+	FullResolve bool `json:"full_resolve,omitempty"`
+
+	// Hide lists files and directories fs mode never resolves to, like
+	// file_server's hide: a pattern without a slash is matched against each
+	// path segment (e.g. ".env", "*.bak"), one with a slash against the
+	// root-relative path and everything below it (e.g. "/private/*").
+	// Matching ignores case. Such requests pass through unchanged.
+	Hide []string `json:"hide,omitempty"`
+
+	// MaxSegments caps the number of path segments fs mode resolves
+	// against disk (default 64); deeper paths pass through unchanged.
+	// MaxDirEntries caps the entries read from any one directory, and
+	// ResolveTimeout the time spent on one resolution; both are unlimited
+	// by default. These bound the work a single request can cause.
+	MaxSegments    int            `json:"max_segments,omitempty"`
+	MaxDirEntries  int            `json:"max_dir_entries,omitempty"`
+	ResolveTimeout caddy.Duration `json:"resolve_timeout,omitempty"`
+
+	// MaxPathLength is the longest request path, in bytes, the handler
+	// transforms; longer paths pass through untouched, or are rejected with
+	// 414 URI Too Long if RejectLongPaths is set. 0 means no limit.
+	MaxPathLength   int  `json:"max_path_length,omitempty"`
+	RejectLongPaths bool `json:"reject_long_paths,omitempty"`
+
+	// RejectInvalidPaths fails requests whose decoded path holds a control
+	// character (NUL included) or is not valid UTF-8 with 400, before any
+	// transformation. Without it such paths are still never looked up in
+	// fs mode.
+	RejectInvalidPaths bool `json:"reject_invalid_paths,omitempty"`
+
+	// ReservedNames guards against Windows device names (CON, NUL, COM1,
+	// LPT1 and the rest, with or without an extension), which Windows and
+	// SMB shares resolve in every directory: "skip" leaves paths holding
+	// one unresolved in fs mode, "reject" fails them with 400.
+	ReservedNames string `json:"reserved_names,omitempty"`
+
+	// ShowHidden lets fs mode resolve dotfiles and dot-directories such as
+	// .git or .env, which are hidden by default.
+	ShowHidden bool `json:"show_hidden,omitempty"`
+
+	// HostRoots maps hostnames to the fs mode root for their requests, for
+	// vhosts served from per-host directories. Keys are matched like Hosts
+	// keys (exact names or "*.domain" wildcards); values may use
+	// placeholders such as /srv/{http.request.host}. Other hosts use Root.
+	HostRoots map[string]string `json:"roots,omitempty"`
+
+	// FileSystem is the name of a filesystem registered in the global
+	// `filesystem` options (the same names file_server's `fs` accepts). When
+	// set, fs mode resolves casing against that virtual filesystem instead of
+	// the local disk, and Root is a path within it (default: its top level).
+	FileSystem string `json:"file_system,omitempty"`
+
+	// Shared names a root of the casefold app (see App) to resolve against
+	// in fs mode. The root, its cache, index and watch settings, Ambiguity
+	// and the resolution limits then come from the app and may not be set
+	// here, and the state is the one the app holds, shared with every
+	// handler naming the same root.
+	Shared string `json:"shared,omitempty"`
+
+	// FS, set from Go code, is the filesystem fs mode resolves against in
+	// place of the local disk, with Root a path within it (default: its top
+	// level). It scopes the handler to a sandbox, or to an fstest.MapFS in
+	// tests. It cannot be combined with FileSystem.
+	FS fs.FS `json:"-"`
+
+	// CacheSize bounds an in-memory LRU cache of fs-mode resolutions keyed by
+	// the lowercased request path, so repeated requests for the same miscased
+	// URL skip the directory walk. Zero (default) disables the cache.
+	CacheSize int `json:"cache_size,omitempty"`
+
+	// CacheTTL is how long a cached fs-mode resolution stays valid. Zero means
+	// entries live until evicted by CacheSize.
+	CacheTTL caddy.Duration `json:"cache_ttl,omitempty"`
+
+	// NegativeCacheTTL, when set, also caches fs-mode paths that do not
+	// resolve, for this long, so repeated requests for missing paths skip
+	// the directory walk too. Requires CacheSize; keep it shorter than
+	// CacheTTL unless Watch is enabled, since new files are not seen until
+	// the miss expires.
+	NegativeCacheTTL caddy.Duration `json:"negative_cache_ttl,omitempty"`
+
+	// DirCacheSize bounds an in-memory LRU of directory listings used by
+	// fs-mode resolution. A cached listing is reused for as long as the
+	// directory's modification time and size are unchanged, so resolving
+	// through a hot directory costs a stat instead of a full read. Zero
+	// (default) disables it.
+	DirCacheSize int `json:"dir_cache_size,omitempty"`
+
+	// Preload walks Root once at provision time and keeps an in-memory index
+	// of every path's canonical casing, so fs-mode resolution becomes a map
+	// lookup with no per-request disk access. Paths missing from the index are
+	// treated as unresolved. Best suited to mostly-static roots; combine with
+	// Watch to pick up changes.
+	Preload bool `json:"preload,omitempty"`
+
+	// PreloadWorkers is how many directories Preload reads concurrently
+	// (default GOMAXPROCS). Progress is logged while the walk runs.
+	PreloadWorkers int `json:"preload_workers,omitempty"`
+
+	// ReindexInterval, when set together with Preload, rebuilds the index
+	// in the background this often and swaps it in once complete. Use it
+	// where Watch is unreliable, as on NFS or bind mounts in containers.
+	ReindexInterval caddy.Duration `json:"reindex_interval,omitempty"`
+
+	// IndexFile, when set together with Preload, persists the preloaded index
+	// to this file and reuses it on the next start instead of walking Root
+	// again, as long as the snapshot is still fresh (see IndexStamp).
+	IndexFile string `json:"index_file,omitempty"`
+
+	// IndexStamp is an opaque version string (e.g. a deploy ID) saved with the
+	// index snapshot. If set, a snapshot is reused only when its stamp matches;
+	// if empty, it is reused only when no indexed directory was modified since
+	// the snapshot was built.
+	IndexStamp string `json:"index_stamp,omitempty"`
+
+	// Watch enables a filesystem watcher on Root that drops cached fs-mode
+	// resolutions (and updates the preloaded index) as soon as entries are
+	// created, renamed or removed, instead of waiting for CacheTTL. Only
+	// meaningful together with CacheSize or Preload.
+	Watch bool `json:"watch,omitempty"`
+
+	// ResolverRaw configures a guest module from the
+	// http.handlers.casefold.resolvers namespace used by mode "resolver" to
+	// look up canonical paths.
+	ResolverRaw json.RawMessage `json:"resolver,omitempty" caddy:"namespace=http.handlers.casefold.resolvers inline_key=resolver"`
+
+	// TransformModules configures guest modules from the
+	// http.handlers.casefold.transforms namespace, keyed by module name, for
+	// use as Transforms steps. Modules that need no settings can simply be
+	// named in Transforms.
+	TransformModules caddy.ModuleMap `json:"transform_modules,omitempty" caddy:"namespace=http.handlers.casefold.transforms"`
+
+	// MapFile is the JSON or CSV mapping file used by mode "map". It is
+	// reloaded automatically when it changes.
+	MapFile string `json:"map_file,omitempty"`
+
+	// Ambiguity decides which entry fs mode routes to when several names in
+	// a directory differ only by case (e.g. README.md and Readme.md):
+	// "prefer_exact" (default) serves an exact match of the request, else
+	// the first candidate in lexical order; "first" always serves the first
+	// candidate; "newest" serves the most recently modified one; "error"
+	// serves an exact match but otherwise responds 409 Conflict;
+	// "multiple_choices" is like "error" but responds 300 Multiple Choices
+	// listing the candidate URLs.
+	Ambiguity string `json:"ambiguity,omitempty"`
+
+	// Suggest, when positive, is how many "did you mean" suggestions fs mode
+	// offers for paths it cannot resolve: existing paths that match all but
+	// one segment case-insensitively, with that segment a small edit
+	// distance away. They are published in the casefold.suggestions var and
+	// {http.casefold.suggestions}, for custom 404 pages, and in the
+	// SuggestHeader response header if one is named.
+	Suggest       int    `json:"suggest,omitempty"`
+	SuggestHeader string `json:"suggest_header,omitempty"`
+
+	// Candidates publishes the casings of the request path worth trying,
+	// for `try_files` and similar: as sent, lowercased, title-cased and
+	// transformed, without duplicates. See publishCandidates for the
+	// placeholders. Usually combined with Shadow so the path itself is left
+	// alone.
+	Candidates bool `json:"candidates,omitempty"`
+
+	// PercentHex, if set to "upper" or "lower", rewrites the hex digits of
+	// percent-escapes in the path to that case (%2f becomes %2F under
+	// "upper", the form RFC 3986 recommends), so caches and matchers see
+	// one spelling of each escaped path.
+	PercentHex string `json:"percent_hex,omitempty"`
+
+	// EncodedSlashes decides how %2F in the request path is treated:
+	// "keep" (default) transforms the path around encoded slashes and keeps
+	// them encoded in the rewritten URL, so they are never turned into path
+	// separators; "decode" treats them as ordinary slashes; "reject"
+	// responds 400 Bad Request.
+	EncodedSlashes string `json:"encoded_slashes,omitempty"`
+
+	// RetryOn404 first passes GET and HEAD requests on unchanged and only
+	// transforms the path, running the rest of the chain once more, if the
+	// response is 404 Not Found. Exact matches then always win and the
+	// transformed path only serves as a fallback. Other methods pass through
+	// untouched.
+	RetryOn404 bool `json:"retry_on_404,omitempty"`
+
+	// Fallback decides what happens to a path fs mode cannot resolve:
+	// "none" (default) passes it through unchanged, "lower" and "fold"
+	// apply that case mode instead, and "not_found" responds 404 without
+	// calling the next handler.
+	Fallback string `json:"fallback,omitempty"`
+
 	// Exclude is an optional list of glob patterns (evaluated with path.Match)
 	// that, if any matches the original request path, will skip rewriting.
-	// Patterns are matched against the leading slash form of the path.
+	// Patterns are matched against the leading slash form of the path, after
+	// expanding global placeholders such as {env.API_PREFIX}. A
+	// "**" segment matches any number of segments, so "/static/**" excludes
+	// the whole subtree.
 	Exclude []string `json:"exclude,omitempty"`
 
+	// ExcludeIgnoreCase matches Exclude, ExcludeFile and ExcludeURL patterns
+	// case-insensitively: pattern and path are both normalized and
+	// lowercased first, so "/API/*" also excludes /api/Foo.
+	ExcludeIgnoreCase bool `json:"exclude_ignore_case,omitempty"`
+
+	// ExcludeFile loads further exclude patterns from a file, one per line
+	// (blank lines and lines starting with # are ignored). The file is
+	// watched and reloaded on change; a reload that fails to parse keeps the
+	// previous patterns. File patterns are listed by the admin API alongside
+	// Exclude but cannot be removed through it.
+	ExcludeFile string `json:"exclude_file,omitempty"`
+
+	// ExcludeURL polls an HTTP(S) endpoint for further exclude patterns, in
+	// the ExcludeFile format, every ExcludeURLInterval (default 5m). Polls
+	// send If-None-Match with the last ETag. A failed fetch, including one at
+	// startup, is logged and keeps the previous patterns; provisioning waits
+	// at most two seconds for the first one.
+	ExcludeURL         string         `json:"exclude_url,omitempty"`
+	ExcludeURLInterval caddy.Duration `json:"exclude_url_interval,omitempty"`
+
+	// Only restricts folding to paths matching one of these glob patterns
+	// (Exclude syntax, including "**"), or lying below a directory that does: "/docs/*"
+	// covers /docs/Guide as well as /docs/Guide/Intro.html. It is the
+	// allowlist counterpart of Exclude. Other paths are counted as skips with
+	// reason "only". Empty means all paths.
+	Only []string `json:"only,omitempty"`
+
+	// ApplyToRaw restricts the handler to requests matching any of these
+	// matcher sets (modules from the http.matchers namespace, e.g. path,
+	// header, method, remote_ip). Other requests are skipped with reason
+	// "apply_to". Empty means all requests.
+	ApplyToRaw caddyhttp.RawMatcherSets `json:"apply_to,omitempty" caddy:"namespace=http.matchers"`
+
+	// ExcludeMatchRaw skips requests matching any of these matcher sets,
+	// extending the path-only Exclude globs to any request property.
+	// Skips are counted with reason "exclude_match".
+	ExcludeMatchRaw caddyhttp.RawMatcherSets `json:"exclude_match,omitempty" caddy:"namespace=http.matchers"`
+
+	// Rules hand requests under different paths to separate configurations,
+	// tried in order; each rule is a complete casefold config of its own.
+	// When Rules are set the handler only dispatches: requests matching no
+	// rule pass through untouched (skip reason "no_rule") and the handler's
+	// other options are ignored.
+	Rules []*PathRule `json:"rules,omitempty"`
+
+	// Hosts gives requests for the named hosts their own configuration,
+	// which may in turn have Rules. Keys are hostnames, matched
+	// case-insensitively without the port, or "*.domain" wildcards covering
+	// one label; an exact name wins over a wildcard. Requests for other
+	// hosts are handled by the rest of this config, so a wildcard site can
+	// set defaults and override them per tenant.
+	Hosts map[string]*Casefold `json:"hosts,omitempty"`
+
+	// Name identifies this handler on the admin API, where its exclude
+	// patterns can be listed and patched at runtime. Handlers sharing a
+	// name are patched together. Defaults to "default".
+	Name string `json:"name,omitempty"`
+
+	// Methods limits the handler to requests with these HTTP methods (e.g.
+	// GET and HEAD), so write operations such as PUT, DELETE or PROPFIND
+	// reach case-sensitive backends exactly as sent. Empty means all
+	// methods; others are counted as skips with reason "method".
+	Methods []string `json:"methods,omitempty"`
+
+	// BypassHeader names a request header that opts a request out of the
+	// handler, e.g. X-No-Casefold for internal clients and health checks.
+	// With BypassValue set the header must carry exactly that value;
+	// otherwise its presence is enough. Bypassed requests are counted as
+	// skips with reason "bypass_header".
+	BypassHeader string `json:"bypass_header,omitempty"`
+	BypassValue  string `json:"bypass_value,omitempty"`
+
+	// SkipSignedURLs leaves pre-signed URLs untouched: requests whose query
+	// carries a known signature parameter (X-Amz-Signature, Signature,
+	// X-Goog-Signature, sig). The signature covers the exact path, so
+	// folding it would break them. Counted as skips with reason
+	// "signed_url".
+	SkipSignedURLs bool `json:"skip_signed_urls,omitempty"`
+
+	// SkipQueryParams leaves requests untouched whose query has any of these
+	// parameter names (compared case-insensitively), for signing schemes
+	// SkipSignedURLs does not know. Counted as skips with reason
+	// "query_param".
+	SkipQueryParams []string `json:"skip_query_params,omitempty"`
+
+	// SkipAuthorized leaves requests with an Authorization header untouched,
+	// since HMAC-style schemes (AWS SigV4 headers, HTTP Signatures, ...)
+	// sign the exact request path. Counted as skips with reason
+	// "authorized".
+	SkipAuthorized bool `json:"skip_authorized,omitempty"`
+
+	// SkipUpgrade leaves requests asking for a protocol switch (Upgrade
+	// header, e.g. WebSocket, or extended CONNECT) untouched, since their
+	// paths are endpoint identifiers. Enabled by default.
+	SkipUpgrade *bool `json:"skip_upgrade,omitempty"`
+
+	// SkipGRPC leaves gRPC and gRPC-Web calls (Content-Type
+	// application/grpc*) untouched: their paths name service methods and
+	// are case-sensitive. Enabled by default.
+	SkipGRPC *bool `json:"skip_grpc,omitempty"`
+
+	// SamplePercent applies the handler to only this share (0-100) of
+	// requests, for gradual rollouts; the rest pass through untouched and
+	// are counted as skips with reason "sample". Unset (the default), it
+	// applies to every request; 0 applies it to none.
+	SamplePercent *float64 `json:"sample_percent,omitempty"`
+
+	// SampleBy selects what SamplePercent hashes to pick requests: "ip"
+	// (default, the client IP) or "path" (the lowercased path, so every
+	// casing of a URL is treated alike).
+	SampleBy string `json:"sample_by,omitempty"`
+
+	// FoldQueryKeys applies the case transformation to query parameter names
+	// (values are left intact), so `?Page=2` and `?page=2` look the same to
+	// query matchers. Modes without a case transformation (fs, map,
+	// resolver) lowercase the keys.
+	FoldQueryKeys bool `json:"fold_query_keys,omitempty"`
+
+	// FoldHost lowercases r.Host (and r.URL.Host of absolute-form requests)
+	// along with the path, for backends routing on an exact Host that
+	// receive mixed-case hosts from proxies in front. Off by default.
+	FoldHost bool `json:"fold_host,omitempty"`
+
+	// CanonicalQuery normalizes the query string into a deterministic form:
+	// parameter names are folded as with FoldQueryKeys and parameters are
+	// sorted by name (repeated names keep their relative order). Intended
+	// for cache-key stability with downstream caching handlers.
+	CanonicalQuery bool `json:"canonical_query,omitempty"`
+
+	// FoldQueryValues lists query parameter names (matched
+	// case-insensitively) whose values are case-insensitive in the
+	// application, e.g. `format` or `lang`. Their values are folded; every
+	// other value is preserved byte-for-byte.
+	FoldQueryValues []string `json:"fold_query_values,omitempty"`
+
+	// RewriteRequestURI controls whether r.RequestURI is rebuilt to match the
+	// rewritten path and query (default true). Disable it for handlers such
+	// as fastcgi or some proxy setups that rely on the exact original
+	// RequestURI; only r.URL is modified then, and RawPath is left as is.
+	RewriteRequestURI *bool `json:"rewrite_request_uri,omitempty"`
+
+	// OriginalURIHeader names the header that carries the path as received
+	// before rewriting, on both the request and the response. Default:
+	// X-Original-URI.
+	OriginalURIHeader string `json:"original_uri_header,omitempty"`
+
+	// SuppressResponseHeader stops the original URI header from being set on
+	// the response, so rewrite details are not exposed to clients. The request
+	// header is still set for downstream handlers.
+	SuppressResponseHeader bool `json:"suppress_response_header,omitempty"`
+
+	// CanonicalLink appends `Link: <url>; rel="canonical"` to responses
+	// whose path was rewritten, pointing crawlers at the preferred casing.
+	// The absolute URL is built from the request scheme and host.
+	CanonicalLink bool `json:"canonical_link,omitempty"`
+
+	// ContentLocation sets the standard Content-Location response header to
+	// the rewritten path (and query), informing clients of the canonical URI
+	// of the resource they received.
+	ContentLocation bool `json:"content_location,omitempty"`
+
+	// Events emits casefold.rewritten through the events app for every
+	// rewrite or redirect, and casefold.conflict when fs mode finds several
+	// entries whose names differ only by case, so event handlers (exec,
+	// webhooks, ...) can react. Handlers run synchronously with the request.
+	Events bool `json:"events,omitempty"`
+
+	// ServerTiming appends a `Server-Timing: casefold;dur=<ms>` entry to
+	// responses, reporting how long canonicalization took for the request so
+	// the cost of fs mode resolution is visible in browser dev tools.
+	ServerTiming bool `json:"server_timing,omitempty"`
+
+	// Redirect, when enabled, responds with a redirect to the transformed path
+	// instead of rewriting the request internally, so clients learn the
+	// canonical casing.
+	Redirect bool `json:"redirect,omitempty"`
+
+	// RedirectCode is the status code used when Redirect is enabled. One of
+	// 301, 302, 307 or 308 (default). 307 and 308 preserve the request method.
+	RedirectCode int `json:"redirect_code,omitempty"`
+
+	// RedirectMethods limits Redirect to requests with these methods, e.g.
+	// GET and HEAD; requests with other methods are rewritten internally
+	// instead, for clients that mishandle redirects of a POST or PUT. Empty
+	// means every method is redirected.
+	RedirectMethods []string `json:"redirect_methods,omitempty"`
+
+	// Audit computes the transformed path but never changes the request: no
+	// rewrite, redirect or query folding happens. Requests that would have
+	// been rewritten are counted in the rewrites metric with action "audit"
+	// and logged at info level on the http.handlers.casefold.audit logger
+	// (one in every LogSample, if set), to measure miscased traffic before
+	// turning folding on.
+	Audit bool `json:"audit,omitempty"`
+
+	// Shadow computes the transformed path but leaves the request untouched,
+	// exposing the would-be path as the casefold.shadow_path variable and
+	// {http.casefold.shadow_path} placeholder for downstream comparisons.
+	Shadow bool `json:"shadow,omitempty"`
+
+	// RedirectDropQuery omits the original query string from the redirect
+	// Location. By default the query string is carried over unchanged.
+	RedirectDropQuery bool `json:"redirect_drop_query,omitempty"`
+
 	// Verbose enables debug logging of decisions (skips, transformations, fs lookups).
 	Verbose bool `json:"verbose,omitempty"`
 
-	fold caser       `json:"-"`
-	log  *zap.Logger `json:"-"`
+	// LogFields adds the rewrite decision to the request's access log entry
+	// as casefold.original_path, casefold.path, casefold.rewritten and
+	// casefold.mode, so miscased traffic can be found in the log pipeline.
+	LogFields bool `json:"log_fields,omitempty"`
+
+	// LogSample emits a debug entry for one in every LogSample rewrites or
+	// redirects on the dedicated http.handlers.casefold.rewrites logger,
+	// independently of Verbose. 1 logs every rewrite; 0 disables it.
+	LogSample int `json:"log_sample,omitempty"`
+
+	fold       caser           `json:"-"`
+	locales    *localeSelector `json:"-"`
+	norm       normalizer      `json:"-"`
+	translit   transliterator  `json:"-"`
+	steps      []string        `json:"-"`
+	replace    replaceTable    `json:"-"`
+	resolver   Resolver        `json:"-"`
+	fsys       fs.FS           `json:"-"`
+	state      *fsState        `json:"-"`
+	stateKey   string          `json:"-"`
+	log        *zap.Logger     `json:"-"`
+	rewriteLog *rewriteLogger  `json:"-"`
+	auditLog   *rewriteLogger  `json:"-"`
+	excludes   *excludeList    `json:"-"`
+	excludeSrc *excludeFile    `json:"-"`
+	excludeURL *excludeURL     `json:"-"`
+	// embedded is set when c backs another module (casefold_mismatch), a
+	// PathRule or a Hosts entry; it is then not registered by name.
+	embedded bool          `json:"-"`
+	events   eventEmitter  `json:"-"`
+	ctx      caddy.Context `json:"-"`
+
+	// transformers holds the loaded guest transform modules by name.
+	transformers map[string]Transformer `json:"-"`
+	applyTo      caddyhttp.MatcherSets  `json:"-"`
+	excludeMatch caddyhttp.MatcherSets  `json:"-"`
+
+	// rootTemplate is Root when it needs request placeholders; roots then
+	// holds a lookup per expanded value.
+	rootTemplate string        `json:"-"`
+	roots        *dynamicRoots `json:"-"`
+	fallbacks    []*Casefold   `json:"-"`
+	fsID         string        `json:"-"`
+	// hideNames and hidePaths are Hide, folded and split by kind.
+	hideNames []string `json:"-"`
+	hidePaths []string `json:"-"`
+	// fallbackCaser implements Fallback lower and fold.
+	fallbackCaser caser `json:"-"`
 }
 
 // caser abstracts the Fold or Lower implementation we pick at provision time.
@@ -74,15 +610,166 @@ func (Casefold) CaddyModule() caddy.ModuleInfo { //nolint:revive
 // Provision sets up the module.
 func (c *Casefold) Provision(ctx caddy.Context) error { //nolint:revive
 	c.log = ctx.Logger()
-	switch strings.ToLower(strings.TrimSpace(c.Mode)) {
+	c.ctx = ctx
+	if err := c.provisionShared(ctx); err != nil {
+		return err
+	}
+	if err := c.expandPlaceholders(); err != nil {
+		return err
+	}
+	if err := registerMetrics(ctx); err != nil {
+		return fmt.Errorf("registering metrics: %v", err)
+	}
+	n, err := parseNormalizer(c.Normalize)
+	if err != nil {
+		return err
+	}
+	c.norm = n
+	if c.translit, err = newTransliterator(c.Transliterate); err != nil {
+		return err
+	}
+	if c.replace, err = newReplaceTable(c.Replace); err != nil {
+		return err
+	}
+	if c.Events {
+		if err := c.provisionEvents(ctx); err != nil {
+			return fmt.Errorf("loading events app: %v", err)
+		}
+	}
+	if err := c.provisionPipeline(ctx); err != nil {
+		return err
+	}
+	if err := c.checkStrict(); err != nil {
+		return err
+	}
+	if c.OriginalURIHeader == "" {
+		c.OriginalURIHeader = "X-Original-URI"
+	}
+	switch c.RedirectCode {
+	case 0:
+		c.RedirectCode = http.StatusPermanentRedirect
+	case http.StatusMovedPermanently, http.StatusFound, http.StatusTemporaryRedirect, http.StatusPermanentRedirect:
+	default:
+		return fmt.Errorf("invalid redirect_code %d: must be 301, 302, 307 or 308", c.RedirectCode)
+	}
+	if err := validateExcludes(c.Exclude); err != nil {
+		return err
+	}
+	if err := c.provisionHide(); err != nil {
+		return err
+	}
+	if err := c.validateOptions(); err != nil {
+		return err
+	}
+	var excludeKey func(string) string
+	if c.ExcludeIgnoreCase {
+		excludeKey = c.norm.fold
+	}
+	c.excludes = newExcludeList(c.Exclude, excludeKey)
+	if c.ExcludeFile != "" {
+		if c.excludeSrc, err = newExcludeFile(c.ExcludeFile, c.excludes, c.log); err != nil {
+			return err
+		}
+	}
+	if c.ExcludeURL != "" {
+		if c.excludeURL, err = newExcludeURL(c.ExcludeURL, time.Duration(c.ExcludeURLInterval), c.excludes, c.log); err != nil {
+			return err
+		}
+	}
+	for _, p := range c.Only {
+		if _, err := path.Match(p, ""); err != nil {
+			return fmt.Errorf("invalid only pattern %q: %v", p, err)
+		}
+	}
+	if c.applyTo, err = loadMatcherSets(ctx, c.ApplyToRaw); err != nil {
+		return fmt.Errorf("loading apply_to matchers: %v", err)
+	}
+	if c.excludeMatch, err = loadMatcherSets(ctx, c.ExcludeMatchRaw); err != nil {
+		return fmt.Errorf("loading exclude_match matchers: %v", err)
+	}
+	if err := c.provisionRules(ctx); err != nil {
+		return err
+	}
+	if err := c.provisionHosts(ctx); err != nil {
+		return err
+	}
+	if !validAmbiguity(c.Ambiguity) {
+		return fmt.Errorf("invalid ambiguity policy %q: must be prefer_exact, first, newest, error or multiple_choices", c.Ambiguity)
+	}
+	if err := c.provisionFallback(); err != nil {
+		return err
+	}
+	if err := c.validateSampling(); err != nil {
+		return err
+	}
+	if c.LogSample < 0 {
+		return fmt.Errorf("invalid log_sample %d: must not be negative", c.LogSample)
+	}
+	if c.LogSample > 0 {
+		c.rewriteLog = newRewriteLogger(c.log.Named("rewrites"), c.LogSample)
+	}
+	if c.Audit {
+		c.auditLog = newRewriteLogger(c.log.Named("audit"), max(c.LogSample, 1))
+		c.auditLog.level = zap.InfoLevel
+	}
+	if c.Verbose {
+		c.log.Debug("casefold provisioned", zap.String("mode", c.modeOrDefault()), zap.String("root", c.Root), zap.Int("exclude_count", len(c.Exclude)))
+	}
+	if !c.embedded {
+		registerHandler(c)
+	}
+	return nil
+}
+
+// provisionStep prepares the state one transformation step needs.
+func (c *Casefold) provisionStep(ctx caddy.Context, step string) error {
+	switch step {
 	case "", "lower":
-		c.fold = lowerCaser{}
+		if err := c.provisionCaser(lowerCaser{}, lowerFor); err != nil {
+			return err
+		}
+	case "upper":
+		if err := c.provisionCaser(upperCaser{}, upperFor); err != nil {
+			return err
+		}
+	case "title":
+		if err := c.provisionCaser(titleCaser{lowerCaser{}, upperCaser{}}, titleFor); err != nil {
+			return err
+		}
+	case "ascii":
+		if err := c.provisionCaser(asciiCaser{lowerCaser{}}, asciiFor); err != nil {
+			return err
+		}
 	case "fold":
-		c.fold = cases.Fold()
+		c.fold = c.replace.wrap(cases.Fold())
+		if c.Locale != "" {
+			c.log.Warn("casefold locale only applies to lower, upper, title and ascii modes; ignoring", zap.String("locale", c.Locale), zap.String("mode", step))
+		}
+	case "nfc", "nfd":
+		// stateless; applied by applyStep
 	case "fs":
 		// handled dynamically in ServeHTTP; keep fold nil
-		if c.Root == "" {
-			ctx.Logger().Warn("fs mode enabled but root not set; skipping canonicalization")
+		if c.rootTemplate != "" {
+			// resolved per request by fsForRequest
+		} else if c.FS != nil {
+			sub, err := fs.Sub(c.FS, fsPath(c.Root))
+			if err != nil {
+				return fmt.Errorf("root %q: %v", c.Root, err)
+			}
+			c.fsys = sub
+			c.fsID = fsIdentity(c.FS)
+		} else if c.FileSystem != "" {
+			fsys, ok := ctx.FileSystems().Get(c.FileSystem)
+			if !ok {
+				return fmt.Errorf("unknown file_system %q", c.FileSystem)
+			}
+			sub, err := fs.Sub(fsys, fsPath(c.Root))
+			if err != nil {
+				return fmt.Errorf("file_system %q root %q: %v", c.FileSystem, c.Root, err)
+			}
+			c.fsys = sub
+		} else if c.Root == "" {
+			c.setRootTemplate(siteRoot)
 		} else {
 			// normalize root to absolute for safety
 			if !filepath.IsAbs(c.Root) {
@@ -91,133 +778,658 @@ func (c *Casefold) Provision(ctx caddy.Context) error { //nolint:revive
 					c.Root = abs
 				}
 			}
+			c.fsys = os.DirFS(c.Root)
 		}
-	default:
-		c.log.Warn("unknown casefold mode; defaulting to lower", zap.String("mode", c.Mode))
-		c.fold = lowerCaser{}
-	}
-	if c.Verbose {
-		c.log.Debug("casefold provisioned", zap.String("mode", strings.ToLower(strings.TrimSpace(c.Mode))), zap.String("root", c.Root), zap.Int("exclude_count", len(c.Exclude)))
+		if c.fsys != nil {
+			c.stateKey = c.fsStateKey()
+			val, _, err := fsStates.LoadOrNew(c.stateKey, func() (caddy.Destructor, error) {
+				return c.newFSState()
+			})
+			if err != nil {
+				c.stateKey = ""
+				return err
+			}
+			c.state = val.(*fsState)
+		}
+		if err := c.provisionFallbackRoots(ctx); err != nil {
+			return err
+		}
+	case "resolver":
+		if c.ResolverRaw == nil {
+			return fmt.Errorf("resolver mode requires a resolver module")
+		}
+		mod, err := ctx.LoadModule(c, "ResolverRaw")
+		if err != nil {
+			return fmt.Errorf("loading resolver module: %v", err)
+		}
+		c.resolver = mod.(Resolver)
+		if m, ok := c.resolver.(*MapResolver); ok && c.norm != "" {
+			if err := m.normalize(c.norm); err != nil {
+				return err
+			}
+		}
+	case "map":
+		if c.MapFile == "" {
+			return fmt.Errorf("map mode requires map_file")
+		}
+		m := &MapResolver{File: c.MapFile, norm: c.norm}
+		if err := m.Provision(ctx); err != nil {
+			return err
+		}
+		c.resolver = m
 	}
 	return nil
 }
 
+// Cleanup unregisters the handler from the admin API, releases its reference
+// to the shared fs-mode state and stops the map and exclude file watchers
+// and the exclude_url poller, if any.
+func (c *Casefold) Cleanup() error { //nolint:revive
+	if !c.embedded {
+		unregisterHandler(c)
+	}
+	for _, rule := range c.Rules {
+		if err := rule.Cleanup(); err != nil {
+			return err
+		}
+	}
+	if err := c.cleanupHosts(); err != nil {
+		return err
+	}
+	if c.roots != nil {
+		if err := c.roots.Cleanup(); err != nil {
+			return err
+		}
+	}
+	for _, fc := range c.fallbacks {
+		if err := fc.Cleanup(); err != nil {
+			return err
+		}
+	}
+	if c.excludeSrc != nil {
+		if err := c.excludeSrc.Close(); err != nil {
+			return err
+		}
+	}
+	if c.excludeURL != nil {
+		_ = c.excludeURL.Close()
+	}
+	if m, ok := c.resolver.(*MapResolver); ok && c.hasStep("map") {
+		if err := m.Cleanup(); err != nil {
+			return err
+		}
+	}
+	if c.stateKey == "" {
+		return nil
+	}
+	_, err := fsStates.Delete(c.stateKey)
+	return err
+}
+
 // ServeHTTP implements caddyhttp.MiddlewareHandler.
 func (c *Casefold) ServeHTTP(w http.ResponseWriter, r *http.Request, next caddyhttp.Handler) error { //nolint:revive
+	if len(c.Hosts) > 0 {
+		if hc := c.hostConfig(r); hc != nil {
+			return hc.ServeHTTP(w, r, next)
+		}
+	}
+	if len(c.Rules) > 0 {
+		return c.serveRules(w, r, next)
+	}
 	orig := r.URL.Path
-	if orig == "" || orig == "/" {
+	casefoldMetrics.requests.WithLabelValues(c.modeOrDefault()).Inc()
+	if c.MaxPathLength > 0 && len(orig) > c.MaxPathLength {
+		if c.Verbose && c.log != nil {
+			c.log.Debug("casefold skip (path too long)", zap.Int("length", len(orig)), zap.Bool("rejected", c.RejectLongPaths))
+		}
+		casefoldMetrics.skips.WithLabelValues("path_length").Inc()
+		if c.RejectLongPaths {
+			return caddyhttp.Error(http.StatusRequestURITooLong, fmt.Errorf("path length %d exceeds max_path_length %d", len(orig), c.MaxPathLength))
+		}
+		c.annotate(r, orig, orig, false)
 		return next.ServeHTTP(w, r)
 	}
 	if pat := c.matchExclude(orig); pat != "" {
 		if c.Verbose && c.log != nil {
 			c.log.Debug("casefold skip (excluded)", zap.String("path", orig), zap.String("pattern", pat))
 		}
+		casefoldMetrics.skips.WithLabelValues("exclude").Inc()
+		c.annotate(r, orig, orig, false)
+		return next.ServeHTTP(w, r)
+	}
+	reason, err := c.skipReason(r)
+	if err != nil {
+		return err
+	}
+	if reason != "" {
+		if c.Verbose && c.log != nil {
+			c.log.Debug("casefold skip", zap.String("path", orig), zap.String("reason", reason))
+		}
+		casefoldMetrics.skips.WithLabelValues(reason).Inc()
+		c.annotate(r, orig, orig, false)
 		return next.ServeHTTP(w, r)
 	}
+	if err := c.rejectPath(r, orig); err != nil {
+		c.annotate(r, orig, orig, false)
+		return caddyhttp.Error(http.StatusBadRequest, err)
+	}
+	if c.RetryOn404 && !c.Audit && !c.Shadow {
+		return c.serveRetry(w, r, next, orig)
+	}
+	if !c.Audit && !c.Shadow {
+		c.rewriteQuery(r)
+		c.foldHost(r)
+	}
 
-	mode := strings.ToLower(strings.TrimSpace(c.Mode))
-	transformed := orig
-	switch mode {
-	case "", "lower", "fold":
-		transformed = c.fold.String(orig)
-	case "fs":
-		canon, ok := c.canonicalFS(orig)
-		if ok {
-			transformed = canon
-		} else {
-			// fallback to original (no change) if not all segments resolved
+	start := time.Now()
+	transformed, raw, err := c.transformRequest(r, orig)
+	if c.Candidates {
+		c.publishCandidates(r, orig, transformed)
+	}
+	if c.SuggestHeader != "" {
+		c.setSuggestionHeader(w, r)
+	}
+	if c.Audit || c.Shadow {
+		if c.ServerTiming {
+			w.Header().Add("Server-Timing", serverTiming(time.Since(start)))
+		}
+		return c.servePassive(w, r, next, orig, transformed, err)
+	}
+	return c.serveTransformed(w, r, next, orig, transformed, raw, err, time.Since(start))
+}
+
+// serveTransformed hands r on with its path rewritten or redirected to
+// transformed (escaped as raw, if set), or fails it with the transform's
+// error. took is how long the transform ran, for Server-Timing.
+func (c *Casefold) serveTransformed(w http.ResponseWriter, r *http.Request, next caddyhttp.Handler, orig, transformed, raw string, err error, took time.Duration) error {
+	if err != nil {
+		c.annotate(r, orig, orig, false)
+		var amb *ambiguousPathError
+		if errors.As(err, &amb) && c.Ambiguity == ambiguityMultipleChoices {
+			return writeMultipleChoices(w, r, amb)
 		}
+		if errors.Is(err, errFSNotFound) {
+			return caddyhttp.Error(http.StatusNotFound, err)
+		}
+		return caddyhttp.Error(http.StatusConflict, err)
+	}
+	if c.ServerTiming {
+		w.Header().Add("Server-Timing", serverTiming(took))
 	}
 
-	if transformed != orig {
+	changed := transformed != orig || raw != r.URL.RawPath
+	if changed && c.redirects(r) {
+		query := r.URL.RawQuery
+		if c.RedirectDropQuery {
+			query = ""
+		}
+		loc := relativeRawRef(transformed, raw, query)
 		if c.Verbose && c.log != nil {
-			c.log.Debug("casefold transformed", zap.String("from", orig), zap.String("to", transformed), zap.String("mode", mode))
+			c.log.Debug("casefold redirect", zap.String("from", orig), zap.String("location", loc), zap.String("mode", c.modeOrDefault()))
+		}
+		casefoldMetrics.rewrites.WithLabelValues(c.modeOrDefault(), "redirect").Inc()
+		c.rewriteLog.Log(r, "redirect", orig, transformed, c.modeOrDefault())
+		c.emitRewritten(r, "redirect", orig, transformed)
+		c.annotate(r, orig, transformed, false)
+		w.Header().Set("Location", loc)
+		w.WriteHeader(c.RedirectCode)
+		return nil
+	}
+
+	if changed {
+		if c.Verbose && c.log != nil {
+			c.log.Debug("casefold transformed", zap.String("from", orig), zap.String("to", transformed), zap.String("mode", c.modeOrDefault()))
+		}
+		casefoldMetrics.rewrites.WithLabelValues(c.modeOrDefault(), "rewrite").Inc()
+		c.rewriteLog.Log(r, "rewrite", orig, transformed, c.modeOrDefault())
+		c.emitRewritten(r, "rewrite", orig, transformed)
+		r.Header.Set(c.OriginalURIHeader, orig)
+		if !c.SuppressResponseHeader {
+			w.Header().Set(c.OriginalURIHeader, orig)
+		}
+		if c.CanonicalLink {
+			w.Header().Add("Link", "<"+absoluteURL(r, transformed)+`>; rel="canonical"`)
+		}
+		if c.ContentLocation {
+			w.Header().Set("Content-Location", relativeRawRef(transformed, raw, r.URL.RawQuery))
 		}
-		r.Header.Set("X-Original-URI", orig)
-		w.Header().Set("X-Original-URI", orig)
 		r.URL.Path = transformed
-		r.RequestURI = transformed
+		r.URL.RawPath = raw
+		if c.rewritesRequestURI() {
+			r.RequestURI = r.URL.RequestURI()
+		}
 	} else if c.Verbose && c.log != nil {
-		c.log.Debug("casefold no-op", zap.String("path", orig), zap.String("mode", mode))
+		c.log.Debug("casefold no-op", zap.String("path", orig), zap.String("mode", c.modeOrDefault()))
 	}
+	c.annotate(r, orig, transformed, changed)
 	return next.ServeHTTP(w, r)
 }
 
+// transform returns the canonical form of p: the configured steps applied
+// in order. Paths that cannot be resolved are returned unchanged. The only
+// error is an *ambiguousPathError from fs lookups under the "error"
+// ambiguity policy.
+func (c *Casefold) transform(r *http.Request, p string) (string, error) {
+	if p == "" || p == "/" {
+		return p, nil
+	}
+	orig := p
+	p = c.translit.String(p)
+	if c.MixedScripts == mixedScriptsFold {
+		p = foldMixedScripts(p)
+	}
+	if c.CollapseSlashes {
+		p = collapseSlashes(p)
+	}
+	if c.DotSegments == dotSegmentsResolve {
+		p = resolveDotSegments(p)
+	}
+	steps := c.steps
+	if steps == nil { // not provisioned through Provision
+		steps = []string{c.modeOrDefault()}
+	}
+	for _, step := range steps {
+		next, ok, err := c.applyStep(r, p, step)
+		if err != nil || !ok {
+			return orig, err
+		}
+		p = next
+	}
+	return c.trailingSlash(r, orig, p), nil
+}
+
+// applyStep runs one transformation step on p. ok is false when a lookup
+// step (fs, resolver, map) cannot resolve the path.
+func (c *Casefold) applyStep(r *http.Request, p, step string) (string, bool, error) {
+	switch step {
+	case "lower", "upper", "title", "ascii", "fold":
+		return c.caserFor(r).String(c.norm.String(p)), true, nil
+	case "nfc", "nfd":
+		return normalizer(step).String(p), true, nil
+	case "fs":
+		canon, ok, source, err := c.lookupRoot(r, p)
+		for i := 0; !ok && err == nil && i < len(c.fallbacks); i++ {
+			canon, ok, source, err = c.fallbacks[i].lookupRoot(r, p)
+		}
+		if source != "" {
+			traceFSLookup(r, source)
+		}
+		if !ok && err == nil && c.Suggest > 0 {
+			c.publishSuggestions(r, p)
+		}
+		if !ok && err == nil && c.Fallback != "" {
+			return c.fsFallback(p)
+		}
+		return canon, ok, err
+	case "resolver", "map":
+		canon, ok := c.resolve(r, p)
+		return canon, ok, nil
+	}
+	out, ok := c.applyTransformer(r, p, step)
+	return out, ok, nil
+}
+
+// modeName returns the normalized Mode.
+func (c *Casefold) modeName() string {
+	return strings.ToLower(strings.TrimSpace(c.Mode))
+}
+
+// rejectPath returns why r, with path orig, must fail with 400 under
+// RejectInvalidPaths, ReservedNames, MixedScripts, EncodedSlashes or
+// DotSegments, or nil. Under MixedScripts log it logs a mixed segment.
+func (c *Casefold) rejectPath(r *http.Request, orig string) error {
+	if err := c.rejectInvalidPath(orig); err != nil {
+		return err
+	}
+	if err := c.rejectReserved(orig); err != nil {
+		return err
+	}
+	if err := c.checkMixedScripts(orig); err != nil {
+		return err
+	}
+	if err := c.rejectEncodedSlashes(r); err != nil {
+		return err
+	}
+	return c.rejectDotSegments(orig)
+}
+
+// annotate records what the middleware did in the request's replacer:
+//
+//	{http.casefold.original_path}  path as received
+//	{http.casefold.path}           canonical path (after transformation)
+//	{http.casefold.rewritten}      whether the request path was rewritten
+//
+// and in request vars (casefold.original_path, casefold.rewritten and
+// casefold.mode) for `vars` matchers and access logs.
+func (c *Casefold) annotate(r *http.Request, orig, canon string, rewritten bool) {
+	caddyhttp.SetVar(r.Context(), "casefold.original_path", orig)
+	caddyhttp.SetVar(r.Context(), "casefold.rewritten", rewritten)
+	caddyhttp.SetVar(r.Context(), "casefold.mode", c.modeOrDefault())
+	traceDecision(r, orig, canon, rewritten, c.modeOrDefault())
+	if c.LogFields {
+		if extra, ok := r.Context().Value(caddyhttp.ExtraLogFieldsCtxKey).(*caddyhttp.ExtraLogFields); ok {
+			extra.Set(zap.String("casefold.original_path", orig))
+			extra.Set(zap.String("casefold.path", canon))
+			extra.Set(zap.Bool("casefold.rewritten", rewritten))
+			extra.Set(zap.String("casefold.mode", c.modeOrDefault()))
+		}
+	}
+	repl, ok := r.Context().Value(caddy.ReplacerCtxKey).(*caddy.Replacer)
+	if !ok {
+		return
+	}
+	repl.Set("http.casefold.original_path", orig)
+	repl.Set("http.casefold.path", canon)
+	repl.Set("http.casefold.rewritten", rewritten)
+}
+
+// serverTiming formats d as a Server-Timing entry in milliseconds.
+func serverTiming(d time.Duration) string {
+	return "casefold;dur=" + strconv.FormatFloat(float64(d)/float64(time.Millisecond), 'f', 3, 64)
+}
+
+// modeOrDefault names the configured transformation for logs, metrics and
+// placeholders: the mode with the implicit default spelled out, or the
+// transforms steps joined with "+".
+func (c *Casefold) modeOrDefault() string {
+	if len(c.steps) > 0 {
+		return strings.Join(c.steps, "+")
+	}
+	if m := c.modeName(); m != "" {
+		return m
+	}
+	return "lower"
+}
+
+// rewriteQuery applies the configured query normalizations to r, keeping
+// RequestURI in sync when the query changes.
+func (c *Casefold) rewriteQuery(r *http.Request) {
+	raw := r.URL.RawQuery
+	q := raw
+	if len(c.FoldQueryValues) > 0 {
+		q = foldQueryValues(q, c.FoldQueryValues, c.queryCaser())
+	}
+	if c.CanonicalQuery {
+		q = canonicalQuery(q, c.queryCaser())
+	} else if c.FoldQueryKeys {
+		q = foldQueryKeys(q, c.queryCaser())
+	}
+	if q == raw {
+		return
+	}
+	r.URL.RawQuery = q
+	if c.rewritesRequestURI() {
+		r.RequestURI = r.URL.RequestURI()
+	}
+}
+
+// rewritesRequestURI reports whether RequestURI follows URL rewrites.
+func (c *Casefold) rewritesRequestURI() bool {
+	return c.RewriteRequestURI == nil || *c.RewriteRequestURI
+}
+
+// queryCaser returns the transformation applied to query keys.
+func (c *Casefold) queryCaser() caser {
+	if c.fold != nil {
+		return c.fold
+	}
+	return lowerCaser{}
+}
+
+// absoluteURL returns the absolute URL of path p (plus the current query)
+// on the host r was addressed to.
+func absoluteURL(r *http.Request, p string) string {
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	u := url.URL{Scheme: scheme, Host: r.Host, Path: p, RawQuery: r.URL.RawQuery}
+	return u.String()
+}
+
+// relativeRef builds a relative URL reference (for Location or
+// Content-Location) from path p and the raw query q. Leading slashes are
+// collapsed so the result can never be mistaken for a protocol-relative
+// URL pointing at another host.
+func relativeRef(p, q string) string {
+	return relativeRawRef(p, "", q)
+}
+
+// relativeRawRef is relativeRef with raw, if set, as the escaped path.
+func relativeRawRef(p, raw, q string) string {
+	if strings.HasPrefix(p, "//") {
+		p = "/" + strings.TrimLeft(p, "/")
+		raw = ""
+	}
+	u := url.URL{Path: p, RawPath: raw, RawQuery: q}
+	return u.String()
+}
+
+// resolveFS returns the canonical on-disk casing of p, using the preloaded
+// index when available and otherwise consulting the resolution cache first
+// when one is configured. Cache keys are the cleaned, lowercased path so they
+// line up with watcher invalidations; only successful resolutions are cached,
+// and only when they do not depend on the request's casing.
+// Concurrent disk resolutions of the same path are coalesced so only one
+// goroutine walks the directories.
+func (c *Casefold) resolveFS(p string) (string, bool) {
+	canon, ok, _, _ := c.lookupFS(p)
+	return canon, ok
+}
+
+// Where lookupFS found (or failed to find) a resolution.
+const (
+	fsSourceIndex = "index"
+	fsSourceCache = "cache"
+	fsSourceDisk  = "disk"
+)
+
+// lookupFS is resolveFS that also reports which of the fsSource* layers
+// answered, and returns an *ambiguousPathError when the Ambiguity policy
+// refuses to choose between colliding entries.
+func (c *Casefold) lookupFS(p string) (string, bool, string, error) {
+	if c.state == nil {
+		canon, ok, err := c.canonicalFS(p)
+		canon, ok = countFSResult(canon, ok)
+		return canon, ok, fsSourceDisk, err
+	}
+	if c.state.index != nil {
+		canon, ok, err := c.lookupIndex(p)
+		canon, ok = countFSResult(canon, ok)
+		return canon, ok, fsSourceIndex, err
+	}
+	clean := path.Clean(p)
+	key := foldedKey(c.norm.String(clean))
+	if c.state.cache != nil {
+		if canon, ok := c.state.cache.Get(key); ok {
+			if c.Verbose && c.log != nil {
+				c.log.Debug("casefold fs cache hit", zap.String("path", p), zap.String("canonical", canon))
+			}
+			casefoldMetrics.fsCacheHits.Inc()
+			if canon == "" {
+				casefoldMetrics.fsResolveFailure.Inc()
+				return p, false, fsSourceCache, nil
+			}
+			return canon, true, fsSourceCache, nil
+		}
+		casefoldMetrics.fsCacheMisses.Inc()
+	}
+	// coalesce on the exact cleaned path: differently cased requests may
+	// legitimately resolve to different entries when names collide
+	v, _, _ := c.state.flight.Do(clean, func() (any, error) {
+		res := c.resolveDisk(clean)
+		if res.cacheable && c.state.cache != nil {
+			if res.ok {
+				c.state.cache.Put(key, res.canon)
+			} else if c.NegativeCacheTTL > 0 {
+				c.state.cache.PutMiss(key, time.Duration(c.NegativeCacheTTL))
+			}
+		}
+		return res, nil
+	})
+	res := v.(fsResult)
+	if !res.ok {
+		casefoldMetrics.fsResolveFailure.Inc()
+		return p, false, fsSourceDisk, res.err
+	}
+	return res.canon, true, fsSourceDisk, nil
+}
+
+// lookupIndex resolves p from the preloaded index, applying the Ambiguity
+// policy when several entries share its folded path.
+func (c *Casefold) lookupIndex(p string) (string, bool, error) {
+	if cands := c.state.index.Candidates(p); len(cands) > 1 {
+		canon, err := c.choose(path.Clean(p), cands)
+		if err != nil {
+			return p, false, err
+		}
+		return canon, true, nil
+	}
+	canon, ok := c.state.index.Lookup(p)
+	return canon, ok, nil
+}
+
+// foldedKey is the cleaned, lowercased form of p used to key caches and
+// resolver lookups.
+func foldedKey(p string) string {
+	return strings.ToLower(path.Clean(p))
+}
+
+// fsResult carries a disk resolution through singleflight. A failed
+// result is cacheable only when the path was found not to exist.
+type fsResult struct {
+	canon     string
+	ok        bool
+	cacheable bool
+	err       error
+}
+
 // canonicalFS attempts to replace each path segment with the actual casing
-// found on disk under Root. Returns (newPath, true) on success. If Root is empty,
-// a segment is missing, or a security check fails, returns original path, false.
-func (c *Casefold) canonicalFS(p string) (string, bool) {
-	if c.Root == "" {
-		return p, false
+// found under Root. Returns (newPath, true) on success. If no filesystem is
+// configured, a segment is missing, or a security check fails, returns
+// original path, false. When several entries of a directory match a segment
+// case-insensitively, the Ambiguity policy picks one; under "error" an
+// *ambiguousPathError is returned instead.
+func (c *Casefold) canonicalFS(p string) (string, bool, error) {
+	res := c.resolveDisk(p)
+	return res.canon, res.ok, res.err
+}
+
+// resolveDisk implements canonicalFS. The result is marked cacheable unless
+// the choice between colliding entries depended on the request's casing, in
+// which case caching it under the folded key would answer differently cased
+// requests wrongly. Failures are cacheable only when a segment is missing,
+// not when a check or limit stopped the walk.
+func (c *Casefold) resolveDisk(p string) fsResult {
+	fail := fsResult{canon: p}
+	if c.fsys == nil {
+		return fail
 	}
 	clean := path.Clean(p)
 	if !strings.HasPrefix(clean, "/") {
-		return p, false
+		return fail
 	}
 	if clean == "/" {
-		return p, false
+		return fail
 	}
 	segs := strings.Split(strings.TrimPrefix(clean, "/"), "/")
-	curDir := c.Root
+	curDir := "."
 	// prevent traversal outside root: reject any segment with '..'
 	for _, s := range segs {
 		if s == ".." {
-			return p, false
+			return fail
 		}
 	}
+	if len(segs) > c.maxSegments() {
+		return fail
+	}
+	if c.state != nil && c.state.caseInsensitive && !c.FullResolve {
+		return c.statDisk(clean)
+	}
+	var deadline time.Time
+	if c.ResolveTimeout > 0 {
+		deadline = time.Now().Add(time.Duration(c.ResolveTimeout))
+	}
+	// dirInfo is curDir's FileInfo, needed to validate cached listings
+	var dirInfo fs.FileInfo
+	if c.state != nil && c.state.dirs != nil {
+		dirInfo, _ = fs.Stat(c.fsys, curDir)
+	}
+	cacheable := true
 	built := make([]string, 0, len(segs))
 	for i, seg := range segs {
-		entries, err := os.ReadDir(curDir)
+		names, err := c.matchNames(curDir, dirInfo, c.norm.fold(seg), deadline)
 		if err != nil {
-			return p, false
-		}
-		var matchName string
-		// first attempt exact match
-		for _, e := range entries {
-			name := e.Name()
-			if name == seg {
-				matchName = name
-				break
+			if errors.Is(err, errResolveLimit) && c.Verbose && c.log != nil {
+				c.log.Debug("casefold fs resolution aborted", zap.String("path", p), zap.Error(err))
 			}
+			return fail
+		}
+		matches := make([]string, 0, len(names))
+		for _, name := range names {
+			matches = append(matches, "/"+path.Join(curDir, name))
 		}
-		if matchName == "" {
-			// case-insensitive search
-			lowered := strings.ToLower(seg)
-			for _, e := range entries {
-				if strings.ToLower(e.Name()) == lowered {
-					matchName = e.Name()
-					break
+		if len(matches) == 0 {
+			fail.cacheable = cacheable
+			return fail
+		}
+		chosen := matches[0]
+		if len(matches) > 1 {
+			want := "/" + path.Join(curDir, seg)
+			c.emitConflict(c.norm.fold(want), matches)
+			chosen, err = c.choose(want, matches)
+			if err != nil {
+				// point the candidates at the full request path; the rest
+				// is resolved when the client follows one of them
+				var amb *ambiguousPathError
+				if errors.As(err, &amb) && i < len(segs)-1 {
+					rest := strings.Join(segs[i+1:], "/")
+					for k, cand := range amb.Candidates {
+						amb.Candidates[k] = cand + "/" + rest
+					}
 				}
+				fail.err = err
+				return fail
 			}
+			cacheable = cacheable && !ambiguityDependsOnRequest(c.Ambiguity)
 		}
-		if matchName == "" {
-			return p, false
-		}
+		matchName := path.Base(chosen)
 		built = append(built, matchName)
 		if i < len(segs)-1 { // descend only if not final segment
-			curDir = filepath.Join(curDir, matchName)
-			// optional: if it's not a dir we can stop early
-			fi, err := os.Stat(curDir)
+			curDir = path.Join(curDir, matchName)
+			// stop early if an intermediate segment is not a directory
+			fi, err := fs.Stat(c.fsys, curDir)
 			if err != nil || !fi.IsDir() {
-				if i != len(segs)-1 {
-					return p, false
-				}
+				fail.cacheable = cacheable && (err == nil || errors.Is(err, fs.ErrNotExist))
+				return fail
 			}
+			dirInfo = fi
 		}
 	}
-	return "/" + strings.Join(built, "/"), true
+	return fsResult{canon: "/" + strings.Join(built, "/"), ok: true, cacheable: cacheable}
 }
 
 // skip returns true if the path matches an exclude pattern.
 func (c *Casefold) skip(p string) bool { return c.matchExclude(p) != "" } // backwards compat (unused internally now)
 
-// matchExclude returns the first matching exclusion pattern or empty string.
+// matchExclude returns a matching exclusion pattern or empty string.
 func (c *Casefold) matchExclude(p string) string {
-	for _, gl := range c.Exclude {
+	if c.excludes != nil {
+		return c.excludes.Match(p)
+	}
+	patterns := c.Exclude
+	if c.ExcludeIgnoreCase {
+		p = c.norm.fold(p)
+	}
+	for _, gl := range patterns {
 		if gl == "" {
 			continue
 		}
-		if ok, _ := path.Match(gl, p); ok {
+		pat := gl
+		if c.ExcludeIgnoreCase {
+			pat = c.norm.fold(gl)
+		}
+		if globMatch(pat, p) {
 			return gl
 		}
 	}
@@ -229,57 +1441,54 @@ type lowerCaser struct{}
 
 func (lowerCaser) String(s string) string { return strings.ToLower(s) }
 
+// upperCaser provides a simple Unicode upper mapping using strings.ToUpper.
+type upperCaser struct{}
+
+func (upperCaser) String(s string) string { return strings.ToUpper(s) }
+
+// titleCaser capitalizes the first letter of every word of a path, where
+// words are separated by '/', '-' and '_', and lowercases the rest:
+// /about-us/our_team.html becomes /About-Us/Our_Team.html.
+type titleCaser struct{ lower, upper caser }
+
+func (tc titleCaser) String(s string) string {
+	var b strings.Builder
+	b.Grow(len(s))
+	for len(s) > 0 {
+		i := strings.IndexAny(s, "/-_")
+		if i == 0 {
+			b.WriteByte(s[0])
+			s = s[1:]
+			continue
+		}
+		word := s
+		if i > 0 {
+			word, s = s[:i], s[i:]
+		} else {
+			s = ""
+		}
+		word = tc.lower.String(word)
+		_, size := utf8.DecodeRuneInString(word)
+		b.WriteString(tc.upper.String(word[:size]))
+		b.WriteString(word[size:])
+	}
+	return b.String()
+}
+
+// asciiCaser lowercases and then strips diacritics (é→e, ü→u). Lowercasing
+// first lets locale rules see the marks (Turkish İ carries its dot). Letters
+// without a decomposition, such as ß, æ or ø, are left as they are.
+type asciiCaser struct{ lower caser }
+
+func (ac asciiCaser) String(s string) string { return stripMarks(ac.lower.String(s)) }
+
 // Interface guards
 var _ caddy.Module = (*Casefold)(nil)
 var _ caddyhttp.MiddlewareHandler = (*Casefold)(nil)
+var _ caddy.CleanerUpper = (*Casefold)(nil)
+var _ caddy.Validator = (*Casefold)(nil)
 
 func init() {
 	caddy.RegisterModule(Casefold{})
 	httpcaddyfile.RegisterHandlerDirective("casefold", parseCasefold)
 }
-
-// parseCasefold implements the Caddyfile parsing logic for the 'casefold' directive.
-// Syntax:
-//
-//	casefold {
-//	    mode <lower|fold|fs>
-//	    root <path>         # only for fs mode
-//	    exclude <pattern> [<pattern>...]
-//	    exclude <pattern>
-//	}
-//
-// Multiple 'exclude' lines are allowed; each can take one or more patterns.
-func parseCasefold(h httpcaddyfile.Helper) (caddyhttp.MiddlewareHandler, error) { //nolint:revive
-	c := new(Casefold)
-	for h.Next() { // 'casefold'
-		for h.NextBlock(0) {
-			token := h.Val()
-			switch token {
-			case "mode":
-				if !h.NextArg() {
-					return nil, h.ArgErr()
-				}
-				c.Mode = h.Val()
-			case "root":
-				if !h.NextArg() {
-					return nil, h.ArgErr()
-				}
-				c.Root = h.Val()
-			case "exclude":
-				if !h.NextArg() {
-					return nil, h.ArgErr()
-				}
-				c.Exclude = append(c.Exclude, h.Val())
-				// consume any additional patterns on same line
-				for h.NextArg() {
-					c.Exclude = append(c.Exclude, h.Val())
-				}
-			case "verbose":
-				c.Verbose = true
-			default:
-				return nil, h.Errf("unrecognized subdirective %q", token)
-			}
-		}
-	}
-	return c, nil
-}
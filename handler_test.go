@@ -5,9 +5,14 @@ import (
 	"net/http/httptest"
 	"os"
 	"path/filepath"
+	"strings"
+	"sync"
 	"testing"
+	"testing/fstest"
+	"time"
 
 	"github.com/caddyserver/caddy/v2"
+	"golang.org/x/text/language"
 )
 
 type recordHandler struct{ t *testing.T }
@@ -52,6 +57,23 @@ func TestCasefoldExclude(t *testing.T) {
 	}
 }
 
+func TestCasefoldExcludeIgnoreCase(t *testing.T) {
+	c := &Casefold{Mode: "lower", Exclude: []string{"/API/*"}, ExcludeIgnoreCase: true}
+	if err := c.Provision(caddy.Context{}); err != nil {
+		t.Fatal(err)
+	}
+	for _, p := range []string{"/api/Foo", "/Api/Foo", "/API/Foo"} {
+		rr := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, "http://example.test"+p, nil)
+		if err := c.ServeHTTP(rr, req, recordHandler{t}); err != nil {
+			t.Fatal(err)
+		}
+		if got := rr.Header().Get("X-Final-Path"); got != p {
+			t.Errorf("expected %s excluded, got %s", p, got)
+		}
+	}
+}
+
 func TestCasefoldFoldMode(t *testing.T) {
 	c := &Casefold{Mode: "fold"}
 	if err := c.Provision(caddy.Context{}); err != nil {
@@ -91,3 +113,543 @@ func TestCasefoldFSMode(t *testing.T) {
 		t.Fatalf("expected canonical FS path /scripts/MyScript.bat, got %s", got)
 	}
 }
+
+func TestCasefoldRedirect(t *testing.T) {
+	c := &Casefold{Mode: "lower", Redirect: true}
+	if err := c.Provision(caddy.Context{}); err != nil {
+		t.Fatal(err)
+	}
+	rr := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "http://example.test/HeLLo?Q=A", nil)
+	if err := c.ServeHTTP(rr, req, recordHandler{t}); err != nil {
+		t.Fatal(err)
+	}
+	if rr.Code != http.StatusPermanentRedirect {
+		t.Fatalf("expected status 308, got %d", rr.Code)
+	}
+	if got := rr.Header().Get("Location"); got != "/hello?Q=A" {
+		t.Fatalf("expected Location /hello?Q=A, got %s", got)
+	}
+	if got := rr.Header().Get("X-Final-Path"); got != "" {
+		t.Fatalf("expected next handler not to run, got path %s", got)
+	}
+}
+
+func TestCasefoldRedirectMethods(t *testing.T) {
+	c := &Casefold{Mode: "lower", Redirect: true, RedirectMethods: []string{"GET", "head"}}
+	if err := c.Provision(caddy.Context{}); err != nil {
+		t.Fatal(err)
+	}
+	for method, redirected := range map[string]bool{
+		http.MethodGet:    true,
+		http.MethodHead:   true,
+		http.MethodPost:   false,
+		http.MethodDelete: false,
+	} {
+		rr := httptest.NewRecorder()
+		if err := c.ServeHTTP(rr, httptest.NewRequest(method, "/HeLLo", nil), recordHandler{t}); err != nil {
+			t.Fatal(err)
+		}
+		if redirected && (rr.Code != http.StatusPermanentRedirect || rr.Header().Get("Location") != "/hello") {
+			t.Errorf("%s: expected a redirect to /hello, got %d %q", method, rr.Code, rr.Header().Get("Location"))
+		}
+		if !redirected && rr.Header().Get("X-Final-Path") != "/hello" {
+			t.Errorf("%s: expected a rewrite to /hello, got %d %q", method, rr.Code, rr.Header().Get("X-Final-Path"))
+		}
+	}
+	if err := (&Casefold{RedirectMethods: []string{"GET"}}).Provision(caddy.Context{}); err == nil {
+		t.Error("redirect_methods without redirect accepted")
+	}
+}
+
+func TestRedirectLocationNoHostEscape(t *testing.T) {
+	if got := relativeRef("//evil.test/x", ""); got != "/evil.test/x" {
+		t.Fatalf("expected leading slashes collapsed, got %s", got)
+	}
+}
+
+func TestCasefoldRedirectCodeAndQuery(t *testing.T) {
+	c := &Casefold{Mode: "lower", Redirect: true, RedirectCode: http.StatusFound, RedirectDropQuery: true}
+	if err := c.Provision(caddy.Context{}); err != nil {
+		t.Fatal(err)
+	}
+	rr := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "http://example.test/HeLLo?Q=A", nil)
+	if err := c.ServeHTTP(rr, req, recordHandler{t}); err != nil {
+		t.Fatal(err)
+	}
+	if rr.Code != http.StatusFound {
+		t.Fatalf("expected status 302, got %d", rr.Code)
+	}
+	if got := rr.Header().Get("Location"); got != "/hello" {
+		t.Fatalf("expected Location /hello, got %s", got)
+	}
+
+	bad := &Casefold{Redirect: true, RedirectCode: http.StatusOK}
+	if err := bad.Provision(caddy.Context{}); err == nil {
+		t.Fatal("expected error for invalid redirect code")
+	}
+}
+
+func TestCasefoldFSModeCache(t *testing.T) {
+	root := t.TempDir()
+	if err := os.WriteFile(filepath.Join(root, "Index.HTML"), nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	c := &Casefold{Mode: "fs", Root: root, CacheSize: 8}
+	if err := c.Provision(caddy.Context{}); err != nil {
+		t.Fatal(err)
+	}
+	serve := func() string {
+		rr := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, "http://example.test/index.html", nil)
+		if err := c.ServeHTTP(rr, req, recordHandler{t}); err != nil {
+			t.Fatal(err)
+		}
+		return rr.Header().Get("X-Final-Path")
+	}
+	if got := serve(); got != "/Index.HTML" {
+		t.Fatalf("expected /Index.HTML, got %s", got)
+	}
+	// remove the file: a cached resolution must still be served
+	if err := os.Remove(filepath.Join(root, "Index.HTML")); err != nil {
+		t.Fatal(err)
+	}
+	if got := serve(); got != "/Index.HTML" {
+		t.Fatalf("expected cached /Index.HTML, got %s", got)
+	}
+}
+
+func TestCasefoldFSModeNegativeCache(t *testing.T) {
+	root := t.TempDir()
+	c := &Casefold{Mode: "fs", Root: root, CacheSize: 8, NegativeCacheTTL: caddy.Duration(time.Minute)}
+	if err := c.Provision(caddy.Context{}); err != nil {
+		t.Fatal(err)
+	}
+	defer c.Cleanup()
+	now := time.Now()
+	c.state.cache.now = func() time.Time { return now }
+	if _, ok := c.resolveFS("/new.html"); ok {
+		t.Fatal("expected /new.html not to resolve")
+	}
+	if err := os.WriteFile(filepath.Join(root, "New.HTML"), nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := c.resolveFS("/NEW.html"); ok {
+		t.Fatal("expected the cached miss to answer every casing")
+	}
+	now = now.Add(2 * time.Minute)
+	if got, ok := c.resolveFS("/new.html"); !ok || got != "/New.HTML" {
+		t.Fatalf("expected /New.HTML once the miss expired, got %q %v", got, ok)
+	}
+
+	if err := (&Casefold{Mode: "fs", Root: root, NegativeCacheTTL: caddy.Duration(time.Minute)}).Provision(caddy.Context{}); err == nil {
+		t.Error("negative_cache_ttl without cache_size accepted")
+	}
+}
+
+func TestCasefoldFSModeWatchInvalidates(t *testing.T) {
+	root := t.TempDir()
+	if err := os.WriteFile(filepath.Join(root, "Index.HTML"), nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	c := &Casefold{Mode: "fs", Root: root, CacheSize: 8, Watch: true}
+	if err := c.Provision(caddy.Context{}); err != nil {
+		t.Fatal(err)
+	}
+	defer c.Cleanup()
+	serve := func() string {
+		rr := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, "http://example.test/index.html", nil)
+		if err := c.ServeHTTP(rr, req, recordHandler{t}); err != nil {
+			t.Fatal(err)
+		}
+		return rr.Header().Get("X-Final-Path")
+	}
+	if got := serve(); got != "/Index.HTML" {
+		t.Fatalf("expected /Index.HTML, got %s", got)
+	}
+	if err := os.Rename(filepath.Join(root, "Index.HTML"), filepath.Join(root, "INDEX.html")); err != nil {
+		t.Fatal(err)
+	}
+	deadline := time.Now().Add(2 * time.Second)
+	for c.state.cache.Len() > 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if got := serve(); got != "/INDEX.html" {
+		t.Fatalf("expected renamed /INDEX.html after invalidation, got %s", got)
+	}
+}
+
+func TestCasefoldFSModePreload(t *testing.T) {
+	root := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(root, "Assets"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(root, "Assets", "Logo.PNG"), nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	c := &Casefold{Mode: "fs", Root: root, Preload: true}
+	if err := c.Provision(caddy.Context{}); err != nil {
+		t.Fatal(err)
+	}
+	// files added after provisioning are invisible without watch
+	if err := os.WriteFile(filepath.Join(root, "Late.txt"), nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	for in, want := range map[string]string{
+		"/assets/logo.png": "/Assets/Logo.PNG",
+		"/late.txt":        "/late.txt",
+	} {
+		rr := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, "http://example.test"+in, nil)
+		if err := c.ServeHTTP(rr, req, recordHandler{t}); err != nil {
+			t.Fatal(err)
+		}
+		if got := rr.Header().Get("X-Final-Path"); got != want {
+			t.Errorf("%s: expected %s, got %s", in, want, got)
+		}
+	}
+}
+
+func TestCasefoldFSModeConcurrent(t *testing.T) {
+	root := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(root, "A", "B"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	c := &Casefold{Mode: "fs", Root: root, CacheSize: 4}
+	if err := c.Provision(caddy.Context{}); err != nil {
+		t.Fatal(err)
+	}
+	defer c.Cleanup()
+	var wg sync.WaitGroup
+	for i := 0; i < 32; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if got, ok := c.resolveFS("/a/b"); !ok || got != "/A/B" {
+				t.Errorf("expected /A/B, got %q %v", got, ok)
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+func TestCasefoldFSModeVirtualFS(t *testing.T) {
+	c := &Casefold{Mode: "fs", fsys: fstest.MapFS{
+		"Docs/Intro.MD": &fstest.MapFile{},
+	}}
+	if got, ok, _ := c.canonicalFS("/docs/intro.md"); !ok || got != "/Docs/Intro.MD" {
+		t.Fatalf("expected /Docs/Intro.MD, got %q %v", got, ok)
+	}
+	if _, ok, _ := c.canonicalFS("/docs/intro.md/extra"); ok {
+		t.Fatal("expected file used as directory to be unresolved")
+	}
+}
+
+func TestCasefoldPreservesQueryInRequestURI(t *testing.T) {
+	c := &Casefold{Mode: "lower"}
+	if err := c.Provision(caddy.Context{}); err != nil {
+		t.Fatal(err)
+	}
+	rr := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "http://example.test/HeLLo%20There?a=B", nil)
+	if err := c.ServeHTTP(rr, req, recordHandler{t}); err != nil {
+		t.Fatal(err)
+	}
+	if req.RequestURI != "/hello%20there?a=B" {
+		t.Fatalf("expected RequestURI /hello%%20there?a=B, got %s", req.RequestURI)
+	}
+	if req.URL.RawQuery != "a=B" {
+		t.Fatalf("expected query a=B untouched, got %s", req.URL.RawQuery)
+	}
+}
+
+func TestCasefoldKeepRequestURI(t *testing.T) {
+	off := false
+	c := &Casefold{Mode: "lower", RewriteRequestURI: &off}
+	if err := c.Provision(caddy.Context{}); err != nil {
+		t.Fatal(err)
+	}
+	rr := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/Index.PHP?x=1", nil)
+	if err := c.ServeHTTP(rr, req, recordHandler{t}); err != nil {
+		t.Fatal(err)
+	}
+	if req.URL.Path != "/index.php" {
+		t.Fatalf("expected path rewritten, got %s", req.URL.Path)
+	}
+	if req.RequestURI != "/Index.PHP?x=1" {
+		t.Fatalf("expected RequestURI untouched, got %s", req.RequestURI)
+	}
+}
+
+func TestCasefoldOriginalURIHeaderName(t *testing.T) {
+	c := &Casefold{Mode: "lower", OriginalURIHeader: "X-Forwarded-Original-URI"}
+	if err := c.Provision(caddy.Context{}); err != nil {
+		t.Fatal(err)
+	}
+	rr := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "http://example.test/ABC", nil)
+	if err := c.ServeHTTP(rr, req, recordHandler{t}); err != nil {
+		t.Fatal(err)
+	}
+	if got := req.Header.Get("X-Forwarded-Original-URI"); got != "/ABC" {
+		t.Fatalf("expected custom request header /ABC, got %q", got)
+	}
+	if got := rr.Header().Get("X-Original-URI"); got != "" {
+		t.Fatalf("expected default header unset, got %q", got)
+	}
+}
+
+func TestCasefoldSuppressResponseHeader(t *testing.T) {
+	c := &Casefold{Mode: "lower", SuppressResponseHeader: true}
+	if err := c.Provision(caddy.Context{}); err != nil {
+		t.Fatal(err)
+	}
+	rr := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "http://example.test/ABC", nil)
+	if err := c.ServeHTTP(rr, req, recordHandler{t}); err != nil {
+		t.Fatal(err)
+	}
+	if got := rr.Header().Get("X-Original-URI"); got != "" {
+		t.Fatalf("expected no response header, got %q", got)
+	}
+	if got := req.Header.Get("X-Original-URI"); got != "/ABC" {
+		t.Fatalf("expected request header kept, got %q", got)
+	}
+}
+
+func TestCasefoldCanonicalLink(t *testing.T) {
+	c := &Casefold{Mode: "lower", CanonicalLink: true}
+	if err := c.Provision(caddy.Context{}); err != nil {
+		t.Fatal(err)
+	}
+	rr := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "https://Example.test/About?x=1", nil)
+	if err := c.ServeHTTP(rr, req, recordHandler{t}); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := rr.Header().Get("Link"), `<https://Example.test/about?x=1>; rel="canonical"`; got != want {
+		t.Fatalf("expected Link %s, got %s", want, got)
+	}
+
+	rr = httptest.NewRecorder()
+	req = httptest.NewRequest(http.MethodGet, "http://example.test/about", nil)
+	if err := c.ServeHTTP(rr, req, recordHandler{t}); err != nil {
+		t.Fatal(err)
+	}
+	if got := rr.Header().Get("Link"); got != "" {
+		t.Fatalf("expected no Link header without a rewrite, got %s", got)
+	}
+}
+
+func TestCasefoldContentLocation(t *testing.T) {
+	c := &Casefold{Mode: "lower", ContentLocation: true}
+	if err := c.Provision(caddy.Context{}); err != nil {
+		t.Fatal(err)
+	}
+	rr := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "http://example.test/Caf%C3%A9?v=2", nil)
+	if err := c.ServeHTTP(rr, req, recordHandler{t}); err != nil {
+		t.Fatal(err)
+	}
+	if got := rr.Header().Get("Content-Location"); got != "/caf%C3%A9?v=2" {
+		t.Fatalf("expected Content-Location /caf%%C3%%A9?v=2, got %s", got)
+	}
+}
+
+func TestCasefoldServerTiming(t *testing.T) {
+	c := &Casefold{Mode: "lower", ServerTiming: true}
+	if err := c.Provision(caddy.Context{}); err != nil {
+		t.Fatal(err)
+	}
+	rr := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "http://example.test/already-lower", nil)
+	if err := c.ServeHTTP(rr, req, recordHandler{t}); err != nil {
+		t.Fatal(err)
+	}
+	if got := rr.Header().Get("Server-Timing"); !strings.HasPrefix(got, "casefold;dur=") {
+		t.Fatalf("expected casefold Server-Timing entry, got %q", got)
+	}
+	if got := serverTiming(1500 * time.Microsecond); got != "casefold;dur=1.500" {
+		t.Fatalf("expected casefold;dur=1.500, got %q", got)
+	}
+}
+
+func TestCasefoldLocale(t *testing.T) {
+	for _, tc := range []struct {
+		locale, in, want string
+	}{
+		{"", "/KIRMIZI", "/kirmizi"},
+		{"tr", "/KIRMIZI", "/kırmızı"},
+		{"tr", "/İstanbul", "/istanbul"},
+		{"lt", "/Ì", "/i̇̀"},
+	} {
+		c := &Casefold{Mode: "lower", Locale: tc.locale}
+		if err := c.Provision(caddy.Context{}); err != nil {
+			t.Fatal(err)
+		}
+		rr := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.URL.Path = tc.in
+		if err := c.ServeHTTP(rr, req, recordHandler{t}); err != nil {
+			t.Fatal(err)
+		}
+		if got := rr.Header().Get("X-Final-Path"); got != tc.want {
+			t.Errorf("locale %q %s: expected %q, got %q", tc.locale, tc.in, tc.want, got)
+		}
+	}
+	if err := (&Casefold{Locale: "not a locale!"}).Provision(caddy.Context{}); err == nil {
+		t.Fatal("expected invalid locale to be rejected")
+	}
+}
+
+func TestLocaleCaserConcurrent(t *testing.T) {
+	lc := lowerFor(language.Turkish)
+	var wg sync.WaitGroup
+	for i := 0; i < 16; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				if got := lc.String("/IŞIK"); got != "/ışık" {
+					t.Errorf("expected /ışık, got %q", got)
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+func TestCasefoldAcceptLanguageLocale(t *testing.T) {
+	c := &Casefold{Mode: "lower", AcceptLanguageLocales: []string{"tr", "lt"}}
+	if err := c.Provision(caddy.Context{}); err != nil {
+		t.Fatal(err)
+	}
+	for _, tc := range []struct {
+		header, want string
+	}{
+		{"", "/ili"},
+		{"tr-TR,tr;q=0.9,en;q=0.8", "/ılı"},
+		{"en-US,de;q=0.5", "/ili"},
+		{"de, tr;q=0.3", "/ılı"},
+		{"not a header;;", "/ili"},
+	} {
+		rr := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, "/ILI", nil)
+		if tc.header != "" {
+			req.Header.Set("Accept-Language", tc.header)
+		}
+		if err := c.ServeHTTP(rr, req, recordHandler{t}); err != nil {
+			t.Fatal(err)
+		}
+		if got := rr.Header().Get("X-Final-Path"); got != tc.want {
+			t.Errorf("Accept-Language %q: expected %q, got %q", tc.header, tc.want, got)
+		}
+	}
+}
+
+func TestCasefoldUpperMode(t *testing.T) {
+	for _, tc := range []struct {
+		locale, in, want string
+	}{
+		{"", "/docs/Read_Me.txt", "/DOCS/READ_ME.TXT"},
+		{"tr", "/istanbul", "/İSTANBUL"},
+	} {
+		c := &Casefold{Mode: "upper", Locale: tc.locale}
+		if err := c.Provision(caddy.Context{}); err != nil {
+			t.Fatal(err)
+		}
+		rr := httptest.NewRecorder()
+		if err := c.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, tc.in, nil), recordHandler{t}); err != nil {
+			t.Fatal(err)
+		}
+		if got := rr.Header().Get("X-Final-Path"); got != tc.want {
+			t.Errorf("locale %q %s: expected %q, got %q", tc.locale, tc.in, tc.want, got)
+		}
+		if got := rr.Header().Get("X-Original-URI"); got != tc.in {
+			t.Errorf("expected original URI header %s, got %q", tc.in, got)
+		}
+	}
+}
+
+func TestCasefoldTitleMode(t *testing.T) {
+	for _, tc := range []struct {
+		locale, in, want string
+	}{
+		{"", "/about-us/OUR-TEAM", "/About-Us/Our-Team"},
+		{"", "/docs/read_me.txt", "/Docs/Read_Me.txt"},
+		{"", "//a--b/", "//A--B/"},
+		{"", "/élan", "/Élan"},
+		{"tr", "/istanbul-IZMIR", "/İstanbul-Izmır"},
+	} {
+		c := &Casefold{Mode: "title", Locale: tc.locale}
+		if err := c.Provision(caddy.Context{}); err != nil {
+			t.Fatal(err)
+		}
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		if got, _ := c.transform(req, tc.in); got != tc.want {
+			t.Errorf("locale %q %s: expected %q, got %q", tc.locale, tc.in, tc.want, got)
+		}
+	}
+}
+
+func TestCasefoldASCIIMode(t *testing.T) {
+	for _, tc := range []struct {
+		locale, in, want string
+	}{
+		{"", "/Café/Über.HTML", "/cafe/uber.html"},
+		{"", "/café", "/cafe"},
+		{"", "/Straße/Ærø", "/straße/ærø"},
+		{"", "/한국어", "/한국어"},
+		{"tr", "/İZMİR", "/izmir"},
+	} {
+		c := &Casefold{Mode: "ascii", Locale: tc.locale}
+		if err := c.Provision(caddy.Context{}); err != nil {
+			t.Fatal(err)
+		}
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		if got, _ := c.transform(req, tc.in); got != tc.want {
+			t.Errorf("locale %q %s: expected %q, got %q", tc.locale, tc.in, tc.want, got)
+		}
+	}
+}
+
+func TestCasefoldInjectedFS(t *testing.T) {
+	fsys := fstest.MapFS{
+		"site/Docs/Intro.html": {},
+		"other/README":         {},
+	}
+	c := &Casefold{Mode: "fs", FS: fsys, Root: "site", CacheSize: 10}
+	if err := c.Provision(caddy.Context{}); err != nil {
+		t.Fatal(err)
+	}
+	defer c.Cleanup()
+	for target, want := range map[string]string{
+		"/docs/intro.html": "/Docs/Intro.html",
+		"/readme":          "/readme", // outside Root
+	} {
+		rr := httptest.NewRecorder()
+		if err := c.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, target, nil), recordHandler{t}); err != nil {
+			t.Fatal(err)
+		}
+		if got := rr.Header().Get("X-Final-Path"); got != want {
+			t.Errorf("%s: expected %s, got %s", target, want, got)
+		}
+	}
+
+	shared := &Casefold{Mode: "fs", FS: fsys, Root: "site", CacheSize: 10}
+	if err := shared.Provision(caddy.Context{}); err != nil {
+		t.Fatal(err)
+	}
+	defer shared.Cleanup()
+	if shared.state != c.state {
+		t.Error("expected handlers on the same FS and root to share state")
+	}
+
+	if err := (&Casefold{Mode: "fs", FS: fsys, FileSystem: "assets"}).Provision(caddy.Context{}); err == nil {
+		t.Error("expected FS and file_system together to be rejected")
+	}
+}
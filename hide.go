@@ -0,0 +1,41 @@
+package casefold
+
+import (
+	"fmt"
+	"path"
+	"strings"
+)
+
+// provisionHide validates Hide and splits it into name and path patterns,
+// folded for case-insensitive matching.
+func (c *Casefold) provisionHide() error {
+	for _, p := range c.Hide {
+		if _, err := path.Match(p, ""); err != nil {
+			return fmt.Errorf("invalid hide pattern %q: %v", p, err)
+		}
+		if strings.Contains(p, "/") {
+			c.hidePaths = append(c.hidePaths, c.norm.fold(p))
+		} else {
+			c.hideNames = append(c.hideNames, c.norm.fold(p))
+		}
+	}
+	return nil
+}
+
+// hidden reports whether fs mode must not resolve to canon: it has a
+// dotfile segment (unless ShowHidden) or matches a Hide pattern. Matching
+// ignores case, so /.GIT is as hidden as /.git.
+func (c *Casefold) hidden(canon string) bool {
+	folded := c.norm.fold(canon)
+	for _, seg := range strings.Split(strings.TrimPrefix(folded, "/"), "/") {
+		if !c.ShowHidden && strings.HasPrefix(seg, ".") {
+			return true
+		}
+		for _, pat := range c.hideNames {
+			if ok, _ := path.Match(pat, seg); ok {
+				return true
+			}
+		}
+	}
+	return len(c.hidePaths) > 0 && matchUnder(c.hidePaths, folded)
+}
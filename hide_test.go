@@ -0,0 +1,62 @@
+package casefold
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/caddyserver/caddy/v2"
+)
+
+func TestHide(t *testing.T) {
+	root := t.TempDir()
+	for _, f := range []string{".git/config", ".env", "Private/Keys.txt", "Docs/Notes.BAK", "Docs/Intro.html"} {
+		p := filepath.Join(root, filepath.FromSlash(f))
+		if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, nil, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	serve := func(c *Casefold, p string) string {
+		rr := httptest.NewRecorder()
+		if err := c.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, p, nil), recordHandler{t}); err != nil {
+			t.Fatal(err)
+		}
+		return rr.Header().Get("X-Final-Path")
+	}
+
+	c := &Casefold{Mode: "fs", Root: root, Hide: []string{"*.bak", "/private/*"}}
+	if err := c.Provision(caddy.Context{}); err != nil {
+		t.Fatal(err)
+	}
+	defer c.Cleanup()
+	for in, want := range map[string]string{
+		"/.GIT/config":                "/.GIT/config",
+		"/.ENV":                       "/.ENV",
+		"/private/keys.txt":           "/private/keys.txt",
+		"/docs/notes.bak":             "/docs/notes.bak",
+		"/docs/intro.html":            "/Docs/Intro.html",
+		"/PRIVATE/../docs/INTRO.html": "/Docs/Intro.html",
+	} {
+		if got := serve(c, in); got != want {
+			t.Errorf("%s: expected %s, got %s", in, want, got)
+		}
+	}
+
+	shown := &Casefold{Mode: "fs", Root: root, ShowHidden: true}
+	if err := shown.Provision(caddy.Context{}); err != nil {
+		t.Fatal(err)
+	}
+	defer shown.Cleanup()
+	if got := serve(shown, "/.GIT/config"); got != "/.git/config" {
+		t.Errorf("expected show_hidden to resolve dotfiles, got %s", got)
+	}
+
+	if err := (&Casefold{Mode: "fs", Root: root, Hide: []string{"[a-"}}).Provision(caddy.Context{}); err == nil {
+		t.Error("expected invalid hide pattern to fail provisioning")
+	}
+}
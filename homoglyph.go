@@ -0,0 +1,96 @@
+package casefold
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+
+	"go.uber.org/zap"
+)
+
+// MixedScripts policies.
+const (
+	mixedScriptsBlock = "block"
+	mixedScriptsLog   = "log"
+	mixedScriptsFold  = "fold"
+)
+
+// confusableScripts are the scripts whose letters pass for one another;
+// a segment mixing two of them is suspect.
+var confusableScripts = []*unicode.RangeTable{unicode.Latin, unicode.Cyrillic, unicode.Greek, unicode.Armenian, unicode.Cherokee}
+
+// skeletons maps Cyrillic, Greek and Armenian letters to the Latin letters
+// they are drawn like, after Unicode's confusables data.
+var skeletons = strings.NewReplacer(
+	"а", "a", "в", "b", "е", "e", "к", "k", "м", "m", "н", "h", "о", "o", "р", "p", "с", "c", "т", "t", "у", "y", "х", "x",
+	"і", "i", "ј", "j", "ѕ", "s", "ԁ", "d", "һ", "h", "ԛ", "q", "ԝ", "w", "ӏ", "l",
+	"А", "A", "В", "B", "Е", "E", "К", "K", "М", "M", "Н", "H", "О", "O", "Р", "P", "С", "C", "Т", "T", "У", "Y", "Х", "X",
+	"І", "I", "Ј", "J", "Ѕ", "S", "Ԁ", "D", "Ԛ", "Q", "Ԝ", "W",
+	"α", "a", "ι", "i", "κ", "k", "ν", "v", "ο", "o", "ρ", "p", "τ", "t", "υ", "u", "χ", "x",
+	"Α", "A", "Β", "B", "Ε", "E", "Ζ", "Z", "Η", "H", "Ι", "I", "Κ", "K", "Μ", "M", "Ν", "N", "Ο", "O", "Ρ", "P", "Τ", "T", "Υ", "Y", "Χ", "X",
+	"օ", "o", "ս", "u", "հ", "h", "ց", "g", "զ", "q",
+)
+
+// mixedScript reports whether seg has letters from more than one of
+// confusableScripts. Digits, punctuation and letters of other scripts do
+// not count.
+func mixedScript(seg string) bool {
+	var seen *unicode.RangeTable
+	for _, r := range seg {
+		if r < unicode.MaxASCII && !unicode.IsLetter(r) {
+			continue
+		}
+		for _, script := range confusableScripts {
+			if !unicode.Is(script, r) {
+				continue
+			}
+			if seen != nil && seen != script {
+				return true
+			}
+			seen = script
+			break
+		}
+	}
+	return false
+}
+
+// mixedSegment returns the first segment of p mixing scripts, or "".
+func mixedSegment(p string) string {
+	for _, seg := range strings.Split(p, "/") {
+		if mixedScript(seg) {
+			return seg
+		}
+	}
+	return ""
+}
+
+// foldMixedScripts replaces the lookalike letters of every mixed segment
+// of p with their Latin skeletons. Single-script segments are kept, so
+// /Москва stays as it is while /pаypal (Cyrillic а) becomes /paypal.
+func foldMixedScripts(p string) string {
+	segs := strings.Split(p, "/")
+	for i, seg := range segs {
+		if mixedScript(seg) {
+			segs[i] = skeletons.Replace(seg)
+		}
+	}
+	return strings.Join(segs, "/")
+}
+
+// checkMixedScripts fails p under the block policy and logs it under log.
+func (c *Casefold) checkMixedScripts(p string) error {
+	if c.MixedScripts != mixedScriptsBlock && c.MixedScripts != mixedScriptsLog {
+		return nil
+	}
+	seg := mixedSegment(p)
+	if seg == "" {
+		return nil
+	}
+	if c.MixedScripts == mixedScriptsBlock {
+		return fmt.Errorf("mixed-script segment %q in path %q", seg, p)
+	}
+	if c.log != nil {
+		c.log.Warn("casefold mixed-script path segment", zap.String("path", p), zap.String("segment", seg))
+	}
+	return nil
+}
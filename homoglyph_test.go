@@ -0,0 +1,50 @@
+package casefold
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/caddyserver/caddy/v2"
+	"github.com/caddyserver/caddy/v2/modules/caddyhttp"
+)
+
+func TestMixedScripts(t *testing.T) {
+	for seg, want := range map[string]bool{
+		"pаypal":      true, // Cyrillic а
+		"paypal":      false,
+		"Москва":      false,
+		"Москва-2024": false,
+		"ΑΡΙΣ-dоcs":   true, // Greek with a Cyrillic о
+		"日本語abc":      false,
+	} {
+		if got := mixedScript(seg); got != want {
+			t.Errorf("mixedScript(%q) = %v, want %v", seg, got, want)
+		}
+	}
+
+	for policy, want := range map[string]string{"": "/pаypal/москва", "log": "/pаypal/москва", "fold": "/paypal/москва"} {
+		c := &Casefold{Mode: "lower", MixedScripts: policy}
+		if err := c.Provision(caddy.Context{}); err != nil {
+			t.Fatal(err)
+		}
+		rr := httptest.NewRecorder()
+		if err := c.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/P%D0%B0yPal/%D0%9C%D0%BE%D1%81%D0%BA%D0%B2%D0%B0", nil), recordHandler{t}); err != nil {
+			t.Fatal(err)
+		}
+		if got := rr.Header().Get("X-Final-Path"); got != want {
+			t.Errorf("%q: expected %s, got %s", policy, want, got)
+		}
+	}
+
+	c := &Casefold{Mode: "lower", MixedScripts: "block"}
+	if err := c.Provision(caddy.Context{}); err != nil {
+		t.Fatal(err)
+	}
+	err := c.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/p%D0%B0ypal", nil), recordHandler{t})
+	var herr caddyhttp.HandlerError
+	if !errors.As(err, &herr) || herr.StatusCode != http.StatusBadRequest {
+		t.Errorf("block: expected 400, got %v", err)
+	}
+}
@@ -0,0 +1,125 @@
+package casefold
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/caddyserver/caddy/v2"
+	"golang.org/x/net/idna"
+)
+
+// provisionHosts validates and provisions c.Hosts. Keys are lowercased; the
+// same config may be listed under several names.
+func (c *Casefold) provisionHosts(ctx caddy.Context) error {
+	if len(c.Hosts) == 0 {
+		return nil
+	}
+	hosts := make(map[string]*Casefold, len(c.Hosts))
+	provisioned := make(map[*Casefold]bool)
+	for name, hc := range c.Hosts {
+		key, err := hostKey(name)
+		if err != nil {
+			return err
+		}
+		if _, dup := hosts[key]; dup {
+			return fmt.Errorf("host %q configured twice", name)
+		}
+		if hc == nil {
+			return fmt.Errorf("host %q: missing configuration", name)
+		}
+		if len(hc.Hosts) > 0 {
+			return fmt.Errorf("host %q: hosts cannot be nested", name)
+		}
+		hosts[key] = hc
+		if provisioned[hc] {
+			continue
+		}
+		provisioned[hc] = true
+		hc.embedded = true
+		if err := hc.Provision(ctx); err != nil {
+			return fmt.Errorf("host %q: %v", name, err)
+		}
+	}
+	c.Hosts = hosts
+	return nil
+}
+
+// hostKey validates a Hosts or HostRoots key and returns it in the form of
+// canonicalHost.
+func hostKey(name string) (string, error) {
+	key := strings.ToLower(name)
+	if key == "" || strings.Contains(key[1:], "*") || (strings.HasPrefix(key, "*") && !strings.HasPrefix(key, "*.")) {
+		return "", fmt.Errorf("invalid host %q: must be a hostname or *.domain wildcard", name)
+	}
+	if rest, ok := strings.CutPrefix(key, "*."); ok {
+		return "*." + canonicalHost(rest), nil
+	}
+	return canonicalHost(key), nil
+}
+
+// canonicalHost returns host lowercased, without a trailing dot, and with
+// internationalized labels in their ASCII (punycode) form, so BüRO.example
+// and xn--bro-hoa.example compare equal. A host IDNA rejects, such as one
+// with an underscore, is only lowercased.
+func canonicalHost(host string) string {
+	host = strings.ToLower(strings.TrimSuffix(host, "."))
+	if ascii, err := idna.Lookup.ToASCII(host); err == nil {
+		return ascii
+	}
+	return host
+}
+
+// hostConfig returns the Hosts entry for r's host, or nil.
+func (c *Casefold) hostConfig(r *http.Request) *Casefold {
+	hc, _ := matchHost(c.Hosts, r)
+	return hc
+}
+
+// matchHost looks r's host up in m, keyed as by hostKey: an exact name,
+// else a wildcard covering its first label.
+func matchHost[T any](m map[string]T, r *http.Request) (T, bool) {
+	var zero T
+	if len(m) == 0 {
+		return zero, false
+	}
+	host := r.Host
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	host = canonicalHost(host)
+	if v, ok := m[host]; ok {
+		return v, true
+	}
+	if i := strings.IndexByte(host, '.'); i > 0 {
+		if v, ok := m["*"+host[i:]]; ok {
+			return v, true
+		}
+	}
+	return zero, false
+}
+
+// foldHost lowercases r's host under FoldHost.
+func (c *Casefold) foldHost(r *http.Request) {
+	if !c.FoldHost {
+		return
+	}
+	r.Host = strings.ToLower(r.Host)
+	r.URL.Host = strings.ToLower(r.URL.Host)
+}
+
+// cleanupHosts cleans up each distinct Hosts config once.
+func (c *Casefold) cleanupHosts() error {
+	done := make(map[*Casefold]bool)
+	for _, hc := range c.Hosts {
+		if done[hc] {
+			continue
+		}
+		done[hc] = true
+		if err := hc.Cleanup(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
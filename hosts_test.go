@@ -0,0 +1,110 @@
+package casefold
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/caddyserver/caddy/v2"
+	"github.com/caddyserver/caddy/v2/modules/caddyhttp"
+)
+
+func TestHosts(t *testing.T) {
+	upper := &Casefold{Mode: "upper"}
+	c := &Casefold{
+		Mode: "lower",
+		Hosts: map[string]*Casefold{
+			"Tenant-A.example.com": {Mode: "fold", Exclude: []string{"/API/*"}},
+			"*.example.com":        upper,
+			"legacy.example.net":   upper,
+		},
+	}
+	if err := c.Provision(caddy.Context{}); err != nil {
+		t.Fatal(err)
+	}
+	defer c.Cleanup()
+	for _, tc := range []struct{ host, path, want string }{
+		{"tenant-a.example.com", "/Straße", "/strasse"},
+		{"TENANT-A.example.com:8443", "/API/Keys", "/API/Keys"},
+		{"tenant-b.example.com", "/Docs", "/DOCS"},
+		{"legacy.example.net", "/Docs", "/DOCS"},
+		{"a.b.example.com", "/Docs", "/docs"}, // wildcards cover one label
+		{"other.test", "/Docs", "/docs"},
+	} {
+		req := httptest.NewRequest(http.MethodGet, "http://"+tc.host+tc.path, nil)
+		rr := httptest.NewRecorder()
+		if err := c.ServeHTTP(rr, req, recordHandler{t}); err != nil {
+			t.Fatal(err)
+		}
+		if got := rr.Header().Get("X-Final-Path"); got != tc.want {
+			t.Errorf("%s%s: expected %s, got %s", tc.host, tc.path, tc.want, got)
+		}
+	}
+}
+
+func TestHostsInvalid(t *testing.T) {
+	for _, hosts := range []map[string]*Casefold{
+		{"": {}},
+		{"a.*.example.com": {}},
+		{"*example.com": {}},
+		{"a.example.com": nil},
+		{"A.example.com": {}, "a.example.com": {}},
+		{"a.example.com": {Hosts: map[string]*Casefold{"b.example.com": {}}}},
+	} {
+		c := &Casefold{Hosts: hosts}
+		if err := c.Provision(caddy.Context{}); err == nil {
+			t.Errorf("expected hosts %v to fail provisioning", hosts)
+		}
+	}
+}
+
+func TestHostsIDN(t *testing.T) {
+	c := &Casefold{
+		Mode:      "lower",
+		Hosts:     map[string]*Casefold{"büro.example": {Mode: "upper"}, "*.Straße.example": {Mode: "upper"}},
+		HostRoots: map[string]string{"XN--BRO-HOA.example": t.TempDir()},
+	}
+	if err := c.Provision(caddy.Context{}); err != nil {
+		t.Fatal(err)
+	}
+	defer c.Cleanup()
+	if _, ok := c.HostRoots["xn--bro-hoa.example"]; !ok {
+		t.Errorf("expected roots keyed by punycode, got %v", c.HostRoots)
+	}
+	for _, host := range []string{"büro.example", "BüRO.example.", "xn--bro-hoa.example:8443", "www.xn--strae-oqa.example"} {
+		req := httptest.NewRequest(http.MethodGet, "http://example.test/Docs", nil)
+		req.Host = host
+		rr := httptest.NewRecorder()
+		if err := c.ServeHTTP(rr, req, recordHandler{t}); err != nil {
+			t.Fatal(err)
+		}
+		if got := rr.Header().Get("X-Final-Path"); got != "/DOCS" {
+			t.Errorf("%s: expected the host block's /DOCS, got %s", host, got)
+		}
+	}
+}
+
+func TestFoldHost(t *testing.T) {
+	for _, fold := range []bool{false, true} {
+		c := &Casefold{Mode: "lower", FoldHost: fold}
+		if err := c.Provision(caddy.Context{}); err != nil {
+			t.Fatal(err)
+		}
+		var got *http.Request
+		next := caddyhttp.HandlerFunc(func(_ http.ResponseWriter, r *http.Request) error {
+			got = r
+			return nil
+		})
+		req := httptest.NewRequest(http.MethodGet, "http://Example.COM:8080/docs", nil)
+		if err := c.ServeHTTP(httptest.NewRecorder(), req, next); err != nil {
+			t.Fatal(err)
+		}
+		want := "Example.COM:8080"
+		if fold {
+			want = "example.com:8080"
+		}
+		if got.Host != want || got.URL.Host != want {
+			t.Errorf("fold_host %v: expected host %s, got %s and URL host %s", fold, want, got.Host, got.URL.Host)
+		}
+	}
+}
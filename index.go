@@ -0,0 +1,202 @@
+package casefold
+
+import (
+	"io/fs"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// pathIndex is an in-memory map from lowercased slash paths (relative to a
+// root, with a leading slash) to their canonical on-disk casing. It turns
+// fs-mode resolution into a map lookup for mostly-static roots.
+type pathIndex struct {
+	mu    sync.RWMutex
+	paths map[string]string
+	// dups holds every canonical candidate for keys shared by more than one
+	// entry (e.g. README.md and Readme.md), in walk order.
+	dups map[string][]string
+	// dirs records which canonical paths are directories.
+	dirs map[string]struct{}
+	// norm is applied to paths before they are lowercased into keys.
+	norm normalizer
+}
+
+func newPathIndex() *pathIndex {
+	return &pathIndex{
+		paths: make(map[string]string),
+		dups:  make(map[string][]string),
+		dirs:  make(map[string]struct{}),
+	}
+}
+
+// buildIndex walks fsys and indexes every file and directory in it, keying
+// entries by their n-normalized, lowercased paths.
+func buildIndex(fsys fs.FS, n normalizer) (*pathIndex, error) {
+	idx := newPathIndex()
+	idx.norm = n
+	if err := idx.walk(fsys, "."); err != nil {
+		return nil, err
+	}
+	return idx, nil
+}
+
+// walk adds dir (a slash path within fsys) and everything below it.
+// Callers other than buildIndex must hold mu.
+func (idx *pathIndex) walk(fsys fs.FS, dir string) error {
+	return fs.WalkDir(fsys, dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if p == dir {
+				return err
+			}
+			return nil // unreadable subtree; leave it unindexed
+		}
+		if p == "." {
+			return nil
+		}
+		idx.add("/"+p, d.IsDir())
+		return nil
+	})
+}
+
+func (idx *pathIndex) add(canon string, dir bool) {
+	if dir {
+		idx.dirs[canon] = struct{}{}
+	}
+	key := idx.norm.fold(canon)
+	prev, exists := idx.paths[key]
+	if !exists {
+		idx.paths[key] = canon
+		return
+	}
+	if prev == canon {
+		return
+	}
+	if _, ok := idx.dups[key]; !ok {
+		idx.dups[key] = []string{prev}
+	}
+	idx.dups[key] = append(idx.dups[key], canon)
+}
+
+// Lookup returns the canonical casing of p. When several entries share the
+// same lowercased path, an exact match wins; otherwise the first entry in
+// walk (lexical) order is used.
+func (idx *pathIndex) Lookup(p string) (string, bool) {
+	clean := path.Clean(p)
+	key := idx.norm.fold(clean)
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+	canon, ok := idx.paths[key]
+	if !ok {
+		return p, false
+	}
+	for _, cand := range idx.dups[key] {
+		if cand == clean {
+			return cand, true
+		}
+	}
+	return canon, true
+}
+
+// Candidates returns every entry sharing p's lowercased path, in walk
+// order, or nil if there is at most one.
+func (idx *pathIndex) Candidates(p string) []string {
+	key := idx.norm.fold(path.Clean(p))
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+	if cands, ok := idx.dups[key]; ok {
+		return append([]string(nil), cands...)
+	}
+	return nil
+}
+
+// Refresh re-indexes rel (a slash path with a leading slash) after a
+// filesystem change: stale entries at and below rel are dropped and whatever
+// now exists there is walked again.
+func (idx *pathIndex) Refresh(fsys fs.FS, rel string) {
+	lower := idx.norm.fold(rel)
+	prefix := strings.TrimSuffix(lower, "/") + "/"
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+	for k := range idx.paths {
+		if k == lower || strings.HasPrefix(k, prefix) {
+			delete(idx.paths, k)
+			delete(idx.dups, k)
+		}
+	}
+	for d := range idx.dirs {
+		if k := idx.norm.fold(d); k == lower || strings.HasPrefix(k, prefix) {
+			delete(idx.dirs, d)
+		}
+	}
+	// keys sharing rel's folded name may still have surviving siblings (for
+	// example Readme.md after README.md was removed); re-walk the parent
+	// directory entries so they are restored.
+	parent := path.Dir(rel)
+	entries, err := fs.ReadDir(fsys, fsPath(parent))
+	if err != nil {
+		return
+	}
+	for _, e := range entries {
+		child := path.Join(parent, e.Name())
+		if idx.norm.fold(child) != lower {
+			continue
+		}
+		_ = idx.walk(fsys, fsPath(child))
+	}
+}
+
+// fsPath converts a slash path with a leading slash into an io/fs path.
+func fsPath(p string) string {
+	p = strings.Trim(path.Clean(p), "/")
+	if p == "" {
+		return "."
+	}
+	return p
+}
+
+// Entries returns every indexed canonical path, split into directories and
+// files, each sorted so that re-adding them reproduces walk order.
+func (idx *pathIndex) Entries() (dirs, files []string) {
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+	visit := func(canon string) {
+		if _, ok := idx.dirs[canon]; ok {
+			dirs = append(dirs, canon)
+		} else {
+			files = append(files, canon)
+		}
+	}
+	for key, canon := range idx.paths {
+		if cands, ok := idx.dups[key]; ok {
+			for _, c := range cands {
+				visit(c)
+			}
+			continue
+		}
+		visit(canon)
+	}
+	sort.Strings(dirs)
+	sort.Strings(files)
+	return dirs, files
+}
+
+// Conflicts returns a copy of every folded key shared by more than one
+// entry, mapped to its candidates in walk order.
+func (idx *pathIndex) Conflicts() map[string][]string {
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+	out := make(map[string][]string, len(idx.dups))
+	for key, cands := range idx.dups {
+		out[key] = append([]string(nil), cands...)
+	}
+	return out
+}
+
+// Len returns the number of distinct lowercased paths indexed.
+func (idx *pathIndex) Len() int {
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+	return len(idx.paths)
+}
@@ -0,0 +1,58 @@
+package casefold
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestPathIndexLookup(t *testing.T) {
+	root := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(root, "Docs", "Guides"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"Docs/Guides/Intro.md", "README.md", "Readme.md"} {
+		if err := os.WriteFile(filepath.Join(root, filepath.FromSlash(name)), nil, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	idx, err := buildIndex(os.DirFS(root), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for in, want := range map[string]string{
+		"/docs/guides/intro.md": "/Docs/Guides/Intro.md",
+		"/DOCS/":                "/Docs",
+		"/Readme.md":            "/Readme.md", // exact match wins among collisions
+		"/readme.MD":            "/README.md", // otherwise first in walk order
+	} {
+		if got, ok := idx.Lookup(in); !ok || got != want {
+			t.Errorf("Lookup(%q) = %q, %v; want %q", in, got, ok, want)
+		}
+	}
+	if _, ok := idx.Lookup("/missing"); ok {
+		t.Error("expected missing path to be unresolved")
+	}
+}
+
+func TestPathIndexRefresh(t *testing.T) {
+	root := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(root, "Old", "Sub"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	idx, err := buildIndex(os.DirFS(root), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Rename(filepath.Join(root, "Old"), filepath.Join(root, "New")); err != nil {
+		t.Fatal(err)
+	}
+	idx.Refresh(os.DirFS(root), "/Old")
+	idx.Refresh(os.DirFS(root), "/New")
+	if _, ok := idx.Lookup("/old/sub"); ok {
+		t.Error("expected renamed-away subtree to be dropped")
+	}
+	if got, ok := idx.Lookup("/new/sub"); !ok || got != "/New/Sub" {
+		t.Errorf("expected /New/Sub after refresh, got %q %v", got, ok)
+	}
+}
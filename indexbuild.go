@@ -0,0 +1,136 @@
+package casefold
+
+import (
+	"io/fs"
+	"path"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// indexEntry is one path found by a parallel index build.
+type indexEntry struct {
+	canon string
+	dir   bool
+}
+
+// buildIndexParallel is buildIndex with workers goroutines reading
+// directories concurrently. Entries are added in the order fs.WalkDir would
+// visit them, so collisions resolve exactly as in a sequential build. If
+// progress is not nil, it is increased by every entry found.
+func buildIndexParallel(fsys fs.FS, n normalizer, workers int, progress *atomic.Int64) (*pathIndex, error) {
+	if workers < 1 {
+		workers = 1
+	}
+	q := &dirQueue{dirs: []string{"."}, pending: 1}
+	q.cond = sync.NewCond(&q.mu)
+	var (
+		mu      sync.Mutex
+		found   []indexEntry
+		rootErr error
+		wg      sync.WaitGroup
+	)
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				dir, ok := q.pop()
+				if !ok {
+					return
+				}
+				entries, err := fs.ReadDir(fsys, dir)
+				if err != nil && dir == "." {
+					mu.Lock()
+					rootErr = err
+					mu.Unlock()
+				}
+				// like fs.WalkDir, leave unreadable subtrees unindexed
+				local := make([]indexEntry, 0, len(entries))
+				var subdirs []string
+				for _, e := range entries {
+					p := path.Join(dir, e.Name())
+					local = append(local, indexEntry{canon: "/" + p, dir: e.IsDir()})
+					if e.IsDir() {
+						subdirs = append(subdirs, p)
+					}
+				}
+				mu.Lock()
+				found = append(found, local...)
+				mu.Unlock()
+				if progress != nil {
+					progress.Add(int64(len(local)))
+				}
+				q.done(subdirs)
+			}
+		}()
+	}
+	wg.Wait()
+	if rootErr != nil {
+		return nil, rootErr
+	}
+	sort.Slice(found, func(i, j int) bool { return walkOrderLess(found[i].canon, found[j].canon) })
+	idx := newPathIndex()
+	idx.norm = n
+	for _, e := range found {
+		idx.add(e.canon, e.dir)
+	}
+	return idx, nil
+}
+
+// walkOrderLess reports whether fs.WalkDir visits a before b: segment by
+// segment in lexical order, parents before their children.
+func walkOrderLess(a, b string) bool {
+	as := strings.Split(a, "/")
+	bs := strings.Split(b, "/")
+	for i := 0; i < len(as) && i < len(bs); i++ {
+		if as[i] != bs[i] {
+			return as[i] < bs[i]
+		}
+	}
+	return len(as) < len(bs)
+}
+
+// dirQueue hands directories to index workers. pending counts directories
+// queued or being read; the build is done when it drops to zero.
+type dirQueue struct {
+	mu      sync.Mutex
+	cond    *sync.Cond
+	dirs    []string
+	pending int
+}
+
+// pop returns the next directory to read, waiting for one if others are
+// still being read, or false once every directory has been read.
+func (q *dirQueue) pop() (string, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for len(q.dirs) == 0 && q.pending > 0 {
+		q.cond.Wait()
+	}
+	if len(q.dirs) == 0 {
+		return "", false
+	}
+	dir := q.dirs[len(q.dirs)-1]
+	q.dirs = q.dirs[:len(q.dirs)-1]
+	return dir, true
+}
+
+// done marks a directory read and queues its subdirectories.
+func (q *dirQueue) done(subdirs []string) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.dirs = append(q.dirs, subdirs...)
+	q.pending += len(subdirs) - 1
+	q.cond.Broadcast()
+}
+
+// preloadWorkers returns the number of goroutines building the index.
+func (c *Casefold) preloadWorkers() int {
+	if c.PreloadWorkers > 0 {
+		return c.PreloadWorkers
+	}
+	return runtime.GOMAXPROCS(0)
+}
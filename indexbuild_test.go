@@ -0,0 +1,47 @@
+package casefold
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"sync/atomic"
+	"testing"
+	"testing/fstest"
+)
+
+func TestBuildIndexParallel(t *testing.T) {
+	fsys := fstest.MapFS{}
+	for _, f := range []string{
+		"Docs/Guide.md", "docs/guide.md", "DOCS/Index.html", "a-b/x", "A/B/C/d.txt", "a/b/c/D.txt",
+		"README.md", "Readme.md", "deep/1/2/3/4/5/6/7/8/leaf",
+	} {
+		fsys[f] = &fstest.MapFile{}
+	}
+	want, err := buildIndex(fsys, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, workers := range []int{1, 2, 8} {
+		var progress atomic.Int64
+		got, err := buildIndexParallel(fsys, "", workers, &progress)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(got.paths, want.paths) || !reflect.DeepEqual(got.dups, want.dups) || !reflect.DeepEqual(got.dirs, want.dirs) {
+			t.Errorf("%d workers: index differs from a sequential walk:\n got %v %v\nwant %v %v", workers, got.paths, got.dups, want.paths, want.dups)
+		}
+		entries := len(got.paths)
+		for _, cands := range got.dups {
+			entries += len(cands) - 1
+		}
+		if n := progress.Load(); n != int64(entries) {
+			t.Errorf("%d workers: progress %d, want %d", workers, n, entries)
+		}
+	}
+	if _, err := buildIndexParallel(fstest.MapFS{"file": &fstest.MapFile{}}, "", 4, nil); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := buildIndexParallel(os.DirFS(filepath.Join(t.TempDir(), "missing")), "", 4, nil); err == nil {
+		t.Error("expected an unreadable root to fail")
+	}
+}
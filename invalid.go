@@ -0,0 +1,33 @@
+package casefold
+
+import (
+	"fmt"
+	"unicode"
+	"unicode/utf8"
+)
+
+// invalidPath describes what makes p unfit to look up: a control
+// character (NUL included) or bytes that are not UTF-8. It is empty if p
+// is fine.
+func invalidPath(p string) string {
+	if !utf8.ValidString(p) {
+		return "invalid UTF-8"
+	}
+	for _, r := range p {
+		if unicode.IsControl(r) {
+			return fmt.Sprintf("control character %U", r)
+		}
+	}
+	return ""
+}
+
+// rejectInvalidPath fails p under RejectInvalidPaths.
+func (c *Casefold) rejectInvalidPath(p string) error {
+	if !c.RejectInvalidPaths {
+		return nil
+	}
+	if why := invalidPath(p); why != "" {
+		return fmt.Errorf("%s in path %q", why, p)
+	}
+	return nil
+}
@@ -0,0 +1,51 @@
+package casefold
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/caddyserver/caddy/v2"
+	"github.com/caddyserver/caddy/v2/modules/caddyhttp"
+)
+
+func TestRejectInvalidPaths(t *testing.T) {
+	c := &Casefold{Mode: "lower", RejectInvalidPaths: true}
+	if err := c.Provision(caddy.Context{}); err != nil {
+		t.Fatal(err)
+	}
+	for _, target := range []string{"/Docs%00.html", "/A%0Ab", "/caf%FF", "/x%C2%85y"} {
+		err := c.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, target, nil), recordHandler{t})
+		var herr caddyhttp.HandlerError
+		if !errors.As(err, &herr) || herr.StatusCode != http.StatusBadRequest {
+			t.Errorf("%s: expected 400, got %v", target, err)
+		}
+	}
+	rr := httptest.NewRecorder()
+	if err := c.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/Caf%C3%A9", nil), recordHandler{t}); err != nil {
+		t.Fatal(err)
+	}
+	if got := rr.Header().Get("X-Final-Path"); got != "/café" {
+		t.Errorf("expected /café, got %s", got)
+	}
+
+	// without the option, fs mode still leaves such paths alone
+	root := t.TempDir()
+	if err := os.WriteFile(filepath.Join(root, "A\x01b"), nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	c = &Casefold{Mode: "fs", Root: root}
+	if err := c.Provision(caddy.Context{}); err != nil {
+		t.Fatal(err)
+	}
+	rr = httptest.NewRecorder()
+	if err := c.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/a%01B", nil), recordHandler{t}); err != nil {
+		t.Fatal(err)
+	}
+	if got := rr.Header().Get("X-Final-Path"); got != "/a\x01B" {
+		t.Errorf("fs: expected the path unresolved, got %q", got)
+	}
+}
@@ -0,0 +1,129 @@
+package casefold
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"sort"
+	"time"
+)
+
+// defaultMaxSegments is the default MaxSegments.
+const defaultMaxSegments = 64
+
+// errResolveLimit is returned when an fs resolution exceeds MaxDirEntries
+// or ResolveTimeout.
+var errResolveLimit = errors.New("fs resolution limit exceeded")
+
+func (c *Casefold) maxSegments() int {
+	if c.MaxSegments > 0 {
+		return c.MaxSegments
+	}
+	return defaultMaxSegments
+}
+
+// validateOptions checks the limits, and other options that need nothing
+// provisioned, for invalid values and missing dependencies.
+func (c *Casefold) validateOptions() error {
+	if c.MaxSegments < 0 || c.MaxDirEntries < 0 || c.ResolveTimeout < 0 {
+		return fmt.Errorf("max_segments, max_dir_entries and resolve_timeout must not be negative")
+	}
+	if c.NegativeCacheTTL < 0 || (c.NegativeCacheTTL > 0 && c.CacheSize == 0) {
+		return fmt.Errorf("negative_cache_ttl requires cache_size and must not be negative")
+	}
+	if c.ReindexInterval < 0 || (c.ReindexInterval > 0 && !c.Preload) {
+		return fmt.Errorf("reindex_interval requires preload and must not be negative")
+	}
+	if c.PreloadWorkers < 0 {
+		return fmt.Errorf("invalid preload_workers %d", c.PreloadWorkers)
+	}
+	if c.DirCacheSize < 0 {
+		return fmt.Errorf("invalid dir_cache_size %d", c.DirCacheSize)
+	}
+	if c.Suggest < 0 || (c.SuggestHeader != "" && c.Suggest == 0) {
+		return fmt.Errorf("suggest_header requires suggest, which must not be negative")
+	}
+	if len(c.RedirectMethods) > 0 && !c.Redirect {
+		return fmt.Errorf("redirect_methods requires redirect")
+	}
+	if c.PercentHex != "" && c.PercentHex != percentHexUpper && c.PercentHex != percentHexLower {
+		return fmt.Errorf("invalid percent_hex %q: must be upper or lower", c.PercentHex)
+	}
+	if c.Shared != "" && !c.hasStep("fs") {
+		return fmt.Errorf("shared %q requires fs mode or an fs step", c.Shared)
+	}
+	if c.FS != nil && c.FileSystem != "" {
+		return fmt.Errorf("file_system %q cannot be combined with an injected FS", c.FileSystem)
+	}
+	switch c.MixedScripts {
+	case "", mixedScriptsBlock, mixedScriptsLog, mixedScriptsFold:
+	default:
+		return fmt.Errorf("invalid mixed_scripts %q: must be block, log or fold", c.MixedScripts)
+	}
+	switch c.ReservedNames {
+	case "", reservedNamesSkip, reservedNamesReject:
+	default:
+		return fmt.Errorf("invalid reserved_names %q: must be skip or reject", c.ReservedNames)
+	}
+	if !validDotSegments(c.DotSegments) {
+		return fmt.Errorf("invalid dot_segments %q: must be keep, resolve or reject", c.DotSegments)
+	}
+	if !validTrailingSlash(c.TrailingSlash) {
+		return fmt.Errorf("invalid trailing_slash %q: must be keep, add or remove", c.TrailingSlash)
+	}
+	if !validEncodedSlashes(c.EncodedSlashes) {
+		return fmt.Errorf("invalid encoded_slashes %q: must be keep, decode or reject", c.EncodedSlashes)
+	}
+	if c.MaxPathLength < 0 {
+		return fmt.Errorf("invalid max_path_length %d", c.MaxPathLength)
+	}
+	if c.RejectLongPaths && c.MaxPathLength == 0 {
+		return fmt.Errorf("reject_long_paths requires max_path_length")
+	}
+	return nil
+}
+
+// readDirBatch is how many entries readDir reads between limit checks.
+const readDirBatch = 256
+
+// readDir is fs.ReadDir within MaxDirEntries and the resolution deadline,
+// if any: directories are read in batches and abandoned with
+// errResolveLimit once either is exceeded.
+func (c *Casefold) readDir(dir string, deadline time.Time) ([]fs.DirEntry, error) {
+	if c.MaxDirEntries == 0 && deadline.IsZero() {
+		return fs.ReadDir(c.fsys, dir)
+	}
+	if !deadline.IsZero() && time.Now().After(deadline) {
+		return nil, fmt.Errorf("%w: resolve_timeout", errResolveLimit)
+	}
+	f, err := c.fsys.Open(dir)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	rdf, ok := f.(fs.ReadDirFile)
+	if !ok {
+		return nil, &fs.PathError{Op: "readdir", Path: dir, Err: errors.New("not implemented")}
+	}
+	var entries []fs.DirEntry
+	for {
+		batch, err := rdf.ReadDir(readDirBatch)
+		entries = append(entries, batch...)
+		if c.MaxDirEntries > 0 && len(entries) > c.MaxDirEntries {
+			return nil, fmt.Errorf("%w: max_dir_entries", errResolveLimit)
+		}
+		if !deadline.IsZero() && time.Now().After(deadline) {
+			return nil, fmt.Errorf("%w: resolve_timeout", errResolveLimit)
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	// fs.ReadDir's order, which the ambiguity policies rely on
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Name() < entries[j].Name() })
+	return entries, nil
+}
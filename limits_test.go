@@ -0,0 +1,135 @@
+package casefold
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/caddyserver/caddy/v2"
+	"github.com/caddyserver/caddy/v2/modules/caddyhttp"
+)
+
+func TestResolveLimits(t *testing.T) {
+	root := t.TempDir()
+	deep := filepath.Join(root, "A", "B", "C")
+	if err := os.MkdirAll(deep, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(deep, "File.txt"), nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 5; i++ {
+		if err := os.WriteFile(filepath.Join(root, "Entry"+strings.Repeat("x", i)), nil, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	lookup := func(c *Casefold, p string) (string, bool) {
+		t.Helper()
+		if err := c.Provision(caddy.Context{}); err != nil {
+			t.Fatal(err)
+		}
+		defer c.Cleanup()
+		canon, ok, _, err := c.lookupFS(p)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return canon, ok
+	}
+
+	if canon, ok := lookup(&Casefold{Mode: "fs", Root: root}, "/a/b/c/file.txt"); !ok || canon != "/A/B/C/File.txt" {
+		t.Fatalf("unlimited: got %q %v", canon, ok)
+	}
+	if _, ok := lookup(&Casefold{Mode: "fs", Root: root, MaxSegments: 3}, "/a/b/c/file.txt"); ok {
+		t.Error("max_segments 3 resolved a 4-segment path")
+	}
+	if _, ok := lookup(&Casefold{Mode: "fs", Root: root, MaxSegments: 4}, "/a/b/c/file.txt"); !ok {
+		t.Error("max_segments 4 refused a 4-segment path")
+	}
+	// root holds A and five Entry files
+	if _, ok := lookup(&Casefold{Mode: "fs", Root: root, MaxDirEntries: 5}, "/a/b/c/file.txt"); ok {
+		t.Error("max_dir_entries 5 scanned a 6-entry directory")
+	}
+	if canon, ok := lookup(&Casefold{Mode: "fs", Root: root, MaxDirEntries: 6}, "/entryxx"); !ok || canon != "/Entryxx" {
+		t.Errorf("max_dir_entries 6: got %q %v", canon, ok)
+	}
+	if _, ok := lookup(&Casefold{Mode: "fs", Root: root, ResolveTimeout: caddy.Duration(time.Nanosecond)}, "/a/b/c/file.txt"); ok {
+		t.Error("resolve_timeout 1ns let a resolution finish")
+	}
+	if _, ok := lookup(&Casefold{Mode: "fs", Root: root, ResolveTimeout: caddy.Duration(time.Minute)}, "/a/b/c/file.txt"); !ok {
+		t.Error("resolve_timeout 1m aborted a resolution")
+	}
+
+	if err := (&Casefold{Mode: "fs", Root: root, MaxDirEntries: -1}).Provision(caddy.Context{}); err == nil {
+		t.Error("negative max_dir_entries accepted")
+	}
+}
+
+func TestResolveLimitsDoNotShareState(t *testing.T) {
+	root := t.TempDir()
+	deep := filepath.Join(root, "A", "B", "C")
+	if err := os.MkdirAll(deep, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(deep, "File.txt"), nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	loose := &Casefold{Mode: "fs", Root: root, CacheSize: 10, DirCacheSize: 10}
+	if err := loose.Provision(caddy.Context{}); err != nil {
+		t.Fatal(err)
+	}
+	defer loose.Cleanup()
+	if _, ok, _, err := loose.lookupFS("/a/b/c/file.txt"); err != nil || !ok {
+		t.Fatalf("loose: expected a resolution, got %v %v", ok, err)
+	}
+	for _, c := range []*Casefold{
+		{Mode: "fs", Root: root, CacheSize: 10, DirCacheSize: 10, MaxSegments: 3},
+		{Mode: "fs", Root: root, CacheSize: 10, DirCacheSize: 10, MaxDirEntries: 1, ResolveTimeout: caddy.Duration(time.Nanosecond)},
+	} {
+		if err := c.Provision(caddy.Context{}); err != nil {
+			t.Fatal(err)
+		}
+		if c.state == loose.state {
+			t.Errorf("%d/%d/%s: expected its own fs state", c.MaxSegments, c.MaxDirEntries, time.Duration(c.ResolveTimeout))
+		}
+		if _, ok, _, _ := c.lookupFS("/a/b/c/file.txt"); ok {
+			t.Errorf("%d/%d/%s: resolved past its limits", c.MaxSegments, c.MaxDirEntries, time.Duration(c.ResolveTimeout))
+		}
+		_ = c.Cleanup()
+	}
+}
+
+func TestMaxPathLength(t *testing.T) {
+	long := "/" + strings.Repeat("A", 20)
+	c := &Casefold{MaxPathLength: 16}
+	if err := c.Provision(caddy.Context{}); err != nil {
+		t.Fatal(err)
+	}
+	for in, want := range map[string]string{"/Short": "/short", long: long} {
+		rr := httptest.NewRecorder()
+		if err := c.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, in, nil), recordHandler{t}); err != nil {
+			t.Fatal(err)
+		}
+		if got := rr.Header().Get("X-Final-Path"); got != want {
+			t.Errorf("%s: expected %s, got %s", in, want, got)
+		}
+	}
+
+	c = &Casefold{MaxPathLength: 16, RejectLongPaths: true}
+	if err := c.Provision(caddy.Context{}); err != nil {
+		t.Fatal(err)
+	}
+	err := c.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, long, nil), recordHandler{t})
+	var herr caddyhttp.HandlerError
+	if !errors.As(err, &herr) || herr.StatusCode != http.StatusRequestURITooLong {
+		t.Errorf("expected 414, got %v", err)
+	}
+
+	if err := (&Casefold{RejectLongPaths: true}).Provision(caddy.Context{}); err == nil {
+		t.Error("reject_long_paths without max_path_length accepted")
+	}
+}
@@ -0,0 +1,132 @@
+package casefold
+
+import (
+	"fmt"
+	"net/http"
+	"sync"
+
+	"golang.org/x/text/cases"
+	"golang.org/x/text/language"
+)
+
+// caserFactory builds the caser a mode uses for a language.
+type caserFactory func(language.Tag) caser
+
+func lowerFor(tag language.Tag) caser {
+	return newLocaleCaser(func() cases.Caser { return cases.Lower(tag) })
+}
+
+func upperFor(tag language.Tag) caser {
+	return newLocaleCaser(func() cases.Caser { return cases.Upper(tag) })
+}
+
+func titleFor(tag language.Tag) caser {
+	return titleCaser{lower: lowerFor(tag), upper: upperFor(tag)}
+}
+
+func asciiFor(tag language.Tag) caser {
+	return asciiCaser{lower: lowerFor(tag)}
+}
+
+// localeCaser maps case with the rules of one language. x/text casers keep
+// state between calls and must not be shared between goroutines, so each
+// call borrows one from a pool.
+type localeCaser struct {
+	pool *sync.Pool
+}
+
+func newLocaleCaser(mk func() cases.Caser) localeCaser {
+	return localeCaser{pool: &sync.Pool{
+		New: func() any {
+			cs := mk()
+			return &cs
+		},
+	}}
+}
+
+func (lc localeCaser) String(s string) string {
+	cs := lc.pool.Get().(*cases.Caser)
+	defer lc.pool.Put(cs)
+	return cs.String(s)
+}
+
+// provisionCaser sets c.fold to base, or to a caser built by mk for Locale,
+// and prepares per-request selection for AcceptLanguageLocales. Every caser
+// is wrapped with the Replace table.
+func (c *Casefold) provisionCaser(base caser, mk caserFactory) error {
+	c.fold = c.replace.wrap(base)
+	if c.Locale != "" {
+		tag, err := parseLocale(c.Locale)
+		if err != nil {
+			return err
+		}
+		c.fold = c.replace.wrap(mk(tag))
+	}
+	if len(c.AcceptLanguageLocales) > 0 {
+		wrapped := func(tag language.Tag) caser { return c.replace.wrap(mk(tag)) }
+		ls, err := newLocaleSelector(c.AcceptLanguageLocales, wrapped)
+		if err != nil {
+			return err
+		}
+		c.locales = ls
+	}
+	return nil
+}
+
+// parseLocale validates a BCP 47 locale option.
+func parseLocale(locale string) (language.Tag, error) {
+	tag, err := language.Parse(locale)
+	if err != nil {
+		return language.Und, fmt.Errorf("invalid locale %q: %v", locale, err)
+	}
+	return tag, nil
+}
+
+// localeSelector chooses a caser from a request's Accept-Language
+// header among a fixed set of supported locales.
+type localeSelector struct {
+	matcher language.Matcher
+	casers  []caser
+}
+
+func newLocaleSelector(locales []string, mk caserFactory) (*localeSelector, error) {
+	ls := &localeSelector{casers: make([]caser, 0, len(locales))}
+	tags := make([]language.Tag, 0, len(locales))
+	for _, l := range locales {
+		tag, err := parseLocale(l)
+		if err != nil {
+			return nil, err
+		}
+		tags = append(tags, tag)
+		ls.casers = append(ls.casers, mk(tag))
+	}
+	ls.matcher = language.NewMatcher(tags)
+	return ls, nil
+}
+
+// caserFor returns the caser for the best supported match of
+// acceptLanguage, or false if nothing matches.
+func (ls *localeSelector) caserFor(acceptLanguage string) (caser, bool) {
+	if acceptLanguage == "" {
+		return nil, false
+	}
+	prefs, _, err := language.ParseAcceptLanguage(acceptLanguage)
+	if err != nil || len(prefs) == 0 {
+		return nil, false
+	}
+	_, i, conf := ls.matcher.Match(prefs...)
+	if conf == language.No {
+		return nil, false
+	}
+	return ls.casers[i], true
+}
+
+// caserFor returns the caser that the case mapping modes apply to r.
+func (c *Casefold) caserFor(r *http.Request) caser {
+	if c.locales != nil {
+		if cs, ok := c.locales.caserFor(r.Header.Get("Accept-Language")); ok {
+			return cs
+		}
+	}
+	return c.fold
+}
@@ -0,0 +1,222 @@
+package casefold
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/caddyserver/caddy/v2"
+	"github.com/caddyserver/caddy/v2/caddyconfig/caddyfile"
+	"github.com/fsnotify/fsnotify"
+	"go.uber.org/zap"
+)
+
+func init() {
+	caddy.RegisterModule(new(MapResolver))
+}
+
+// MapResolver resolves paths from an explicit mapping file, for sites whose
+// canonical casing is known ahead of time (e.g. legacy URL migrations)
+// rather than derivable from disk. The file is reloaded whenever it changes;
+// if a reload fails to parse, the previous mapping stays in effect.
+//
+// Two formats are accepted, chosen by file extension:
+//   - .json: an object mapping request paths to canonical paths,
+//     e.g. {"/about-us": "/About-Us"}
+//   - .csv (or anything else): one mapping per record, either
+//     "from,to" or just "to" (the key is then derived from it)
+//
+// Keys are matched case-insensitively after cleaning, so they need not be
+// written in lowercase, and in the handler's Unicode normalization form, so
+// they need not be written in it either.
+type MapResolver struct {
+	// File is the path of the mapping file.
+	File string `json:"file,omitempty"`
+
+	// mu serializes loads, which read norm.
+	mu      sync.Mutex
+	norm    normalizer
+	paths   atomic.Pointer[map[string]string]
+	watcher *fsnotify.Watcher
+	done    chan struct{}
+	log     *zap.Logger
+}
+
+// CaddyModule returns the Caddy module information.
+func (*MapResolver) CaddyModule() caddy.ModuleInfo { //nolint:revive
+	return caddy.ModuleInfo{
+		ID:  "http.handlers.casefold.resolvers.map",
+		New: func() caddy.Module { return new(MapResolver) },
+	}
+}
+
+// Provision loads the mapping file and starts watching it for changes.
+func (m *MapResolver) Provision(ctx caddy.Context) error { //nolint:revive
+	m.log = ctx.Logger()
+	if m.File == "" {
+		return fmt.Errorf("map resolver requires a file")
+	}
+	if err := m.load(); err != nil {
+		return err
+	}
+	w, err := fsnotify.NewWatcher()
+	if err != nil {
+		return err
+	}
+	// watch the directory: editors and deploy tools usually replace the file
+	// by renaming, which would silently end a watch on the file itself
+	if err := w.Add(filepath.Dir(m.File)); err != nil {
+		_ = w.Close()
+		return fmt.Errorf("watching map file %s: %v", m.File, err)
+	}
+	m.watcher = w
+	m.done = make(chan struct{})
+	go m.watch()
+	return nil
+}
+
+func (m *MapResolver) watch() {
+	defer close(m.done)
+	target := filepath.Clean(m.File)
+	for {
+		select {
+		case ev, ok := <-m.watcher.Events:
+			if !ok {
+				return
+			}
+			if filepath.Clean(ev.Name) != target || !(ev.Has(fsnotify.Write) || ev.Has(fsnotify.Create)) {
+				continue
+			}
+			if err := m.load(); err != nil {
+				m.log.Error("casefold map reload failed; keeping previous mapping", zap.String("file", m.File), zap.Error(err))
+				continue
+			}
+			m.log.Info("casefold map reloaded", zap.String("file", m.File), zap.Int("entries", len(*m.paths.Load())))
+		case err, ok := <-m.watcher.Errors:
+			if !ok {
+				return
+			}
+			m.log.Warn("casefold map watcher error", zap.Error(err))
+		}
+	}
+}
+
+// normalize rekeys the mapping in the normalization form n, the handler's,
+// for a resolver provisioned before the handler could tell it.
+func (m *MapResolver) normalize(n normalizer) error {
+	m.mu.Lock()
+	m.norm = n
+	m.mu.Unlock()
+	return m.load()
+}
+
+// load parses the mapping file and swaps it in.
+func (m *MapResolver) load() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	f, err := os.Open(m.File)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	var paths map[string]string
+	if strings.EqualFold(filepath.Ext(m.File), ".json") {
+		paths, err = parseMapJSON(f, m.norm)
+	} else {
+		paths, err = parseMapCSV(f, m.norm)
+	}
+	if err != nil {
+		return fmt.Errorf("parsing map file %s: %v", m.File, err)
+	}
+	m.paths.Store(&paths)
+	return nil
+}
+
+// parseMapJSON parses a JSON mapping, keying it as the handler looks paths
+// up: in normalization form n, then by foldedKey.
+func parseMapJSON(r io.Reader, n normalizer) (map[string]string, error) {
+	var raw map[string]string
+	if err := json.NewDecoder(r).Decode(&raw); err != nil {
+		return nil, err
+	}
+	paths := make(map[string]string, len(raw))
+	for from, to := range raw {
+		paths[foldedKey(n.String(from))] = to
+	}
+	return paths, nil
+}
+
+// parseMapCSV parses a CSV mapping, keyed as by parseMapJSON.
+func parseMapCSV(r io.Reader, n normalizer) (map[string]string, error) {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = -1
+	cr.Comment = '#'
+	cr.TrimLeadingSpace = true
+	paths := make(map[string]string)
+	for {
+		rec, err := cr.Read()
+		if err == io.EOF {
+			return paths, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		switch len(rec) {
+		case 1:
+			paths[foldedKey(n.String(rec[0]))] = rec[0]
+		case 2:
+			paths[foldedKey(n.String(rec[0]))] = rec[1]
+		default:
+			line, _ := cr.FieldPos(0)
+			return nil, fmt.Errorf("line %d: expected 1 or 2 fields, got %d", line, len(rec))
+		}
+	}
+}
+
+// Resolve implements Resolver.
+func (m *MapResolver) Resolve(_ *http.Request, folded string) (string, bool, error) { //nolint:revive
+	paths := m.paths.Load()
+	if paths == nil {
+		return "", false, nil
+	}
+	canon, ok := (*paths)[folded]
+	return canon, ok, nil
+}
+
+// Cleanup stops watching the mapping file.
+func (m *MapResolver) Cleanup() error { //nolint:revive
+	if m.watcher == nil {
+		return nil
+	}
+	err := m.watcher.Close()
+	<-m.done
+	return err
+}
+
+// UnmarshalCaddyfile implements caddyfile.Unmarshaler. Syntax:
+//
+//	map <file>
+func (m *MapResolver) UnmarshalCaddyfile(d *caddyfile.Dispenser) error {
+	d.Next() // consume module name
+	v, err := singleArg(d)
+	if err != nil {
+		return err
+	}
+	m.File = v
+	return nil
+}
+
+// Interface guards
+var (
+	_ Resolver              = (*MapResolver)(nil)
+	_ caddy.Provisioner     = (*MapResolver)(nil)
+	_ caddy.CleanerUpper    = (*MapResolver)(nil)
+	_ caddyfile.Unmarshaler = (*MapResolver)(nil)
+)
@@ -0,0 +1,95 @@
+package casefold
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/caddyserver/caddy/v2"
+)
+
+func TestParseMapCSV(t *testing.T) {
+	paths, err := parseMapCSV(strings.NewReader("# legacy URLs\n/About-Us\n/OLD/page.ASPX, /New/Page\n"), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := paths["/about-us"]; got != "/About-Us" {
+		t.Errorf("expected single-column record keyed by folded path, got %q", got)
+	}
+	if got := paths["/old/page.aspx"]; got != "/New/Page" {
+		t.Errorf("expected two-column record, got %q", got)
+	}
+	if _, err := parseMapCSV(strings.NewReader("a,b,c\n"), ""); err == nil {
+		t.Error("expected error for three-column record")
+	}
+}
+
+func TestMapKeysNormalized(t *testing.T) {
+	// the key is written decomposed (e + combining acute), requests arrive composed
+	file := filepath.Join(t.TempDir(), "paths.json")
+	if err := os.WriteFile(file, []byte(`{"/Cafe\u0301": "/Caf\u00e9-Menu"}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	c := &Casefold{Mode: "map", MapFile: file, Normalize: "nfc"}
+	if err := c.Provision(caddy.Context{}); err != nil {
+		t.Fatal(err)
+	}
+	defer c.Cleanup()
+	if got, ok := c.resolve(httptest.NewRequest(http.MethodGet, "/", nil), "/CAF\u00c9"); !ok || got != "/Caf\u00e9-Menu" {
+		t.Errorf("map mode: expected /Caf\u00e9-Menu, got %q %v", got, ok)
+	}
+
+	// a resolver module is provisioned before the handler tells it the form
+	m := &MapResolver{File: file}
+	if err := m.load(); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok, _ := m.Resolve(nil, "/caf\u00e9"); ok {
+		t.Fatal("expected the decomposed key not to match before normalize")
+	}
+	if err := m.normalize(normNFC); err != nil {
+		t.Fatal(err)
+	}
+	if got, ok, _ := m.Resolve(nil, "/caf\u00e9"); !ok || got != "/Caf\u00e9-Menu" {
+		t.Errorf("resolver: expected /Caf\u00e9-Menu, got %q %v", got, ok)
+	}
+}
+
+func TestCasefoldMapModeReload(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "paths.json")
+	if err := os.WriteFile(file, []byte(`{"/Docs/Intro": "/Docs/Intro"}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	c := &Casefold{Mode: "map", MapFile: file}
+	if err := c.Provision(caddy.Context{}); err != nil {
+		t.Fatal(err)
+	}
+	defer c.Cleanup()
+	serve := func(p string) string {
+		rr := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, "http://example.test"+p, nil)
+		if err := c.ServeHTTP(rr, req, recordHandler{t}); err != nil {
+			t.Fatal(err)
+		}
+		return rr.Header().Get("X-Final-Path")
+	}
+	if got := serve("/docs/INTRO"); got != "/Docs/Intro" {
+		t.Fatalf("expected /Docs/Intro, got %s", got)
+	}
+	if err := os.WriteFile(file, []byte(`{"/docs/intro": "/Documentation/Intro"}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	deadline := time.Now().Add(2 * time.Second)
+	got := serve("/docs/INTRO")
+	for got != "/Documentation/Intro" && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+		got = serve("/docs/INTRO")
+	}
+	if got != "/Documentation/Intro" {
+		t.Fatalf("expected reloaded mapping, got %s", got)
+	}
+}
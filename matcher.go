@@ -0,0 +1,83 @@
+package casefold
+
+import (
+	"net/http"
+
+	"github.com/caddyserver/caddy/v2"
+	"github.com/caddyserver/caddy/v2/caddyconfig/caddyfile"
+	"github.com/caddyserver/caddy/v2/modules/caddyhttp"
+	"golang.org/x/text/cases"
+)
+
+func init() {
+	caddy.RegisterModule(MatchPathCI{})
+}
+
+// MatchPathCI matches requests whose path matches any of the given patterns
+// after full Unicode case folding of both sides, for case-insensitive routing
+// on specific routes without rewriting the URL. Pattern syntax is the same
+// as the standard `path` matcher (exact, prefix*, *suffix, *substring* and
+// path.Match globs); where `path` only lowercases, path_ci also equates
+// forms such as "ß" and "ss".
+//
+// Example Caddyfile usage:
+//
+//	@docs path_ci /Straße/* /Docs/*
+type MatchPathCI []string
+
+// CaddyModule returns the Caddy module information.
+func (MatchPathCI) CaddyModule() caddy.ModuleInfo { //nolint:revive
+	return caddy.ModuleInfo{
+		ID:  "http.matchers.path_ci",
+		New: func() caddy.Module { return new(MatchPathCI) },
+	}
+}
+
+// Provision folds the patterns.
+func (m MatchPathCI) Provision(ctx caddy.Context) error { //nolint:revive
+	fold := cases.Fold()
+	for i := range m {
+		m[i] = fold.String(m[i])
+	}
+	return caddyhttp.MatchPath(m).Provision(ctx)
+}
+
+// Match returns true if r matches m.
+func (m MatchPathCI) Match(r *http.Request) bool { //nolint:revive
+	match, _ := m.MatchWithError(r)
+	return match
+}
+
+// MatchWithError returns true if r matches m.
+func (m MatchPathCI) MatchWithError(r *http.Request) (bool, error) { //nolint:revive
+	u := *r.URL
+	u.Path = cases.Fold().String(r.URL.Path)
+	u.RawPath = ""
+	folded := r.WithContext(r.Context()) // shallow copy; r itself is untouched
+	folded.URL = &u
+	return caddyhttp.MatchPath(m).MatchWithError(folded)
+}
+
+// UnmarshalCaddyfile implements caddyfile.Unmarshaler. Syntax:
+//
+//	path_ci <patterns...>
+func (m *MatchPathCI) UnmarshalCaddyfile(d *caddyfile.Dispenser) error {
+	for d.Next() {
+		args := d.RemainingArgs()
+		if len(args) == 0 {
+			return d.ArgErr()
+		}
+		*m = append(*m, args...)
+		if d.NextBlock(0) {
+			return d.Err("malformed path_ci matcher: blocks are not supported")
+		}
+	}
+	return nil
+}
+
+// Interface guards
+var (
+	_ caddy.Provisioner                 = (*MatchPathCI)(nil)
+	_ caddyhttp.RequestMatcherWithError = (*MatchPathCI)(nil)
+	_ caddyfile.Unmarshaler             = (*MatchPathCI)(nil)
+)
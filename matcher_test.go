@@ -0,0 +1,40 @@
+package casefold
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/caddyserver/caddy/v2"
+	"github.com/caddyserver/caddy/v2/caddyconfig/caddyfile"
+)
+
+func TestMatchPathCI(t *testing.T) {
+	var m MatchPathCI
+	if err := m.UnmarshalCaddyfile(caddyfile.NewTestDispenser(`path_ci /Straße/* /Docs/Index.html`)); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Provision(caddy.Context{}); err != nil {
+		t.Fatal(err)
+	}
+	for p, want := range map[string]bool{
+		"/STRASSE/Map":     true,
+		"/strasse/map":     true,
+		"/docs/INDEX.HTML": true,
+		"/docs/other.html": false,
+	} {
+		req := httptest.NewRequest(http.MethodGet, "http://example.test"+p, nil)
+		req = req.WithContext(context.WithValue(req.Context(), caddy.ReplacerCtxKey, caddy.NewReplacer()))
+		got, err := m.MatchWithError(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != want {
+			t.Errorf("%s: expected match=%v, got %v", p, want, got)
+		}
+		if req.URL.Path != p {
+			t.Errorf("expected request path untouched, got %s", req.URL.Path)
+		}
+	}
+}
@@ -0,0 +1,35 @@
+package casefold
+
+import (
+	"fmt"
+
+	"github.com/caddyserver/caddy/v2"
+	"github.com/caddyserver/caddy/v2/modules/caddyhttp"
+)
+
+// loadMatcherSets loads raw matcher sets from the http.matchers namespace.
+// Modules are loaded one by one with LoadModuleByID rather than through
+// ctx.LoadModule, whose reflection does not recognize RawMatcherSets when
+// json.RawMessage is an alias of jsontext.Value (GOEXPERIMENT=jsonv2).
+func loadMatcherSets(ctx caddy.Context, raw caddyhttp.RawMatcherSets) (caddyhttp.MatcherSets, error) {
+	if len(raw) == 0 {
+		return nil, nil
+	}
+	sets := make([]map[string]any, 0, len(raw))
+	for i, rawSet := range raw {
+		set := make(map[string]any, len(rawSet))
+		for name, msg := range rawSet {
+			mod, err := ctx.LoadModuleByID("http.matchers."+name, msg)
+			if err != nil {
+				return nil, fmt.Errorf("matcher set %d: loading %s matcher: %v", i, name, err)
+			}
+			set[name] = mod
+		}
+		sets = append(sets, set)
+	}
+	var ms caddyhttp.MatcherSets
+	if err := ms.FromInterface(sets); err != nil {
+		return nil, err
+	}
+	return ms, nil
+}
@@ -0,0 +1,87 @@
+package casefold
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/caddyserver/caddy/v2"
+	"github.com/caddyserver/caddy/v2/caddyconfig/caddyfile"
+	"github.com/caddyserver/caddy/v2/modules/caddyhttp"
+)
+
+func TestMatcherSets(t *testing.T) {
+	ctx, cancel := caddy.NewContext(caddy.Context{Context: context.Background()})
+	defer cancel()
+	c := &Casefold{
+		ApplyToRaw: caddyhttp.RawMatcherSets{
+			{"method": json.RawMessage(`["GET"]`)},
+			{"path": json.RawMessage(`["/Upload/*"]`)},
+		},
+		ExcludeMatchRaw: caddyhttp.RawMatcherSets{
+			{"header": json.RawMessage(`{"X-Raw-Path": ["1"]}`)},
+		},
+	}
+	if err := c.Provision(ctx); err != nil {
+		t.Fatal(err)
+	}
+	for _, tc := range []struct {
+		method, path string
+		header       http.Header
+		want         string
+	}{
+		{http.MethodGet, "/Docs", nil, "/docs"},
+		{http.MethodPost, "/Docs", nil, "/Docs"},
+		{http.MethodPost, "/Upload/File", nil, "/upload/file"},
+		{http.MethodGet, "/Docs", http.Header{"X-Raw-Path": {"1"}}, "/Docs"},
+	} {
+		req := httptest.NewRequest(tc.method, tc.path, nil)
+		for k, v := range tc.header {
+			req.Header[k] = v
+		}
+		repl := caddy.NewReplacer()
+		req = req.WithContext(context.WithValue(req.Context(), caddy.ReplacerCtxKey, repl))
+		rr := httptest.NewRecorder()
+		if err := c.ServeHTTP(rr, req, recordHandler{t}); err != nil {
+			t.Fatal(err)
+		}
+		if got := rr.Header().Get("X-Final-Path"); got != tc.want {
+			t.Errorf("%s %s %v: expected %s, got %s", tc.method, tc.path, tc.header, tc.want, got)
+		}
+	}
+}
+
+func TestMatcherSetsInvalid(t *testing.T) {
+	ctx, cancel := caddy.NewContext(caddy.Context{Context: context.Background()})
+	defer cancel()
+	c := &Casefold{ApplyToRaw: caddyhttp.RawMatcherSets{{"no_such_matcher": json.RawMessage(`{}`)}}}
+	if err := c.Provision(ctx); err == nil {
+		t.Fatal("expected unknown matcher module to be rejected")
+	}
+}
+
+func TestUnmarshalCaddyfileMatcherSets(t *testing.T) {
+	d := caddyfile.NewTestDispenser(`casefold {
+		apply_to {
+			method GET HEAD
+		}
+		apply_to {
+			path /Upload/*
+		}
+		exclude_match {
+			header X-Raw-Path 1
+		}
+	}`)
+	var c Casefold
+	if err := c.UnmarshalCaddyfile(d); err != nil {
+		t.Fatal(err)
+	}
+	if len(c.ApplyToRaw) != 2 || string(c.ApplyToRaw[0]["method"]) != `["GET","HEAD"]` || c.ApplyToRaw[1]["path"] == nil {
+		t.Fatalf("unexpected apply_to sets: %s", c.ApplyToRaw)
+	}
+	if len(c.ExcludeMatchRaw) != 1 || c.ExcludeMatchRaw[0]["header"] == nil {
+		t.Fatalf("unexpected exclude_match sets: %s", c.ExcludeMatchRaw)
+	}
+}
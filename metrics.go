@@ -0,0 +1,93 @@
+package casefold
+
+import (
+	"errors"
+
+	"github.com/caddyserver/caddy/v2"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const (
+	metricsNamespace = "caddy"
+	metricsSubsystem = "casefold"
+)
+
+// casefoldMetrics are shared by every handler instance and registered with
+// each config's metrics registry, so they show up on Caddy's metrics endpoint.
+var casefoldMetrics = struct {
+	requests         *prometheus.CounterVec
+	rewrites         *prometheus.CounterVec
+	skips            *prometheus.CounterVec
+	fsCacheHits      prometheus.Counter
+	fsCacheMisses    prometheus.Counter
+	fsResolveFailure prometheus.Counter
+}{
+	requests: prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Subsystem: metricsSubsystem,
+		Name:      "requests_total",
+		Help:      "Requests seen by the casefold handler.",
+	}, []string{"mode"}),
+	rewrites: prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Subsystem: metricsSubsystem,
+		Name:      "rewrites_total",
+		Help:      "Requests whose path was changed, by mode and action (rewrite or redirect).",
+	}, []string{"mode", "action"}),
+	skips: prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Subsystem: metricsSubsystem,
+		Name:      "skips_total",
+		Help:      "Requests left untouched because a skip rule applied.",
+	}, []string{"reason"}),
+	fsCacheHits: prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Subsystem: metricsSubsystem,
+		Name:      "fs_cache_hits_total",
+		Help:      "fs mode resolutions served from the cache.",
+	}),
+	fsCacheMisses: prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Subsystem: metricsSubsystem,
+		Name:      "fs_cache_misses_total",
+		Help:      "fs mode resolutions not found in the cache.",
+	}),
+	fsResolveFailure: prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Subsystem: metricsSubsystem,
+		Name:      "fs_resolution_failures_total",
+		Help:      "fs mode paths that could not be resolved to an existing entry.",
+	}),
+}
+
+// registerMetrics adds the casefold collectors to ctx's metrics registry.
+// Several handlers share one registry, so a collector that is already
+// registered is not an error.
+func registerMetrics(ctx caddy.Context) error {
+	registry := ctx.GetMetricsRegistry()
+	if registry == nil {
+		return nil
+	}
+	for _, col := range []prometheus.Collector{
+		casefoldMetrics.requests,
+		casefoldMetrics.rewrites,
+		casefoldMetrics.skips,
+		casefoldMetrics.fsCacheHits,
+		casefoldMetrics.fsCacheMisses,
+		casefoldMetrics.fsResolveFailure,
+	} {
+		if err := registry.Register(col); err != nil && !errors.As(err, &prometheus.AlreadyRegisteredError{}) {
+			return err
+		}
+	}
+	return nil
+}
+
+// countFSResult records an unresolved fs mode lookup and passes its result
+// through unchanged.
+func countFSResult(canon string, ok bool) (string, bool) {
+	if !ok {
+		casefoldMetrics.fsResolveFailure.Inc()
+	}
+	return canon, ok
+}
@@ -0,0 +1,86 @@
+package casefold
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/caddyserver/caddy/v2"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestMetricsCountRewritesAndSkips(t *testing.T) {
+	c := &Casefold{Mode: "lower", Exclude: []string{"/keep/*"}}
+	if err := c.Provision(caddy.Context{}); err != nil {
+		t.Fatal(err)
+	}
+	requests := testutil.ToFloat64(casefoldMetrics.requests.WithLabelValues("lower"))
+	rewrites := testutil.ToFloat64(casefoldMetrics.rewrites.WithLabelValues("lower", "rewrite"))
+	skips := testutil.ToFloat64(casefoldMetrics.skips.WithLabelValues("exclude"))
+
+	for _, target := range []string{"/Foo", "/bar", "/keep/Me"} {
+		req := httptest.NewRequest(http.MethodGet, target, nil)
+		if err := c.ServeHTTP(httptest.NewRecorder(), req, recordHandler{t}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if d := testutil.ToFloat64(casefoldMetrics.requests.WithLabelValues("lower")) - requests; d != 3 {
+		t.Fatalf("expected 3 requests counted, got %v", d)
+	}
+	if d := testutil.ToFloat64(casefoldMetrics.rewrites.WithLabelValues("lower", "rewrite")) - rewrites; d != 1 {
+		t.Fatalf("expected 1 rewrite counted, got %v", d)
+	}
+	if d := testutil.ToFloat64(casefoldMetrics.skips.WithLabelValues("exclude")) - skips; d != 1 {
+		t.Fatalf("expected 1 exclude skip counted, got %v", d)
+	}
+}
+
+func TestMetricsCountFSCache(t *testing.T) {
+	root := t.TempDir()
+	if err := os.Mkdir(filepath.Join(root, "Docs"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	c := &Casefold{Mode: "fs", Root: root, CacheSize: 8}
+	if err := c.Provision(caddy.Context{}); err != nil {
+		t.Fatal(err)
+	}
+	defer c.Cleanup()
+	hits := testutil.ToFloat64(casefoldMetrics.fsCacheHits)
+	misses := testutil.ToFloat64(casefoldMetrics.fsCacheMisses)
+	failures := testutil.ToFloat64(casefoldMetrics.fsResolveFailure)
+
+	c.resolveFS("/docs")
+	c.resolveFS("/docs")
+	c.resolveFS("/missing")
+
+	if d := testutil.ToFloat64(casefoldMetrics.fsCacheHits) - hits; d != 1 {
+		t.Fatalf("expected 1 cache hit, got %v", d)
+	}
+	if d := testutil.ToFloat64(casefoldMetrics.fsCacheMisses) - misses; d != 2 {
+		t.Fatalf("expected 2 cache misses, got %v", d)
+	}
+	if d := testutil.ToFloat64(casefoldMetrics.fsResolveFailure) - failures; d != 1 {
+		t.Fatalf("expected 1 resolution failure, got %v", d)
+	}
+}
+
+func TestRegisterMetricsSharedRegistry(t *testing.T) {
+	ctx, cancel := caddy.NewContext(caddy.Context{Context: context.Background()})
+	defer cancel()
+	for i := 0; i < 2; i++ {
+		c := &Casefold{Mode: "lower"}
+		if err := c.Provision(ctx); err != nil {
+			t.Fatalf("provision %d: %v", i, err)
+		}
+	}
+	err := ctx.GetMetricsRegistry().Register(casefoldMetrics.requests)
+	if !errors.As(err, &prometheus.AlreadyRegisteredError{}) {
+		t.Fatalf("expected requests counter to be registered already, got %v", err)
+	}
+}
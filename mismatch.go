@@ -0,0 +1,131 @@
+package casefold
+
+import (
+	"net/http"
+
+	"github.com/caddyserver/caddy/v2"
+	"github.com/caddyserver/caddy/v2/caddyconfig/caddyfile"
+	"github.com/caddyserver/caddy/v2/modules/caddyhttp"
+)
+
+func init() {
+	caddy.RegisterModule(MatchCasefoldMismatch{})
+}
+
+// MatchCasefoldMismatch matches requests whose path differs from its
+// canonical form under the given mode, i.e. requests that are miscased. It
+// lets routes redirect or otherwise treat miscased requests specially while
+// correctly cased ones are served untouched. Paths that cannot be
+// canonicalized (e.g. missing on disk in fs mode) never match.
+//
+// Example Caddyfile usage:
+//
+//	@miscased casefold_mismatch fs {
+//	    root /srv/www
+//	}
+//	redir @miscased {http.casefold.path} 308
+type MatchCasefoldMismatch struct {
+	// Mode is the canonicalization to compare against; same values as the
+	// casefold handler's mode (default "lower").
+	Mode string `json:"mode,omitempty"`
+
+	// Root is the filesystem root for mode "fs".
+	Root string `json:"root,omitempty"`
+
+	// FileSystem optionally names a registered virtual filesystem for mode "fs".
+	FileSystem string `json:"file_system,omitempty"`
+
+	// MapFile is the mapping file for mode "map".
+	MapFile string `json:"map_file,omitempty"`
+
+	cf *Casefold
+}
+
+// CaddyModule returns the Caddy module information.
+func (MatchCasefoldMismatch) CaddyModule() caddy.ModuleInfo { //nolint:revive
+	return caddy.ModuleInfo{
+		ID:  "http.matchers.casefold_mismatch",
+		New: func() caddy.Module { return new(MatchCasefoldMismatch) },
+	}
+}
+
+// Provision sets up the canonicalization shared with the casefold handler.
+func (m *MatchCasefoldMismatch) Provision(ctx caddy.Context) error { //nolint:revive
+	m.cf = &Casefold{Mode: m.Mode, Root: m.Root, FileSystem: m.FileSystem, MapFile: m.MapFile, embedded: true}
+	return m.cf.Provision(ctx)
+}
+
+// Cleanup releases resources held for fs and map modes.
+func (m *MatchCasefoldMismatch) Cleanup() error { //nolint:revive
+	if m.cf == nil {
+		return nil
+	}
+	return m.cf.Cleanup()
+}
+
+// Match returns true if r's path is not in canonical form.
+func (m MatchCasefoldMismatch) Match(r *http.Request) bool { //nolint:revive
+	match, _ := m.MatchWithError(r)
+	return match
+}
+
+// MatchWithError returns true if r's path is not in canonical form. The
+// canonical path is also exposed as {http.casefold.path}.
+func (m MatchCasefoldMismatch) MatchWithError(r *http.Request) (bool, error) { //nolint:revive
+	orig := r.URL.Path
+	canon, err := m.cf.transform(r, orig)
+	if err != nil {
+		return false, err
+	}
+	if repl, ok := r.Context().Value(caddy.ReplacerCtxKey).(*caddy.Replacer); ok {
+		repl.Set("http.casefold.path", canon)
+	}
+	return canon != orig, nil
+}
+
+// UnmarshalCaddyfile implements caddyfile.Unmarshaler. Syntax:
+//
+//	casefold_mismatch [<mode>] {
+//	    root <path>
+//	    file_system <name>
+//	    map_file <path>
+//	}
+func (m *MatchCasefoldMismatch) UnmarshalCaddyfile(d *caddyfile.Dispenser) error {
+	for d.Next() {
+		if d.NextArg() {
+			m.Mode = d.Val()
+		}
+		if d.NextArg() {
+			return d.ArgErr()
+		}
+		for d.NextBlock(0) {
+			var dst *string
+			switch d.Val() {
+			case "mode":
+				dst = &m.Mode
+			case "root":
+				dst = &m.Root
+			case "file_system":
+				dst = &m.FileSystem
+			case "map_file":
+				dst = &m.MapFile
+			default:
+				return d.Errf("unrecognized casefold_mismatch subdirective %q", d.Val())
+			}
+			v, err := singleArg(d)
+			if err != nil {
+				return err
+			}
+			*dst = v
+		}
+	}
+	return nil
+}
+
+// Interface guards
+var (
+	_ caddy.Provisioner                 = (*MatchCasefoldMismatch)(nil)
+	_ caddy.CleanerUpper                = (*MatchCasefoldMismatch)(nil)
+	_ caddyhttp.RequestMatcherWithError = (*MatchCasefoldMismatch)(nil)
+	_ caddyfile.Unmarshaler             = (*MatchCasefoldMismatch)(nil)
+)
@@ -0,0 +1,40 @@
+package casefold
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/caddyserver/caddy/v2"
+	"github.com/caddyserver/caddy/v2/caddyconfig/caddyfile"
+)
+
+func TestMatchCasefoldMismatch(t *testing.T) {
+	root := t.TempDir()
+	if err := os.WriteFile(filepath.Join(root, "About.html"), nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	var m MatchCasefoldMismatch
+	d := caddyfile.NewTestDispenser(`casefold_mismatch fs {
+		root ` + root + `
+	}`)
+	if err := m.UnmarshalCaddyfile(d); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Provision(caddy.Context{}); err != nil {
+		t.Fatal(err)
+	}
+	defer m.Cleanup()
+	for p, want := range map[string]bool{
+		"/about.html": true,
+		"/About.html": false,
+		"/missing":    false,
+	} {
+		req := httptest.NewRequest(http.MethodGet, "http://example.test"+p, nil)
+		if got := m.Match(req); got != want {
+			t.Errorf("%s: expected match=%v, got %v", p, want, got)
+		}
+	}
+}
@@ -0,0 +1,59 @@
+package casefold
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// normalizer applies a Unicode normalization form ("nfc" or "nfd") to
+// paths and directory entry names before they are folded or compared. The
+// zero value leaves strings unchanged.
+type normalizer string
+
+const (
+	normNFC normalizer = "nfc"
+	normNFD normalizer = "nfd"
+)
+
+// parseNormalizer validates a normalize option.
+func parseNormalizer(form string) (normalizer, error) {
+	switch n := normalizer(strings.ToLower(form)); n {
+	case "", normNFC, normNFD:
+		return n, nil
+	}
+	return "", fmt.Errorf("invalid normalize form %q: must be nfc or nfd", form)
+}
+
+func (n normalizer) String(s string) string {
+	switch n {
+	case normNFC:
+		return norm.NFC.String(s)
+	case normNFD:
+		return norm.NFD.String(s)
+	}
+	return s
+}
+
+// fold is the comparison key of s: normalized, then lowercased.
+func (n normalizer) fold(s string) string {
+	return strings.ToLower(n.String(s))
+}
+
+// stripMarks removes combining marks from s: it is decomposed, stripped of
+// nonspacing marks (accents, umlauts, cedillas) and recomposed.
+func stripMarks(s string) string {
+	d := norm.NFD.String(s)
+	stripped := strings.Map(func(r rune) rune {
+		if unicode.Is(unicode.Mn, r) {
+			return -1
+		}
+		return r
+	}, d)
+	if len(stripped) == len(d) {
+		return s
+	}
+	return norm.NFC.String(stripped)
+}
@@ -0,0 +1,62 @@
+package casefold
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"testing/fstest"
+
+	"github.com/caddyserver/caddy/v2"
+)
+
+const (
+	cafeNFC = "café"  // é as one code point
+	cafeNFD = "café" // e + combining acute accent
+)
+
+func TestNormalizeLowerMode(t *testing.T) {
+	c := &Casefold{Mode: "lower", Normalize: "nfc"}
+	if err := c.Provision(caddy.Context{}); err != nil {
+		t.Fatal(err)
+	}
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	if got, _ := c.transform(req, "/CAFÉ"); got != "/"+cafeNFC {
+		t.Fatalf("expected NFC %q, got %q", "/"+cafeNFC, got)
+	}
+}
+
+func TestNormalizeFSMode(t *testing.T) {
+	fsys := fstest.MapFS{"Menu/" + cafeNFD + ".html": &fstest.MapFile{}}
+	for _, tc := range []struct {
+		form string
+		ok   bool
+	}{
+		{"", false},
+		{"nfc", true},
+		{"nfd", true},
+	} {
+		c := &Casefold{Mode: "fs", fsys: fsys}
+		c.norm, _ = parseNormalizer(tc.form)
+		got, ok, err := c.canonicalFS("/menu/" + cafeNFC + ".HTML")
+		if err != nil || ok != tc.ok {
+			t.Fatalf("%q: expected ok=%v, got %q %v %v", tc.form, tc.ok, got, ok, err)
+		}
+		if ok && got != "/Menu/"+cafeNFD+".html" {
+			t.Fatalf("%q: expected the on-disk NFD name, got %q", tc.form, got)
+		}
+
+		idx, err := buildIndex(fsys, c.norm)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, ok := idx.Lookup("/MENU/" + cafeNFC + ".html"); ok != tc.ok {
+			t.Fatalf("%q (index): expected ok=%v", tc.form, tc.ok)
+		}
+	}
+}
+
+func TestInvalidNormalize(t *testing.T) {
+	if err := (&Casefold{Normalize: "nfkc"}).Provision(caddy.Context{}); err == nil {
+		t.Fatal("expected unsupported normalization form to be rejected")
+	}
+}
@@ -0,0 +1,109 @@
+package casefold
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// snapshotVersion is bumped whenever the on-disk snapshot format changes.
+const snapshotVersion = 1
+
+// indexSnapshot is the serialized form of a pathIndex.
+type indexSnapshot struct {
+	Version int       `json:"version"`
+	Root    string    `json:"root"`
+	Stamp   string    `json:"stamp,omitempty"`
+	Built   time.Time `json:"built"`
+	Dirs    []string  `json:"dirs"`
+	Files   []string  `json:"files"`
+}
+
+// errStaleSnapshot reports that a snapshot no longer matches the root.
+var errStaleSnapshot = errors.New("snapshot is stale")
+
+// saveSnapshot writes idx to file atomically. built should be the time the
+// walk that produced idx started, so changes made during the walk mark the
+// snapshot stale on the next load.
+func saveSnapshot(file, root, stamp string, built time.Time, idx *pathIndex) error {
+	dirs, files := idx.Entries()
+	data, err := json.Marshal(indexSnapshot{
+		Version: snapshotVersion,
+		Root:    root,
+		Stamp:   stamp,
+		Built:   built,
+		Dirs:    dirs,
+		Files:   files,
+	})
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(file), filepath.Base(file)+".tmp*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), file)
+}
+
+// loadSnapshot reads an index snapshot for root (the identifier it was saved
+// under) from file, checking freshness against fsys. If stamp is set, the
+// snapshot is trusted only if it was saved with the same stamp; otherwise
+// every indexed directory (and the root itself) must still exist and be
+// unmodified since the snapshot was built.
+func loadSnapshot(file string, fsys fs.FS, root, stamp string, n normalizer) (*pathIndex, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	var snap indexSnapshot
+	if err := json.Unmarshal(data, &snap); err != nil {
+		return nil, err
+	}
+	if snap.Version != snapshotVersion {
+		return nil, fmt.Errorf("%w: format version %d, want %d", errStaleSnapshot, snap.Version, snapshotVersion)
+	}
+	if snap.Root != root {
+		return nil, fmt.Errorf("%w: built for root %s", errStaleSnapshot, snap.Root)
+	}
+	if stamp != "" {
+		if snap.Stamp != stamp {
+			return nil, fmt.Errorf("%w: stamp %q, want %q", errStaleSnapshot, snap.Stamp, stamp)
+		}
+	} else {
+		for _, dir := range append([]string{"/"}, snap.Dirs...) {
+			fi, err := fs.Stat(fsys, fsPath(dir))
+			if err != nil || !fi.IsDir() {
+				return nil, fmt.Errorf("%w: directory %s missing", errStaleSnapshot, dir)
+			}
+			if fi.ModTime().After(snap.Built) {
+				return nil, fmt.Errorf("%w: directory %s modified", errStaleSnapshot, dir)
+			}
+		}
+	}
+	dirs := make(map[string]struct{}, len(snap.Dirs))
+	for _, d := range snap.Dirs {
+		dirs[d] = struct{}{}
+	}
+	all := append(append([]string(nil), snap.Dirs...), snap.Files...)
+	sort.Strings(all)
+	idx := newPathIndex()
+	idx.norm = n
+	for _, p := range all {
+		_, isDir := dirs[p]
+		idx.add(p, isDir)
+	}
+	return idx, nil
+}
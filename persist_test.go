@@ -0,0 +1,65 @@
+package casefold
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestSnapshotRoundTrip(t *testing.T) {
+	root := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(root, "Docs"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(root, "Docs", "Guide.md"), nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	built := time.Now().Add(time.Second) // tolerate coarse filesystem timestamps
+	idx, err := buildIndex(os.DirFS(root), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	file := filepath.Join(t.TempDir(), "index.json")
+	if err := saveSnapshot(file, root, "", built, idx); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := loadSnapshot(file, os.DirFS(root), root, "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, ok := loaded.Lookup("/docs/guide.md"); !ok || got != "/Docs/Guide.md" {
+		t.Fatalf("expected /Docs/Guide.md from snapshot, got %q %v", got, ok)
+	}
+	if _, err := loadSnapshot(file, os.DirFS(root), "/elsewhere", "", ""); !errors.Is(err, errStaleSnapshot) {
+		t.Fatalf("expected stale error for different root, got %v", err)
+	}
+
+	// a directory modified after the build invalidates the snapshot
+	later := built.Add(time.Minute)
+	if err := os.Chtimes(filepath.Join(root, "Docs"), later, later); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := loadSnapshot(file, os.DirFS(root), root, "", ""); !errors.Is(err, errStaleSnapshot) {
+		t.Fatalf("expected stale error after modification, got %v", err)
+	}
+}
+
+func TestSnapshotStamp(t *testing.T) {
+	root := t.TempDir()
+	idx, err := buildIndex(os.DirFS(root), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	file := filepath.Join(t.TempDir(), "index.json")
+	if err := saveSnapshot(file, root, "deploy-1", time.Now(), idx); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := loadSnapshot(file, os.DirFS(root), root, "deploy-1", ""); err != nil {
+		t.Fatalf("expected matching stamp to load, got %v", err)
+	}
+	if _, err := loadSnapshot(file, os.DirFS(root), root, "deploy-2", ""); !errors.Is(err, errStaleSnapshot) {
+		t.Fatalf("expected stale error for stamp mismatch, got %v", err)
+	}
+}
@@ -0,0 +1,132 @@
+package casefold
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/caddyserver/caddy/v2"
+	"go.uber.org/zap"
+)
+
+// stepKinds groups the transformation steps that share provisioned state;
+// a pipeline may contain at most one step of each kind.
+var stepKinds = map[string]string{
+	"lower":    "case",
+	"upper":    "case",
+	"title":    "case",
+	"ascii":    "case",
+	"fold":     "case",
+	"nfc":      "normalize",
+	"nfd":      "normalize",
+	"fs":       "fs",
+	"resolver": "lookup",
+	"map":      "lookup",
+}
+
+// provisionPipeline resolves Transforms, or the Mode shorthand, into
+// c.steps and provisions each step.
+func (c *Casefold) provisionPipeline(ctx caddy.Context) error {
+	if len(c.Transforms) == 0 {
+		if len(c.TransformModules) > 0 {
+			return fmt.Errorf("transform_modules require transforms")
+		}
+		step := c.modeName()
+		if step == "" {
+			step = "lower"
+		}
+		if stepKinds[step] == "" {
+			if c.Strict {
+				return fmt.Errorf("unknown mode %q: must be one of %s", c.Mode, strings.Join(modeNames(), ", "))
+			}
+			c.log.Warn("unknown casefold mode; defaulting to lower", zap.String("mode", c.Mode))
+			step = "lower"
+		}
+		c.steps = []string{step}
+		return c.provisionStep(ctx, step)
+	}
+	if c.Mode != "" {
+		return fmt.Errorf("mode %q and transforms are mutually exclusive", c.Mode)
+	}
+	c.steps = make([]string, 0, len(c.Transforms))
+	seen := make(map[string]string)
+	modules := make(map[string]bool)
+	for _, t := range c.Transforms {
+		step := strings.ToLower(strings.TrimSpace(t))
+		kind, ok := stepKinds[step]
+		if !ok {
+			name := strings.TrimSpace(t)
+			if _, err := caddy.GetModule(transformNamespace + "." + name); err != nil {
+				return fmt.Errorf("unknown transform %q", t)
+			}
+			modules[name] = true
+			c.steps = append(c.steps, name)
+			continue
+		}
+		if prev, dup := seen[kind]; dup {
+			return fmt.Errorf("transforms %q and %q cannot be combined", prev, step)
+		}
+		seen[kind] = step
+		c.steps = append(c.steps, step)
+	}
+	if err := c.loadTransformers(ctx, modules); err != nil {
+		return err
+	}
+	for _, step := range c.steps {
+		if modules[step] {
+			continue
+		}
+		if err := c.provisionStep(ctx, step); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+const transformNamespace = "http.handlers.casefold.transforms"
+
+// loadTransformers loads the guest modules named in Transforms, with their
+// settings from TransformModules.
+func (c *Casefold) loadTransformers(ctx caddy.Context, used map[string]bool) error {
+	var unused []string
+	for name := range c.TransformModules {
+		if !used[name] {
+			unused = append(unused, name)
+		}
+	}
+	if len(unused) > 0 {
+		sort.Strings(unused)
+		return fmt.Errorf("transform_modules %v are not used in transforms", unused)
+	}
+	if len(used) == 0 {
+		return nil
+	}
+	c.transformers = make(map[string]Transformer, len(used))
+	for name := range used {
+		raw := c.TransformModules[name]
+		if raw == nil {
+			raw = json.RawMessage("{}")
+		}
+		mod, err := ctx.LoadModuleByID(transformNamespace+"."+name, raw)
+		if err != nil {
+			return fmt.Errorf("loading transform module %q: %v", name, err)
+		}
+		t, ok := mod.(Transformer)
+		if !ok {
+			return fmt.Errorf("transform module %q does not implement casefold.Transformer", name)
+		}
+		c.transformers[name] = t
+	}
+	return nil
+}
+
+// hasStep reports whether step is part of the configured pipeline.
+func (c *Casefold) hasStep(step string) bool {
+	for _, s := range c.steps {
+		if s == step {
+			return true
+		}
+	}
+	return false
+}
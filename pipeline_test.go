@@ -0,0 +1,63 @@
+package casefold
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"testing/fstest"
+
+	"github.com/caddyserver/caddy/v2"
+)
+
+func TestTransformsPipeline(t *testing.T) {
+	c := &Casefold{Transforms: []string{"NFC", "fold", "fs"}}
+	if err := c.Provision(caddy.Context{}); err != nil {
+		t.Fatal(err)
+	}
+	c.fsys = fstest.MapFS{
+		"docs/strasse/" + cafeNFC + ".html": &fstest.MapFile{},
+	}
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	for in, want := range map[string]string{
+		// NFD input is composed, ß folds to ss, then the disk casing is used
+		"/DOCS/Straße/CAFÉ.html": "/docs/strasse/" + cafeNFC + ".html",
+		// unresolvable on disk: the request is left untouched
+		"/Docs/Missing": "/Docs/Missing",
+	} {
+		if got, _ := c.transform(req, in); got != want {
+			t.Errorf("%s: expected %q, got %q", in, want, got)
+		}
+	}
+	if got := c.modeOrDefault(); got != "nfc+fold+fs" {
+		t.Errorf("expected pipeline label nfc+fold+fs, got %q", got)
+	}
+}
+
+func TestTransformsShorthand(t *testing.T) {
+	for _, c := range []*Casefold{{}, {Mode: "upper"}} {
+		if err := c.Provision(caddy.Context{}); err != nil {
+			t.Fatal(err)
+		}
+		want := c.Mode
+		if want == "" {
+			want = "lower"
+		}
+		if len(c.steps) != 1 || c.steps[0] != want {
+			t.Errorf("mode %q: expected steps [%s], got %v", c.Mode, want, c.steps)
+		}
+	}
+}
+
+func TestInvalidTransforms(t *testing.T) {
+	for _, c := range []*Casefold{
+		{Transforms: []string{"lower", "bogus"}},
+		{Transforms: []string{"lower", "upper"}},
+		{Transforms: []string{"fold", "fs", "fs"}},
+		{Transforms: []string{"map", "resolver"}},
+		{Mode: "fold", Transforms: []string{"fold"}},
+	} {
+		if err := c.Provision(caddy.Context{}); err == nil {
+			t.Errorf("expected %+v to be rejected", c.Transforms)
+		}
+	}
+}
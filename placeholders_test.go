@@ -0,0 +1,76 @@
+package casefold
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/caddyserver/caddy/v2"
+	"github.com/caddyserver/caddy/v2/modules/caddyhttp"
+)
+
+func TestCasefoldPlaceholders(t *testing.T) {
+	c := &Casefold{Mode: "lower", Exclude: []string{"/Keep/*"}}
+	if err := c.Provision(caddy.Context{}); err != nil {
+		t.Fatal(err)
+	}
+	for _, tc := range []struct {
+		in, path, rewritten string
+	}{
+		{"/Docs/A", "/docs/a", "true"},
+		{"/docs/a", "/docs/a", "false"},
+		{"/Keep/Me", "/Keep/Me", "false"},
+	} {
+		repl := caddy.NewReplacer()
+		req := httptest.NewRequest(http.MethodGet, "http://example.test"+tc.in, nil)
+		req = req.WithContext(context.WithValue(req.Context(), caddy.ReplacerCtxKey, repl))
+		if err := c.ServeHTTP(httptest.NewRecorder(), req, recordHandler{t}); err != nil {
+			t.Fatal(err)
+		}
+		got := repl.ReplaceAll("{http.casefold.original_path} {http.casefold.path} {http.casefold.rewritten}", "")
+		if want := tc.in + " " + tc.path + " " + tc.rewritten; got != want {
+			t.Errorf("%s: expected %q, got %q", tc.in, want, got)
+		}
+	}
+}
+
+func TestCasefoldVars(t *testing.T) {
+	c := &Casefold{}
+	if err := c.Provision(caddy.Context{}); err != nil {
+		t.Fatal(err)
+	}
+	vars := map[string]any{}
+	req := httptest.NewRequest(http.MethodGet, "http://example.test/ABC", nil)
+	req = req.WithContext(context.WithValue(req.Context(), caddyhttp.VarsCtxKey, vars))
+	if err := c.ServeHTTP(httptest.NewRecorder(), req, recordHandler{t}); err != nil {
+		t.Fatal(err)
+	}
+	if vars["casefold.rewritten"] != true || vars["casefold.mode"] != "lower" || vars["casefold.original_path"] != "/ABC" {
+		t.Fatalf("unexpected vars: %v", vars)
+	}
+}
+
+func TestCasefoldLogFields(t *testing.T) {
+	c := &Casefold{LogFields: true}
+	if err := c.Provision(caddy.Context{}); err != nil {
+		t.Fatal(err)
+	}
+	extra := new(caddyhttp.ExtraLogFields)
+	req := httptest.NewRequest(http.MethodGet, "http://example.test/ABC", nil)
+	req = req.WithContext(context.WithValue(req.Context(), caddyhttp.ExtraLogFieldsCtxKey, extra))
+	if err := c.ServeHTTP(httptest.NewRecorder(), req, recordHandler{t}); err != nil {
+		t.Fatal(err)
+	}
+	// ExtraLogFields keeps its fields unexported; read the keys reflectively
+	fields := reflect.ValueOf(extra).Elem().FieldByName("fields")
+	var keys []string
+	for i := 0; i < fields.Len(); i++ {
+		keys = append(keys, fields.Index(i).FieldByName("Key").String())
+	}
+	want := []string{"casefold.original_path", "casefold.path", "casefold.rewritten", "casefold.mode"}
+	if !reflect.DeepEqual(keys, want) {
+		t.Fatalf("expected log fields %v, got %v", want, keys)
+	}
+}
@@ -0,0 +1,94 @@
+package casefold
+
+import (
+	"net/url"
+	"sort"
+	"strings"
+)
+
+// foldQueryKeys applies fold to the name of every parameter in the raw query
+// string. Values, ordering and separators are preserved byte-for-byte; a key
+// is only re-encoded when folding actually changes it.
+func foldQueryKeys(raw string, fold caser) string {
+	if raw == "" {
+		return raw
+	}
+	pairs := strings.Split(raw, "&")
+	for i, pair := range pairs {
+		key, rest, hasValue := strings.Cut(pair, "=")
+		name, err := url.QueryUnescape(key)
+		if err != nil {
+			continue // leave malformed keys alone
+		}
+		folded := fold.String(name)
+		if folded == name {
+			continue
+		}
+		pairs[i] = url.QueryEscape(folded)
+		if hasValue {
+			pairs[i] += "=" + rest
+		}
+	}
+	return strings.Join(pairs, "&")
+}
+
+// canonicalQuery folds parameter names and sorts the parameters by name,
+// producing a deterministic query string for cache keys. Parameters sharing
+// a name keep their relative order, since that order can be meaningful.
+// Empty segments (`a=1&&b=2`) are dropped.
+func canonicalQuery(raw string, fold caser) string {
+	folded := foldQueryKeys(raw, fold)
+	if folded == "" {
+		return folded
+	}
+	pairs := strings.Split(folded, "&")
+	kept := pairs[:0]
+	for _, pair := range pairs {
+		if pair != "" {
+			kept = append(kept, pair)
+		}
+	}
+	sort.SliceStable(kept, func(i, j int) bool {
+		ki, _, _ := strings.Cut(kept[i], "=")
+		kj, _, _ := strings.Cut(kept[j], "=")
+		return ki < kj
+	})
+	return strings.Join(kept, "&")
+}
+
+// foldQueryValues applies fold to the values of the parameters named in
+// keys (matched case-insensitively). All other parameters are preserved
+// byte-for-byte, and a value is only re-encoded when folding changes it.
+func foldQueryValues(raw string, keys []string, fold caser) string {
+	if raw == "" || len(keys) == 0 {
+		return raw
+	}
+	pairs := strings.Split(raw, "&")
+	for i, pair := range pairs {
+		key, value, hasValue := strings.Cut(pair, "=")
+		if !hasValue {
+			continue
+		}
+		name, err := url.QueryUnescape(key)
+		if err != nil || !containsFold(keys, name) {
+			continue
+		}
+		decoded, err := url.QueryUnescape(value)
+		if err != nil {
+			continue
+		}
+		if folded := fold.String(decoded); folded != decoded {
+			pairs[i] = key + "=" + url.QueryEscape(folded)
+		}
+	}
+	return strings.Join(pairs, "&")
+}
+
+func containsFold(list []string, s string) bool {
+	for _, v := range list {
+		if strings.EqualFold(v, s) {
+			return true
+		}
+	}
+	return false
+}
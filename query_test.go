@@ -0,0 +1,82 @@
+package casefold
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/caddyserver/caddy/v2"
+)
+
+func TestFoldQueryKeys(t *testing.T) {
+	for in, want := range map[string]string{
+		"":                       "",
+		"Page=2&SORT=Name":       "page=2&sort=Name",
+		"flag&Q=A%20B&q=c":       "flag&q=A%20B&q=c",
+		"%50age=X":               "page=X",
+		"bad%zz=1&Ok=1":          "bad%zz=1&ok=1",
+		"already=lower&v=MiXeD;": "already=lower&v=MiXeD;",
+	} {
+		if got := foldQueryKeys(in, lowerCaser{}); got != want {
+			t.Errorf("foldQueryKeys(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestCasefoldFoldQueryKeys(t *testing.T) {
+	c := &Casefold{Mode: "lower", FoldQueryKeys: true}
+	if err := c.Provision(caddy.Context{}); err != nil {
+		t.Fatal(err)
+	}
+	rr := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "http://example.test/?Page=2&Lang=EN", nil)
+	if err := c.ServeHTTP(rr, req, recordHandler{t}); err != nil {
+		t.Fatal(err)
+	}
+	if got := req.URL.RawQuery; got != "page=2&lang=EN" {
+		t.Fatalf("expected folded keys, got %s", got)
+	}
+}
+
+func TestCanonicalQuery(t *testing.T) {
+	for in, want := range map[string]string{
+		"":                     "",
+		"b=2&A=1":              "a=1&b=2",
+		"tag=z&Page=1&tag=a":   "page=1&tag=z&tag=a",
+		"x=1&&Y=%2F&":          "x=1&y=%2F",
+		"sort=Desc&Filter=Red": "filter=Red&sort=Desc",
+	} {
+		if got := canonicalQuery(in, lowerCaser{}); got != want {
+			t.Errorf("canonicalQuery(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestFoldQueryValues(t *testing.T) {
+	keys := []string{"format", "LANG"}
+	for in, want := range map[string]string{
+		"format=JSON&Lang=EN&id=AbC": "format=json&Lang=en&id=AbC",
+		"FORMAT=X%20Y":               "FORMAT=x+y",
+		"format&format=":             "format&format=",
+		"id=%41&format=json":         "id=%41&format=json",
+	} {
+		if got := foldQueryValues(in, keys, lowerCaser{}); got != want {
+			t.Errorf("foldQueryValues(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestCasefoldQueryRewriteUpdatesRequestURI(t *testing.T) {
+	c := &Casefold{Mode: "lower", FoldQueryKeys: true}
+	if err := c.Provision(caddy.Context{}); err != nil {
+		t.Fatal(err)
+	}
+	rr := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "http://example.test/path?A=B", nil)
+	if err := c.ServeHTTP(rr, req, recordHandler{t}); err != nil {
+		t.Fatal(err)
+	}
+	if req.RequestURI != "/path?a=B" {
+		t.Fatalf("expected RequestURI /path?a=B, got %s", req.RequestURI)
+	}
+}
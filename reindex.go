@@ -0,0 +1,45 @@
+package casefold
+
+import (
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// replace swaps in the contents of fresh, so lookups see either the old
+// index or the new one and never a partial rebuild. fresh must not be used
+// afterwards: its maps are idx's now, guarded by idx.mu.
+func (idx *pathIndex) replace(fresh *pathIndex) {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+	idx.paths, idx.dups, idx.dirs = fresh.paths, fresh.dups, fresh.dirs
+}
+
+// reindexLoop rebuilds st's preloaded index every interval until stop is
+// closed. A failed rebuild keeps the current index.
+func (st *fsState) reindexLoop(interval time.Duration, stop <-chan struct{}) {
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-t.C:
+		}
+		started := time.Now()
+		fresh, err := buildIndexParallel(st.fsys, st.norm, st.workers, nil)
+		if err != nil {
+			st.log.Warn("casefold failed to rebuild fs index; keeping the current one", zap.String("root", st.root), zap.Error(err))
+			continue
+		}
+		n := fresh.Len()
+		st.index.replace(fresh)
+		st.log.Debug("casefold rebuilt fs index", zap.String("root", st.root), zap.Int("paths", n), zap.Duration("took", time.Since(started)))
+		if st.indexFile != "" {
+			// from st.index, under its lock: the watcher may be refreshing it
+			if err := saveSnapshot(st.indexFile, st.root, st.indexStamp, started, st.index); err != nil {
+				st.log.Warn("casefold failed to save fs index snapshot", zap.String("file", st.indexFile), zap.Error(err))
+			}
+		}
+	}
+}
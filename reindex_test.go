@@ -0,0 +1,113 @@
+package casefold
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/caddyserver/caddy/v2"
+)
+
+func TestReindexInterval(t *testing.T) {
+	root := t.TempDir()
+	if err := os.WriteFile(filepath.Join(root, "Old.HTML"), nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	c := &Casefold{Mode: "fs", Root: root, Preload: true, ReindexInterval: caddy.Duration(10 * time.Millisecond)}
+	if err := c.Provision(caddy.Context{}); err != nil {
+		t.Fatal(err)
+	}
+	defer c.Cleanup()
+	if _, ok := c.resolveFS("/new.html"); ok {
+		t.Fatal("expected /new.html to be missing from the index")
+	}
+	if err := os.WriteFile(filepath.Join(root, "New.HTML"), nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		if got, ok := c.resolveFS("/new.html"); ok {
+			if got != "/New.HTML" {
+				t.Fatalf("expected /New.HTML, got %s", got)
+			}
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("reindex never picked up /New.HTML")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	if got, ok := c.resolveFS("/OLD.html"); !ok || got != "/Old.HTML" {
+		t.Errorf("expected /Old.HTML to survive the rebuild, got %q %v", got, ok)
+	}
+
+	if err := (&Casefold{Mode: "fs", Root: root, ReindexInterval: caddy.Duration(time.Minute)}).Provision(caddy.Context{}); err == nil {
+		t.Error("reindex_interval without preload accepted")
+	}
+}
+
+func TestReindexOutlivesCreator(t *testing.T) {
+	root := t.TempDir()
+	if err := os.WriteFile(filepath.Join(root, "Old.HTML"), nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	snapshot := filepath.Join(t.TempDir(), "index.json")
+	cfg := func() *Casefold {
+		return &Casefold{Mode: "fs", Root: root, Preload: true, IndexFile: snapshot, ReindexInterval: caddy.Duration(10 * time.Millisecond)}
+	}
+	oldCfg, newCfg := cfg(), cfg()
+	for _, c := range []*Casefold{oldCfg, newCfg} {
+		if err := c.Provision(caddy.Context{}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	defer newCfg.Cleanup()
+	if err := oldCfg.Cleanup(); err != nil {
+		t.Fatal(err)
+	}
+	if oldCfg.state != newCfg.state {
+		t.Fatal("expected the reload to keep the state")
+	}
+	// the rebuild must not reach back into the cleaned-up handler
+	oldCfg.IndexFile = filepath.Join(root, "missing", "index.json")
+	oldCfg.log = nil
+
+	if err := os.WriteFile(filepath.Join(root, "New.HTML"), nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		data, _ := os.ReadFile(snapshot)
+		if _, ok := newCfg.resolveFS("/new.html"); ok && strings.Contains(string(data), "New.HTML") {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("reindex never picked up /New.HTML after the reload")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestReindexWhileWatching(t *testing.T) {
+	root := t.TempDir()
+	c := &Casefold{Mode: "fs", Root: root, Preload: true, Watch: true, IndexFile: filepath.Join(t.TempDir(), "index.json"),
+		ReindexInterval: caddy.Duration(time.Millisecond)}
+	if err := c.Provision(caddy.Context{}); err != nil {
+		t.Fatal(err)
+	}
+	defer c.Cleanup()
+	// watcher refreshes race the rebuilds and their snapshots under -race
+	for i := 0; i < 50; i++ {
+		name := filepath.Join(root, "File"+strings.Repeat("x", i%5)+".txt")
+		if err := os.WriteFile(name, nil, 0o644); err != nil {
+			t.Fatal(err)
+		}
+		if i%2 == 1 {
+			_ = os.Remove(name)
+		}
+		time.Sleep(time.Millisecond)
+	}
+	time.Sleep(20 * time.Millisecond)
+}
@@ -0,0 +1,94 @@
+package casefold
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+// replaceTable holds explicit substring mappings that take precedence over
+// a mode's caser: matched text is written as its replacement and never
+// passed through the caser, so {"ß": "ß"} keeps fold mode from expanding ß
+// to ss and {"Æ": "ae"} adds a mapping the caser lacks. Entries are indexed
+// by their first rune, longest key first.
+type replaceTable map[rune][]replacement
+
+type replacement struct{ from, to string }
+
+func newReplaceTable(m map[string]string) (replaceTable, error) {
+	if len(m) == 0 {
+		return nil, nil
+	}
+	t := make(replaceTable)
+	for from, to := range m {
+		if from == "" {
+			return nil, fmt.Errorf("replace: empty key (replacement %q)", to)
+		}
+		if strings.Contains(to, "/") || strings.Contains(from, "/") {
+			return nil, fmt.Errorf("replace: %q -> %q: mappings must not contain '/'", from, to)
+		}
+		r, _ := utf8.DecodeRuneInString(from)
+		t[r] = append(t[r], replacement{from, to})
+	}
+	for _, rs := range t {
+		sort.Slice(rs, func(i, j int) bool { return len(rs[i].from) > len(rs[j].from) })
+	}
+	return t, nil
+}
+
+// wrap returns cs with the table applied, or cs itself for an empty table.
+// Title casing is wrapped word-internally so the first letter of a mapped
+// word is still capitalized.
+func (t replaceTable) wrap(cs caser) caser {
+	if len(t) == 0 {
+		return cs
+	}
+	if tc, ok := cs.(titleCaser); ok {
+		return titleCaser{lower: t.wrap(tc.lower), upper: t.wrap(tc.upper)}
+	}
+	return replacingCaser{table: t, base: cs}
+}
+
+// match returns the longest entry that s starts with.
+func (t replaceTable) match(s string) (replacement, bool) {
+	r, _ := utf8.DecodeRuneInString(s)
+	for _, rep := range t[r] {
+		if strings.HasPrefix(s, rep.from) {
+			return rep, true
+		}
+	}
+	return replacement{}, false
+}
+
+// replacingCaser applies a replaceTable, passing the text between matches
+// through base.
+type replacingCaser struct {
+	table replaceTable
+	base  caser
+}
+
+func (rc replacingCaser) String(s string) string {
+	var b strings.Builder
+	b.Grow(len(s))
+	start := 0 // beginning of the pending run for base
+	for i := 0; i < len(s); {
+		rep, ok := rc.table.match(s[i:])
+		if !ok {
+			_, size := utf8.DecodeRuneInString(s[i:])
+			i += size
+			continue
+		}
+		if start < i {
+			b.WriteString(rc.base.String(s[start:i]))
+		}
+		b.WriteString(rep.to)
+		i += len(rep.from)
+		start = i
+	}
+	if start == 0 {
+		return rc.base.String(s)
+	}
+	b.WriteString(rc.base.String(s[start:]))
+	return b.String()
+}
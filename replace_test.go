@@ -0,0 +1,42 @@
+package casefold
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/caddyserver/caddy/v2"
+)
+
+func TestReplace(t *testing.T) {
+	for _, tc := range []struct {
+		mode, locale string
+		replace      map[string]string
+		in, want     string
+	}{
+		{"fold", "", nil, "/Straße", "/strasse"},
+		{"fold", "", map[string]string{"ß": "ß"}, "/Straße", "/straße"},
+		{"lower", "", map[string]string{"Æ": "ae", "æ": "ae"}, "/ÆRØ/Kræmmerhus", "/aerø/kraemmerhus"},
+		{"lower", "", map[string]string{"&": "and", "&amp;": "and"}, "/Tom&amp;Jerry/A&B", "/tomandjerry/aandb"},
+		{"title", "", map[string]string{"æ": "ae", "Æ": "ae"}, "/æble-KAGE", "/Aeble-Kage"},
+		{"upper", "tr", map[string]string{"i": "I"}, "/istanbul", "/ISTANBUL"},
+		{"ascii", "", map[string]string{"ø": "oe"}, "/Sørensen-Café", "/soerensen-cafe"},
+	} {
+		c := &Casefold{Mode: tc.mode, Locale: tc.locale, Replace: tc.replace}
+		if err := c.Provision(caddy.Context{}); err != nil {
+			t.Fatal(err)
+		}
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		if got, _ := c.transform(req, tc.in); got != tc.want {
+			t.Errorf("%s %v %s: expected %q, got %q", tc.mode, tc.replace, tc.in, tc.want, got)
+		}
+	}
+}
+
+func TestInvalidReplace(t *testing.T) {
+	for _, m := range []map[string]string{{"": "x"}, {"a/b": "c"}} {
+		if err := (&Casefold{Replace: m}).Provision(caddy.Context{}); err == nil {
+			t.Errorf("expected %v to be rejected", m)
+		}
+	}
+}
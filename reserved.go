@@ -0,0 +1,55 @@
+package casefold
+
+import (
+	"fmt"
+	"strings"
+)
+
+// ReservedNames policies.
+const (
+	reservedNamesSkip   = "skip"
+	reservedNamesReject = "reject"
+)
+
+// windowsReserved are the device names Windows resolves in every
+// directory, whatever the extension.
+var windowsReserved = func() map[string]bool {
+	m := map[string]bool{"CON": true, "PRN": true, "AUX": true, "NUL": true, "CONIN$": true, "CONOUT$": true}
+	for _, d := range []string{"0", "1", "2", "3", "4", "5", "6", "7", "8", "9", "¹", "²", "³"} {
+		m["COM"+d] = true
+		m["LPT"+d] = true
+	}
+	return m
+}()
+
+// reservedSegment returns the first segment of p naming a Windows device,
+// such as con, NUL.txt or com1 .log, or "".
+func reservedSegment(p string) string {
+	for _, seg := range strings.Split(p, "/") {
+		name := seg
+		if i := strings.IndexByte(name, '.'); i >= 0 {
+			name = name[:i]
+		}
+		if windowsReserved[strings.ToUpper(strings.TrimRight(name, " "))] {
+			return seg
+		}
+	}
+	return ""
+}
+
+// skipReserved reports whether fs mode must leave p unresolved under the
+// skip policy.
+func (c *Casefold) skipReserved(p string) bool {
+	return c.ReservedNames == reservedNamesSkip && reservedSegment(p) != ""
+}
+
+// rejectReserved fails p under the reject policy.
+func (c *Casefold) rejectReserved(p string) error {
+	if c.ReservedNames != reservedNamesReject {
+		return nil
+	}
+	if seg := reservedSegment(p); seg != "" {
+		return fmt.Errorf("reserved device name %q in path %q", seg, p)
+	}
+	return nil
+}
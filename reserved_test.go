@@ -0,0 +1,60 @@
+package casefold
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/caddyserver/caddy/v2"
+	"github.com/caddyserver/caddy/v2/modules/caddyhttp"
+)
+
+func TestReservedNames(t *testing.T) {
+	for p, want := range map[string]string{
+		"/docs/nul.txt":   "nul.txt",
+		"/CON":            "CON",
+		"/a/com1 .log/b":  "com1 .log",
+		"/lpt²":           "lpt²",
+		"/console/com10":  "",
+		"/docs/null.txt":  "",
+		"/conout$.tar.gz": "conout$.tar.gz",
+	} {
+		if got := reservedSegment(p); got != want {
+			t.Errorf("reservedSegment(%q) = %q, want %q", p, got, want)
+		}
+	}
+
+	root := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(root, "Docs"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(root, "Docs", "Nul.txt"), nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	for policy, want := range map[string]string{"": "/Docs/Nul.txt", "skip": "/docs/nul.txt"} {
+		c := &Casefold{Mode: "fs", Root: root, ReservedNames: policy}
+		if err := c.Provision(caddy.Context{}); err != nil {
+			t.Fatal(err)
+		}
+		rr := httptest.NewRecorder()
+		if err := c.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/docs/nul.txt", nil), recordHandler{t}); err != nil {
+			t.Fatal(err)
+		}
+		if got := rr.Header().Get("X-Final-Path"); got != want {
+			t.Errorf("%q: expected %s, got %s", policy, want, got)
+		}
+	}
+
+	c := &Casefold{Mode: "lower", ReservedNames: "reject"}
+	if err := c.Provision(caddy.Context{}); err != nil {
+		t.Fatal(err)
+	}
+	err := c.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/Files/COM1.txt", nil), recordHandler{t})
+	var herr caddyhttp.HandlerError
+	if !errors.As(err, &herr) || herr.StatusCode != http.StatusBadRequest {
+		t.Errorf("reject: expected 400, got %v", err)
+	}
+}
@@ -0,0 +1,35 @@
+package casefold
+
+import (
+	"net/http"
+
+	"go.uber.org/zap"
+)
+
+// Resolver is implemented by guest modules in the
+// http.handlers.casefold.resolvers namespace. Resolvers let third parties
+// plug their own canonicalization backends (databases, APIs, custom indexes)
+// into the handler's "resolver" mode.
+//
+// Resolve receives the request and its cleaned, lowercased path and returns
+// the canonical path to route to. ok reports whether the path is known;
+// when it is false (or err is non-nil) the request passes through unchanged.
+// Resolvers are called concurrently and must be safe for concurrent use.
+type Resolver interface {
+	Resolve(r *http.Request, folded string) (canonical string, ok bool, err error)
+}
+
+// resolve runs the configured resolver for p.
+func (c *Casefold) resolve(r *http.Request, p string) (string, bool) {
+	canon, ok, err := c.resolver.Resolve(r, foldedKey(c.norm.String(p)))
+	if err != nil {
+		if c.log != nil {
+			c.log.Warn("casefold resolver failed; passing path through", zap.String("path", p), zap.Error(err))
+		}
+		return p, false
+	}
+	if !ok || canon == "" {
+		return p, false
+	}
+	return canon, true
+}
@@ -0,0 +1,42 @@
+package casefold
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/caddyserver/caddy/v2"
+)
+
+type staticResolver map[string]string
+
+func (s staticResolver) Resolve(_ *http.Request, folded string) (string, bool, error) {
+	if folded == "/broken" {
+		return "", false, errors.New("backend down")
+	}
+	canon, ok := s[folded]
+	return canon, ok, nil
+}
+
+func TestCasefoldResolverMode(t *testing.T) {
+	c := &Casefold{Mode: "resolver", resolver: staticResolver{"/products/widget": "/Products/Widget"}}
+	for in, want := range map[string]string{
+		"/PRODUCTS//widget": "/Products/Widget",
+		"/unknown":          "/unknown",
+		"/broken":           "/broken",
+	} {
+		rr := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, "http://example.test"+in, nil)
+		if err := c.ServeHTTP(rr, req, recordHandler{t}); err != nil {
+			t.Fatal(err)
+		}
+		if got := rr.Header().Get("X-Final-Path"); got != want {
+			t.Errorf("%s: expected %s, got %s", in, want, got)
+		}
+	}
+
+	if err := (&Casefold{Mode: "resolver"}).Provision(caddy.Context{}); err == nil {
+		t.Fatal("expected error for resolver mode without a resolver module")
+	}
+}
@@ -0,0 +1,64 @@
+package casefold
+
+import (
+	"bytes"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/caddyserver/caddy/v2/modules/caddyhttp"
+	"go.uber.org/zap"
+)
+
+// serveRetry implements RetryOn404. The first pass runs on a copy of r, so
+// handlers that rewrite it leave the retry unaffected; a 404 response is
+// buffered instead of written, and replayed if the transform does not
+// change the path.
+func (c *Casefold) serveRetry(w http.ResponseWriter, r *http.Request, next caddyhttp.Handler, orig string) error {
+	c.annotate(r, orig, orig, false)
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		return next.ServeHTTP(w, r)
+	}
+	header := w.Header().Clone()
+	var buf bytes.Buffer
+	rec := caddyhttp.NewResponseRecorder(w, &buf, func(status int, _ http.Header) bool {
+		return status == http.StatusNotFound
+	})
+	err := next.ServeHTTP(rec, r.Clone(r.Context()))
+	wrote404 := rec.Buffered() && rec.Status() == http.StatusNotFound
+	var herr caddyhttp.HandlerError
+	if !(wrote404 && err == nil) && !(errors.As(err, &herr) && herr.StatusCode == http.StatusNotFound) {
+		return err
+	}
+
+	start := time.Now()
+	transformed, raw, terr := c.transformRequest(r, orig)
+	if c.Candidates {
+		c.publishCandidates(r, orig, transformed)
+	}
+	if terr == nil && transformed == orig && raw == r.URL.RawPath {
+		if c.SuggestHeader != "" {
+			c.setSuggestionHeader(w, r)
+		}
+		if wrote404 {
+			return rec.WriteResponse()
+		}
+		return err
+	}
+	if c.Verbose && c.log != nil {
+		c.log.Debug("casefold retrying after 404", zap.String("path", orig), zap.String("to", transformed))
+	}
+	// drop the headers the first pass set
+	for k := range w.Header() {
+		delete(w.Header(), k)
+	}
+	for k, v := range header {
+		w.Header()[k] = v
+	}
+	if c.SuggestHeader != "" {
+		c.setSuggestionHeader(w, r)
+	}
+	c.rewriteQuery(r)
+	c.foldHost(r)
+	return c.serveTransformed(w, r, next, orig, transformed, raw, terr, time.Since(start))
+}
@@ -0,0 +1,70 @@
+package casefold
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/caddyserver/caddy/v2"
+	"github.com/caddyserver/caddy/v2/modules/caddyhttp"
+)
+
+// lowercaseSite serves only the paths in pages, answering anything else
+// with a 404 written by itself (written) or returned as an error.
+type lowercaseSite struct {
+	pages   map[string]bool
+	written bool
+	calls   int
+}
+
+func (s *lowercaseSite) ServeHTTP(w http.ResponseWriter, r *http.Request) error {
+	s.calls++
+	w.Header().Set("X-Pass", r.URL.Path)
+	if !s.pages[r.URL.Path] {
+		if !s.written {
+			return caddyhttp.Error(http.StatusNotFound, errors.New("not found"))
+		}
+		w.WriteHeader(http.StatusNotFound)
+		_, _ = w.Write([]byte("missing " + r.URL.Path))
+		return nil
+	}
+	_, _ = w.Write([]byte("page " + r.URL.Path))
+	return nil
+}
+
+func TestRetryOn404(t *testing.T) {
+	c := &Casefold{Mode: "lower", RetryOn404: true}
+	if err := c.Provision(caddy.Context{}); err != nil {
+		t.Fatal(err)
+	}
+	for _, written := range []bool{true, false} {
+		site := &lowercaseSite{pages: map[string]bool{"/Exact": true, "/docs": true}, written: written}
+		serve := func(method, p string) (*httptest.ResponseRecorder, error) {
+			site.calls = 0
+			rr := httptest.NewRecorder()
+			return rr, c.ServeHTTP(rr, httptest.NewRequest(method, p, nil), site)
+		}
+
+		// an exact match is served as is, without a retry
+		rr, err := serve(http.MethodGet, "/Exact")
+		if err != nil || rr.Body.String() != "page /Exact" || site.calls != 1 {
+			t.Errorf("written=%t: exact match: %q, %d calls, %v", written, rr.Body.String(), site.calls, err)
+		}
+		// a miss is retried with the folded path, and the first pass leaves no trace
+		rr, err = serve(http.MethodGet, "/DOCS")
+		if err != nil || rr.Code != http.StatusOK || rr.Body.String() != "page /docs" || site.calls != 2 || rr.Header().Get("X-Pass") != "/docs" {
+			t.Errorf("written=%t: retry: %d %q, %d calls, X-Pass %q, %v", written, rr.Code, rr.Body.String(), site.calls, rr.Header().Get("X-Pass"), err)
+		}
+		// the transform changes nothing: the original 404 stands
+		rr, err = serve(http.MethodGet, "/missing")
+		var herr caddyhttp.HandlerError
+		if site.calls != 1 || (written && (err != nil || rr.Code != http.StatusNotFound || rr.Body.String() != "missing /missing")) || (!written && (!errors.As(err, &herr) || herr.StatusCode != http.StatusNotFound)) {
+			t.Errorf("written=%t: replay: %d %q, %d calls, %v", written, rr.Code, rr.Body.String(), site.calls, err)
+		}
+		// other methods are never retried
+		if _, _ = serve(http.MethodPost, "/DOCS"); site.calls != 1 {
+			t.Errorf("written=%t: POST ran the chain %d times", written, site.calls)
+		}
+	}
+}
@@ -0,0 +1,44 @@
+package casefold
+
+import (
+	"net/http"
+	"sync/atomic"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// rewriteLogger writes a debug entry for every nth rewrite, so busy sites can
+// audit the middleware without logging each request. A nil *rewriteLogger
+// logs nothing.
+type rewriteLogger struct {
+	log   *zap.Logger
+	level zapcore.Level
+	every uint64
+	seen  atomic.Uint64
+}
+
+func newRewriteLogger(log *zap.Logger, every int) *rewriteLogger {
+	return &rewriteLogger{log: log, level: zap.DebugLevel, every: uint64(every)}
+}
+
+// Log counts a rewrite (or redirect) of orig to canon and logs it if it is
+// the one selected by the sampling rate. The first rewrite is always logged.
+func (rl *rewriteLogger) Log(r *http.Request, action, orig, canon, mode string) {
+	if rl == nil {
+		return
+	}
+	if (rl.seen.Add(1)-1)%rl.every != 0 {
+		return
+	}
+	if ce := rl.log.Check(rl.level, "casefold "+action); ce != nil {
+		ce.Write(
+			zap.String("from", orig),
+			zap.String("to", canon),
+			zap.String("mode", mode),
+			zap.String("host", r.Host),
+			zap.String("remote_addr", r.RemoteAddr),
+			zap.Uint64("sample_rate", rl.every),
+		)
+	}
+}
@@ -0,0 +1,40 @@
+package casefold
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+func TestRewriteLoggerSampling(t *testing.T) {
+	core, logs := observer.New(zapcore.DebugLevel)
+	c := &Casefold{rewriteLog: newRewriteLogger(zap.New(core), 3)}
+	c.fold = lowerCaser{}
+	c.OriginalURIHeader = "X-Original-URI"
+	for i := 0; i < 7; i++ {
+		req := httptest.NewRequest(http.MethodGet, "/Mixed", nil)
+		if err := c.ServeHTTP(httptest.NewRecorder(), req, recordHandler{t}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	req := httptest.NewRequest(http.MethodGet, "/already-lower", nil)
+	if err := c.ServeHTTP(httptest.NewRecorder(), req, recordHandler{t}); err != nil {
+		t.Fatal(err)
+	}
+	if n := logs.Len(); n != 3 {
+		t.Fatalf("expected 3 sampled entries out of 7 rewrites, got %d", n)
+	}
+	ent := logs.All()[0]
+	if ent.Message != "casefold rewrite" || ent.ContextMap()["to"] != "/mixed" {
+		t.Fatalf("unexpected entry: %s %v", ent.Message, ent.ContextMap())
+	}
+}
+
+func TestRewriteLoggerNil(t *testing.T) {
+	var rl *rewriteLogger
+	rl.Log(httptest.NewRequest(http.MethodGet, "/", nil), "rewrite", "/A", "/a", "lower")
+}
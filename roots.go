@@ -0,0 +1,290 @@
+package casefold
+
+import (
+	"container/list"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/caddyserver/caddy/v2"
+	"go.uber.org/zap"
+)
+
+// expandPlaceholders replaces global placeholders such as {env.SITE_ROOT}
+// in Root and Exclude. A Root still holding placeholders afterwards, such
+// as {http.vars.root}, is resolved per request; excludes are compiled
+// once, so they may only use global placeholders.
+func (c *Casefold) expandPlaceholders() error {
+	repl := caddy.NewReplacer()
+	c.Root = repl.ReplaceKnown(c.Root, "")
+	if hasPlaceholder(c.Root) {
+		c.setRootTemplate(c.Root)
+	}
+	if len(c.HostRoots) > 0 {
+		roots := make(map[string]string, len(c.HostRoots))
+		for name, root := range c.HostRoots {
+			key, err := hostKey(name)
+			if err != nil {
+				return fmt.Errorf("roots: %v", err)
+			}
+			if _, dup := roots[key]; dup {
+				return fmt.Errorf("roots: host %q configured twice", name)
+			}
+			if root == "" {
+				return fmt.Errorf("roots: host %q: missing root", name)
+			}
+			roots[key] = repl.ReplaceKnown(root, "")
+		}
+		c.HostRoots = roots
+		if c.roots == nil {
+			c.roots = newDynamicRoots()
+		}
+	}
+	for i, p := range c.Exclude {
+		e := repl.ReplaceKnown(p, "")
+		if hasPlaceholder(e) {
+			return fmt.Errorf("exclude pattern %q: only global placeholders such as {env.*} are supported", p)
+		}
+		c.Exclude[i] = e
+	}
+	return nil
+}
+
+// siteRoot is the placeholder the root directive sets, used as fs mode's
+// root when none is configured.
+const siteRoot = "{http.vars.root}"
+
+// setRootTemplate makes fs lookups resolve against tpl, expanded per
+// request.
+func (c *Casefold) setRootTemplate(tpl string) {
+	c.rootTemplate = tpl
+	c.roots = newDynamicRoots()
+}
+
+// hasPlaceholder reports whether s contains a {placeholder}.
+func hasPlaceholder(s string) bool {
+	i := strings.IndexByte(s, '{')
+	return i >= 0 && strings.IndexByte(s[i:], '}') > 1
+}
+
+// dynamicRootsSize caps the per-request roots a handler holds at once, and
+// dynamicRootRetry is how long a root that failed to set up is passed
+// through before it is tried again. Roots come from request data such as
+// the Host header, so neither their number nor failing ones may cost
+// without bound.
+var (
+	dynamicRootsSize = 256
+	dynamicRootRetry = 30 * time.Second
+)
+
+// dynamicRoots holds the fs-mode lookups of a per-request Root, one per
+// distinct expanded root, created on first use. It is an LRU of at most
+// dynamicRootsSize roots; evicted roots release their fs state.
+type dynamicRoots struct {
+	mu    sync.Mutex
+	ll    *list.List
+	items map[string]*list.Element
+	now   func() time.Time
+}
+
+// dynamicRoot is an entry of dynamicRoots: the root's handler, or nil
+// until retry for a root whose setup failed.
+type dynamicRoot struct {
+	root  string
+	fc    *Casefold
+	retry time.Time
+}
+
+func newDynamicRoots() *dynamicRoots {
+	return &dynamicRoots{ll: list.New(), items: make(map[string]*list.Element), now: time.Now}
+}
+
+// fsForRequest returns the handler resolving fs lookups of r against tpl,
+// expanded for r, or nil if the root does not resolve for r, does not
+// exist, or recently failed to set up.
+func (c *Casefold) fsForRequest(r *http.Request, tpl string) *Casefold {
+	root := tpl
+	if hasPlaceholder(tpl) {
+		repl, ok := r.Context().Value(caddy.ReplacerCtxKey).(*caddy.Replacer)
+		if !ok {
+			return nil
+		}
+		root = repl.ReplaceKnown(tpl, "")
+	}
+	if root == "" || hasPlaceholder(root) {
+		if c.Verbose && c.log != nil {
+			c.log.Debug("casefold root unresolved for request", zap.String("root", tpl), zap.String("path", r.URL.Path))
+		}
+		return nil
+	}
+	if c.onLocalDisk() && !filepath.IsAbs(root) {
+		if abs, err := filepath.Abs(root); err == nil {
+			root = abs
+		}
+	}
+	dr := c.roots
+	dr.mu.Lock()
+	defer dr.mu.Unlock()
+	if el, ok := dr.items[root]; ok {
+		ent := el.Value.(*dynamicRoot)
+		if ent.fc != nil || dr.now().Before(ent.retry) {
+			dr.ll.MoveToFront(el)
+			return ent.fc
+		}
+		dr.ll.Remove(el)
+		delete(dr.items, root)
+	}
+	// missing roots are not remembered, so they cannot evict real ones
+	if err := c.statRoot(root); err != nil {
+		if c.Verbose && c.log != nil {
+			c.log.Debug("casefold root unusable for request", zap.String("root", root), zap.Error(err))
+		}
+		return nil
+	}
+	ent := &dynamicRoot{root: root, fc: c.fsHandler(root)}
+	if err := ent.fc.Provision(c.ctx); err != nil {
+		c.log.Warn("casefold failed to set up root; passing path through", zap.String("root", root), zap.Duration("retry_in", dynamicRootRetry), zap.Error(err))
+		ent.fc, ent.retry = nil, dr.now().Add(dynamicRootRetry)
+	}
+	dr.items[root] = dr.ll.PushFront(ent)
+	for dr.ll.Len() > dynamicRootsSize {
+		if err := dr.evict(dr.ll.Back()); err != nil {
+			c.log.Warn("casefold failed to release evicted root", zap.Error(err))
+		}
+	}
+	return ent.fc
+}
+
+// statRoot reports an error unless root, which fsHandler would resolve
+// against, is a directory. Roots in a FileSystem are left to Provision.
+func (c *Casefold) statRoot(root string) error {
+	switch {
+	case c.FS != nil:
+		sub, err := fs.Sub(c.FS, fsPath(root))
+		if err != nil {
+			return err
+		}
+		return checkRoot(sub, root)
+	case c.FileSystem == "":
+		return checkRoot(os.DirFS(root), root)
+	}
+	return nil
+}
+
+// evict drops el and releases its root's fs state.
+func (dr *dynamicRoots) evict(el *list.Element) error {
+	ent := el.Value.(*dynamicRoot)
+	dr.ll.Remove(el)
+	delete(dr.items, ent.root)
+	if ent.fc == nil {
+		return nil
+	}
+	return ent.fc.Cleanup()
+}
+
+// Len returns the number of roots held, failed ones included.
+func (dr *dynamicRoots) Len() int {
+	dr.mu.Lock()
+	defer dr.mu.Unlock()
+	return dr.ll.Len()
+}
+
+// fsHandler returns an unprovisioned handler resolving fs lookups against
+// root with c's fs settings.
+func (c *Casefold) fsHandler(root string) *Casefold {
+	return &Casefold{
+		Mode:             "fs",
+		Root:             root,
+		FileSystem:       c.FileSystem,
+		FS:               c.FS,
+		Normalize:        c.Normalize,
+		CacheSize:        c.CacheSize,
+		CacheTTL:         c.CacheTTL,
+		NegativeCacheTTL: c.NegativeCacheTTL,
+		DirCacheSize:     c.DirCacheSize,
+		Preload:          c.Preload,
+		PreloadWorkers:   c.PreloadWorkers,
+		ReindexInterval:  c.ReindexInterval,
+		Watch:            c.Watch,
+		Ambiguity:        c.Ambiguity,
+		Hide:             c.Hide,
+		ShowHidden:       c.ShowHidden,
+		FullResolve:      c.FullResolve,
+		MaxSegments:      c.MaxSegments,
+		MaxDirEntries:    c.MaxDirEntries,
+		ResolveTimeout:   c.ResolveTimeout,
+		Verbose:          c.Verbose,
+		embedded:         true,
+	}
+}
+
+// provisionFallbackRoots sets up a lookup for each of FallbackRoots.
+func (c *Casefold) provisionFallbackRoots(ctx caddy.Context) error {
+	for _, root := range c.FallbackRoots {
+		fc := c.fsHandler(root)
+		if err := fc.Provision(ctx); err != nil {
+			return fmt.Errorf("root %s: %v", root, err)
+		}
+		c.fallbacks = append(c.fallbacks, fc)
+	}
+	return nil
+}
+
+// lookupRoot resolves p against r's HostRoots entry, if any, or else Root,
+// expanded for r if they hold placeholders. source is empty when the root
+// does not resolve for r, or p is not looked up: it holds bytes no
+// directory entry is compared against (see invalidPath), or a reserved name
+// under ReservedNames skip.
+func (c *Casefold) lookupRoot(r *http.Request, p string) (canon string, ok bool, source string, err error) {
+	if invalidPath(p) != "" {
+		return p, false, "", nil
+	}
+	if c.skipReserved(p) {
+		if c.Verbose && c.log != nil {
+			c.log.Debug("casefold fs resolution skipped (reserved name)", zap.String("path", p))
+		}
+		return p, false, "", nil
+	}
+	fc := c.rootFor(r)
+	if fc == nil {
+		return p, false, "", nil
+	}
+	canon, ok, source, err = fc.lookupFS(p)
+	if ok && c.hidden(canon) {
+		if c.Verbose && c.log != nil {
+			c.log.Debug("casefold fs resolution hidden", zap.String("path", p))
+		}
+		return p, false, source, nil
+	}
+	return canon, ok, source, err
+}
+
+// rootFor returns the handler resolving r's fs lookups: c itself, or the
+// one for r's HostRoots entry or expanded Root. It is nil when the root
+// does not resolve for r.
+func (c *Casefold) rootFor(r *http.Request) *Casefold {
+	if tpl, found := matchHost(c.HostRoots, r); found {
+		return c.fsForRequest(r, tpl)
+	}
+	if c.rootTemplate != "" && c.fsys == nil {
+		return c.fsForRequest(r, c.rootTemplate)
+	}
+	return c
+}
+
+// Cleanup releases every root's fs-mode state.
+func (dr *dynamicRoots) Cleanup() error {
+	dr.mu.Lock()
+	defer dr.mu.Unlock()
+	for dr.ll.Len() > 0 {
+		if err := dr.evict(dr.ll.Back()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,273 @@
+package casefold
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/caddyserver/caddy/v2"
+	"github.com/caddyserver/caddy/v2/modules/caddyhttp"
+)
+
+func TestRootEnvPlaceholder(t *testing.T) {
+	root := t.TempDir()
+	if err := os.WriteFile(filepath.Join(root, "About.HTML"), nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("CASEFOLD_TEST_ROOT", root)
+	t.Setenv("CASEFOLD_TEST_API", "/API")
+	c := &Casefold{Mode: "fs", Root: "{env.CASEFOLD_TEST_ROOT}", Exclude: []string{"{env.CASEFOLD_TEST_API}/*"}}
+	if err := c.Provision(caddy.Context{}); err != nil {
+		t.Fatal(err)
+	}
+	defer c.Cleanup()
+	if c.Root != root || c.rootTemplate != "" || c.Exclude[0] != "/API/*" {
+		t.Fatalf("expected placeholders expanded at provision, got root %q, exclude %v", c.Root, c.Exclude)
+	}
+	rr := httptest.NewRecorder()
+	if err := c.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/about.html", nil), recordHandler{t}); err != nil {
+		t.Fatal(err)
+	}
+	if got := rr.Header().Get("X-Final-Path"); got != "/About.HTML" {
+		t.Fatalf("expected /About.HTML, got %s", got)
+	}
+}
+
+func TestRootRequestPlaceholder(t *testing.T) {
+	a, b := t.TempDir(), t.TempDir()
+	if err := os.WriteFile(filepath.Join(a, "Readme.md"), nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(b, "README.MD"), nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	c := &Casefold{Mode: "fs", Root: "{http.vars.root}"}
+	if err := c.Provision(caddy.Context{}); err != nil {
+		t.Fatal(err)
+	}
+	defer c.Cleanup()
+	serve := func(root string) string {
+		req := httptest.NewRequest(http.MethodGet, "/readme.md", nil)
+		vars := map[string]any{}
+		if root != "" {
+			vars["root"] = root
+		}
+		*req = *req.WithContext(context.WithValue(req.Context(), caddyhttp.VarsCtxKey, vars))
+		caddyhttp.NewTestReplacer(req)
+		rr := httptest.NewRecorder()
+		if err := c.ServeHTTP(rr, req, recordHandler{t}); err != nil {
+			t.Fatal(err)
+		}
+		return rr.Header().Get("X-Final-Path")
+	}
+	if got := serve(a); got != "/Readme.md" {
+		t.Errorf("root a: expected /Readme.md, got %s", got)
+	}
+	if got := serve(b); got != "/README.MD" {
+		t.Errorf("root b: expected /README.MD, got %s", got)
+	}
+	if got := serve(""); got != "/readme.md" {
+		t.Errorf("unset root: expected path passed through, got %s", got)
+	}
+	if n := c.roots.Len(); n != 2 {
+		t.Errorf("expected one lookup per distinct root, got %d", n)
+	}
+}
+
+func TestExcludeRequestPlaceholderRejected(t *testing.T) {
+	c := &Casefold{Exclude: []string{"{http.vars.prefix}/*"}}
+	if err := c.Provision(caddy.Context{}); err == nil {
+		t.Fatal("expected request placeholder in exclude to fail provisioning")
+	}
+}
+
+func TestRootDefaultsToSiteRoot(t *testing.T) {
+	root := t.TempDir()
+	if err := os.WriteFile(filepath.Join(root, "Index.HTML"), nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	c := &Casefold{Mode: "fs"}
+	if err := c.Provision(caddy.Context{}); err != nil {
+		t.Fatal(err)
+	}
+	defer c.Cleanup()
+	if c.rootTemplate != siteRoot {
+		t.Fatalf("expected fs mode without root to use %s, got %q", siteRoot, c.rootTemplate)
+	}
+	req := httptest.NewRequest(http.MethodGet, "/index.html", nil)
+	*req = *req.WithContext(context.WithValue(req.Context(), caddyhttp.VarsCtxKey, map[string]any{"root": root}))
+	caddyhttp.NewTestReplacer(req)
+	rr := httptest.NewRecorder()
+	if err := c.ServeHTTP(rr, req, recordHandler{t}); err != nil {
+		t.Fatal(err)
+	}
+	if got := rr.Header().Get("X-Final-Path"); got != "/Index.HTML" {
+		t.Fatalf("expected /Index.HTML, got %s", got)
+	}
+}
+
+func TestFallbackRoots(t *testing.T) {
+	static, generated := t.TempDir(), t.TempDir()
+	for _, f := range []string{filepath.Join(static, "Docs", "Intro.html"), filepath.Join(generated, "Docs", "API.html"), filepath.Join(generated, "Docs", "INTRO.HTML")} {
+		if err := os.MkdirAll(filepath.Dir(f), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(f, nil, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	c := &Casefold{Mode: "fs", Root: static, FallbackRoots: []string{generated}}
+	if err := c.Provision(caddy.Context{}); err != nil {
+		t.Fatal(err)
+	}
+	defer c.Cleanup()
+	for in, want := range map[string]string{
+		"/docs/intro.html": "/Docs/Intro.html", // first root wins
+		"/docs/api.html":   "/Docs/API.html",
+		"/docs/missing":    "/docs/missing",
+	} {
+		rr := httptest.NewRecorder()
+		if err := c.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, in, nil), recordHandler{t}); err != nil {
+			t.Fatal(err)
+		}
+		if got := rr.Header().Get("X-Final-Path"); got != want {
+			t.Errorf("%s: expected %s, got %s", in, want, got)
+		}
+	}
+}
+
+func TestHostRoots(t *testing.T) {
+	base, shop, fallback := t.TempDir(), t.TempDir(), t.TempDir()
+	files := []string{
+		filepath.Join(base, "a.example.com", "Index.HTML"),
+		filepath.Join(base, "b.example.com", "INDEX.html"),
+		filepath.Join(shop, "index.HTML"),
+		filepath.Join(fallback, "Index.html"),
+	}
+	for _, f := range files {
+		if err := os.MkdirAll(filepath.Dir(f), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(f, nil, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	c := &Casefold{Mode: "fs", Root: fallback, HostRoots: map[string]string{
+		"*.example.com":    base + "/{http.request.host}",
+		"Shop.example.com": shop,
+	}}
+	if err := c.Provision(caddy.Context{}); err != nil {
+		t.Fatal(err)
+	}
+	defer c.Cleanup()
+	for _, tc := range []struct{ host, want string }{
+		{"a.example.com", "/Index.HTML"},
+		{"b.example.com:8080", "/INDEX.html"},
+		{"shop.example.com", "/index.HTML"},
+		{"other.test", "/Index.html"},
+	} {
+		req := httptest.NewRequest(http.MethodGet, "http://"+tc.host+"/index.html", nil)
+		caddyhttp.NewTestReplacer(req)
+		rr := httptest.NewRecorder()
+		if err := c.ServeHTTP(rr, req, recordHandler{t}); err != nil {
+			t.Fatal(err)
+		}
+		if got := rr.Header().Get("X-Final-Path"); got != tc.want {
+			t.Errorf("%s: expected %s, got %s", tc.host, tc.want, got)
+		}
+	}
+	if err := (&Casefold{Mode: "fs", HostRoots: map[string]string{"a.*.com": "/srv"}}).Provision(caddy.Context{}); err == nil {
+		t.Error("expected invalid host key to fail provisioning")
+	}
+}
+
+// failingFS fails to open fail, counting the attempts.
+type failingFS struct {
+	fsys  fstest.MapFS
+	fail  string
+	tries *atomic.Int64
+}
+
+func (f failingFS) Open(name string) (fs.File, error) {
+	if name == f.fail {
+		f.tries.Add(1)
+		return nil, errors.New("unreadable")
+	}
+	return f.fsys.Open(name)
+}
+
+func TestDynamicRootsBounded(t *testing.T) {
+	defer func(size int, retry time.Duration) { dynamicRootsSize, dynamicRootRetry = size, retry }(dynamicRootsSize, dynamicRootRetry)
+	dynamicRootsSize, dynamicRootRetry = 2, time.Hour
+
+	tries := new(atomic.Int64)
+	fsys := failingFS{fsys: fstest.MapFS{
+		"a/File.txt":     &fstest.MapFile{},
+		"b/File.txt":     &fstest.MapFile{},
+		"c/File.txt":     &fstest.MapFile{},
+		"bad/sub/File":   &fstest.MapFile{},
+		"plain/File.txt": &fstest.MapFile{},
+	}, fail: "bad/sub", tries: tries}
+	c := &Casefold{Mode: "fs", FS: fsys, Root: "{http.vars.root}", Preload: true}
+	if err := c.Provision(caddy.Context{}); err != nil {
+		t.Fatal(err)
+	}
+	defer c.Cleanup()
+	serve := func(root string) string {
+		req := withRoot(t, root)
+		req.URL.Path = "/file.txt"
+		rr := httptest.NewRecorder()
+		if err := c.ServeHTTP(rr, req, recordHandler{t}); err != nil {
+			t.Fatal(err)
+		}
+		return rr.Header().Get("X-Final-Path")
+	}
+
+	if got := serve("a"); got != "/File.txt" {
+		t.Fatalf("root a: expected /File.txt, got %s", got)
+	}
+	key := c.rootFor(withRoot(t, "a")).stateKey
+	serve("b")
+	serve("c")
+	if n := c.roots.Len(); n != 2 {
+		t.Fatalf("expected at most 2 roots held, got %d", n)
+	}
+	if refs, _ := fsStates.References(key); key == "" || refs != 0 {
+		t.Errorf("expected the evicted root's state to be released, got %d references", refs)
+	}
+
+	// missing roots are passed through without being remembered
+	if got := serve("missing"); got != "/file.txt" {
+		t.Errorf("missing root: expected the path passed through, got %s", got)
+	}
+	if n := c.roots.Len(); n != 2 {
+		t.Errorf("expected the missing root not to be held, got %d roots", n)
+	}
+
+	// a root failing to set up is not retried on every request
+	for i := 0; i < 3; i++ {
+		if got := serve("bad"); got != "/file.txt" {
+			t.Errorf("failing root: expected the path passed through, got %s", got)
+		}
+	}
+	if n := tries.Load(); n != 1 {
+		t.Errorf("expected one setup attempt within the retry interval, got %d", n)
+	}
+}
+
+// withRoot returns a request whose {http.vars.root} is root.
+func withRoot(t *testing.T, root string) *http.Request {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	*req = *req.WithContext(context.WithValue(req.Context(), caddyhttp.VarsCtxKey, map[string]any{"root": root}))
+	caddyhttp.NewTestReplacer(req)
+	return req
+}
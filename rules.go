@@ -0,0 +1,59 @@
+package casefold
+
+import (
+	"fmt"
+	"net/http"
+	"path"
+
+	"github.com/caddyserver/caddy/v2"
+	"github.com/caddyserver/caddy/v2/modules/caddyhttp"
+)
+
+// PathRule applies a configuration of its own to the requests under Paths,
+// so that one handler can fold /docs with one strategy and resolve
+// /downloads against disk with another. Every other field is a complete
+// casefold configuration; nothing is inherited from the enclosing handler.
+type PathRule struct {
+	// Paths selects the requests the rule handles, with the semantics of
+	// Only: a path matches if it, or a directory above it, matches one of
+	// the globs.
+	Paths []string `json:"paths,omitempty"`
+
+	Casefold
+}
+
+// provisionRules validates and provisions c.Rules.
+func (c *Casefold) provisionRules(ctx caddy.Context) error {
+	for i, rule := range c.Rules {
+		if len(rule.Paths) == 0 {
+			return fmt.Errorf("rule %d: at least one path pattern is required", i)
+		}
+		for _, p := range rule.Paths {
+			if _, err := path.Match(p, ""); err != nil {
+				return fmt.Errorf("rule %d: invalid path pattern %q: %v", i, p, err)
+			}
+		}
+		if len(rule.Rules) > 0 {
+			return fmt.Errorf("rule %d: rules cannot be nested", i)
+		}
+		rule.embedded = true
+		if err := rule.Casefold.Provision(ctx); err != nil {
+			return fmt.Errorf("rule %d: %v", i, err)
+		}
+	}
+	return nil
+}
+
+// serveRules hands r to the first rule whose Paths match it. Requests
+// matching no rule pass through, counted as skips with reason "no_rule".
+func (c *Casefold) serveRules(w http.ResponseWriter, r *http.Request, next caddyhttp.Handler) error {
+	for _, rule := range c.Rules {
+		if matchUnder(rule.Paths, r.URL.Path) {
+			return rule.ServeHTTP(w, r, next)
+		}
+	}
+	casefoldMetrics.requests.WithLabelValues("rules").Inc()
+	casefoldMetrics.skips.WithLabelValues("no_rule").Inc()
+	c.annotate(r, r.URL.Path, r.URL.Path, false)
+	return next.ServeHTTP(w, r)
+}
@@ -0,0 +1,66 @@
+package casefold
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/caddyserver/caddy/v2"
+)
+
+func TestPathRules(t *testing.T) {
+	root := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(root, "downloads"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(root, "downloads", "Setup.EXE"), nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	var c Casefold
+	cfg := `{"rules": [
+		{"paths": ["/docs/*"], "mode": "fold"},
+		{"paths": ["/downloads/*"], "mode": "fs", "root": ` + jsonString(root) + `}
+	]}`
+	if err := json.Unmarshal([]byte(cfg), &c); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Provision(caddy.Context{}); err != nil {
+		t.Fatal(err)
+	}
+	defer c.Cleanup()
+	for _, tc := range []struct{ path, want string }{
+		{"/docs/Straße", "/docs/strasse"},
+		{"/downloads/setup.exe", "/downloads/Setup.EXE"},
+		{"/Blog/Post", "/Blog/Post"},
+	} {
+		rr := httptest.NewRecorder()
+		if err := c.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, tc.path, nil), recordHandler{t}); err != nil {
+			t.Fatal(err)
+		}
+		if got := rr.Header().Get("X-Final-Path"); got != tc.want {
+			t.Errorf("%s: expected %s, got %s", tc.path, tc.want, got)
+		}
+	}
+}
+
+func TestPathRulesInvalid(t *testing.T) {
+	for _, rules := range [][]*PathRule{
+		{{}},
+		{{Paths: []string{"[a-"}}},
+		{{Paths: []string{"/a/*"}, Casefold: Casefold{Rules: []*PathRule{{Paths: []string{"/b"}}}}}},
+		{{Paths: []string{"/a/*"}, Casefold: Casefold{Mode: "bogus", Transforms: []string{"lower"}}}},
+	} {
+		c := &Casefold{Rules: rules}
+		if err := c.Provision(caddy.Context{}); err == nil {
+			t.Errorf("expected rules %+v to fail provisioning", rules[0])
+		}
+	}
+}
+
+func jsonString(s string) string {
+	b, _ := json.Marshal(s)
+	return string(b)
+}
@@ -0,0 +1,191 @@
+package casefold
+
+import (
+	"fmt"
+	"hash/fnv"
+	"net"
+	"net/http"
+	"path"
+	"strings"
+
+	"github.com/caddyserver/caddy/v2/modules/caddyhttp"
+)
+
+// skipReason returns why r must pass through untouched, or "" if the
+// handler applies to it. Reasons double as skips metric labels. The error
+// is a failing request matcher's.
+func (c *Casefold) skipReason(r *http.Request) (string, error) {
+	if len(c.Only) > 0 && !matchUnder(c.Only, r.URL.Path) {
+		return "only", nil
+	}
+	if len(c.applyTo) > 0 {
+		match, err := c.applyTo.AnyMatchWithError(r)
+		if err != nil {
+			return "", err
+		}
+		if !match {
+			return "apply_to", nil
+		}
+	}
+	if len(c.excludeMatch) > 0 {
+		match, err := c.excludeMatch.AnyMatchWithError(r)
+		if err != nil {
+			return "", err
+		}
+		if match {
+			return "exclude_match", nil
+		}
+	}
+	return c.skipCondition(r), nil
+}
+
+// skipCondition checks the built-in skip options.
+func (c *Casefold) skipCondition(r *http.Request) string {
+	if len(c.Methods) > 0 && !containsMethod(c.Methods, r.Method) {
+		return "method"
+	}
+	if c.BypassHeader != "" && c.bypassed(r) {
+		return "bypass_header"
+	}
+	if c.SkipSignedURLs && hasQueryParam(r, signatureParams) {
+		return "signed_url"
+	}
+	if len(c.SkipQueryParams) > 0 && hasQueryParam(r, c.SkipQueryParams) {
+		return "query_param"
+	}
+	if c.SkipAuthorized && r.Header.Get("Authorization") != "" {
+		return "authorized"
+	}
+	if enabled(c.SkipUpgrade) && isUpgrade(r) {
+		return "upgrade"
+	}
+	if enabled(c.SkipGRPC) && isGRPC(r) {
+		return "grpc"
+	}
+	if c.SamplePercent != nil && !c.sampled(r) {
+		return "sample"
+	}
+	return ""
+}
+
+// matchUnder reports whether p, or one of its parent directories, matches
+// any of patterns.
+func matchUnder(patterns []string, p string) bool {
+	for dir := p; ; dir = path.Dir(dir) {
+		for _, gl := range patterns {
+			if globMatch(gl, dir) {
+				return true
+			}
+		}
+		if dir == "/" || dir == "." {
+			return false
+		}
+	}
+}
+
+func containsMethod(methods []string, m string) bool {
+	for _, v := range methods {
+		if strings.EqualFold(v, m) {
+			return true
+		}
+	}
+	return false
+}
+
+// bypassed reports whether r carries BypassHeader, with BypassValue if
+// one is configured.
+func (c *Casefold) bypassed(r *http.Request) bool {
+	vals := r.Header.Values(c.BypassHeader)
+	if c.BypassValue == "" {
+		return len(vals) > 0
+	}
+	for _, v := range vals {
+		if strings.TrimSpace(v) == c.BypassValue {
+			return true
+		}
+	}
+	return false
+}
+
+// signatureParams are the query parameters that carry the signature of
+// pre-signed URLs for common object stores and CDNs: AWS SigV4 and S3
+// SigV2/CloudFront, Google Cloud Storage V4, and Azure SAS tokens.
+var signatureParams = []string{"X-Amz-Signature", "Signature", "X-Goog-Signature", "sig"}
+
+// hasQueryParam reports whether r's query has any of names as a key,
+// compared case-insensitively.
+func hasQueryParam(r *http.Request, names []string) bool {
+	if r.URL.RawQuery == "" {
+		return false
+	}
+	for key := range r.URL.Query() {
+		for _, n := range names {
+			if strings.EqualFold(key, n) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// enabled reads an on-by-default option.
+func enabled(opt *bool) bool { return opt == nil || *opt }
+
+// isUpgrade reports whether r asks to switch protocols: an HTTP/1.1
+// Upgrade (WebSocket) or an extended CONNECT as used for WebSockets over
+// HTTP/2 and HTTP/3.
+func isUpgrade(r *http.Request) bool {
+	return r.Header.Get("Upgrade") != "" || r.Method == http.MethodConnect
+}
+
+// isGRPC reports whether r is a gRPC (or gRPC-Web) call, whose path names
+// a service method.
+func isGRPC(r *http.Request) bool {
+	return strings.HasPrefix(r.Header.Get("Content-Type"), "application/grpc")
+}
+
+// sampled reports whether r falls into the SamplePercent share of traffic.
+// The decision is a stable hash of the client IP or of the lowercased path
+// (SampleBy), so a client or URL is treated consistently across requests.
+func (c *Casefold) sampled(r *http.Request) bool {
+	pct := *c.SamplePercent
+	if pct >= 100 {
+		return true
+	}
+	h := fnv.New64a()
+	if c.SampleBy == "path" {
+		_, _ = h.Write([]byte(strings.ToLower(r.URL.Path)))
+	} else {
+		_, _ = h.Write([]byte(clientIP(r)))
+	}
+	return float64(h.Sum64()%10000) < pct*100
+}
+
+// clientIP is the client address Caddy determined for r (honoring
+// trusted_proxies), or the connection's remote host outside a server.
+func clientIP(r *http.Request) string {
+	if ip, ok := caddyhttp.GetVar(r.Context(), caddyhttp.ClientIPVarKey).(string); ok && ip != "" {
+		return ip
+	}
+	if host, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+		return host
+	}
+	return r.RemoteAddr
+}
+
+// validateSampling checks the SamplePercent and SampleBy options.
+func (c *Casefold) validateSampling() error {
+	if pct := c.SamplePercent; pct != nil && (*pct < 0 || *pct > 100) {
+		return fmt.Errorf("invalid sample_percent %v: must be between 0 and 100", *pct)
+	}
+	switch c.SampleBy {
+	case "", "ip", "path":
+		return nil
+	}
+	return fmt.Errorf("invalid sample_by %q: must be ip or path", c.SampleBy)
+}
+
+// redirects reports whether r gets a redirect rather than a rewrite.
+func (c *Casefold) redirects(r *http.Request) bool {
+	return c.Redirect && (len(c.RedirectMethods) == 0 || containsMethod(c.RedirectMethods, r.Method))
+}
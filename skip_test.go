@@ -0,0 +1,272 @@
+package casefold
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/caddyserver/caddy/v2"
+	"github.com/caddyserver/caddy/v2/caddyconfig/caddyfile"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+// percent returns a SamplePercent of pct.
+func percent(pct float64) *float64 { return &pct }
+
+func TestSamplePercent(t *testing.T) {
+	c := &Casefold{SamplePercent: percent(30)}
+	if err := c.Provision(caddy.Context{}); err != nil {
+		t.Fatal(err)
+	}
+	skips := testutil.ToFloat64(casefoldMetrics.skips.WithLabelValues("sample"))
+	folded := 0
+	for i := 0; i < 1000; i++ {
+		req := httptest.NewRequest(http.MethodGet, "/Docs", nil)
+		req.RemoteAddr = fmt.Sprintf("10.0.%d.%d:5000", i/250, i%250)
+		rr := httptest.NewRecorder()
+		if err := c.ServeHTTP(rr, req, recordHandler{t}); err != nil {
+			t.Fatal(err)
+		}
+		if rr.Header().Get("X-Final-Path") == "/docs" {
+			folded++
+		}
+		// the same client always gets the same treatment
+		again := httptest.NewRequest(http.MethodGet, "/OTHER", nil)
+		again.RemoteAddr = req.RemoteAddr
+		if c.sampled(again) != (rr.Header().Get("X-Final-Path") == "/docs") {
+			t.Fatalf("client %s sampled inconsistently", req.RemoteAddr)
+		}
+	}
+	if folded < 230 || folded > 370 {
+		t.Fatalf("expected roughly 30%% of clients folded, got %d/1000", folded)
+	}
+	if d := testutil.ToFloat64(casefoldMetrics.skips.WithLabelValues("sample")) - skips; int(d) != 1000-folded {
+		t.Fatalf("expected %d sample skips, got %v", 1000-folded, d)
+	}
+}
+
+func TestSamplePercentZero(t *testing.T) {
+	// an explicit 0 is a canary that has not started, not the default
+	c := &Casefold{SamplePercent: percent(0)}
+	if err := c.Provision(caddy.Context{}); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 100; i++ {
+		req := httptest.NewRequest(http.MethodGet, "/Docs", nil)
+		req.RemoteAddr = fmt.Sprintf("10.1.0.%d:5000", i)
+		rr := httptest.NewRecorder()
+		if err := c.ServeHTTP(rr, req, recordHandler{t}); err != nil {
+			t.Fatal(err)
+		}
+		if got := rr.Header().Get("X-Final-Path"); got != "/Docs" {
+			t.Fatalf("sample_percent 0: expected /Docs passed through, got %s", got)
+		}
+	}
+
+	var parsed Casefold
+	if err := parsed.UnmarshalCaddyfile(caddyfile.NewTestDispenser(`casefold {
+		sample_percent 0
+	}`)); err != nil {
+		t.Fatal(err)
+	}
+	if parsed.SamplePercent == nil || *parsed.SamplePercent != 0 {
+		t.Fatalf("expected sample_percent 0 to be kept, got %v", parsed.SamplePercent)
+	}
+}
+
+func TestSampleByPath(t *testing.T) {
+	c := &Casefold{SamplePercent: percent(50), SampleBy: "path"}
+	if err := c.Provision(caddy.Context{}); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 50; i++ {
+		lower := httptest.NewRequest(http.MethodGet, fmt.Sprintf("/page-%d", i), nil)
+		upper := httptest.NewRequest(http.MethodGet, fmt.Sprintf("/PAGE-%d", i), nil)
+		upper.RemoteAddr = "192.0.2.99:1234"
+		if c.sampled(lower) != c.sampled(upper) {
+			t.Fatalf("casings of /page-%d sampled differently", i)
+		}
+	}
+}
+
+func TestInvalidSampling(t *testing.T) {
+	for _, c := range []*Casefold{{SamplePercent: percent(-1)}, {SamplePercent: percent(150)}, {SampleBy: "cookie"}} {
+		if err := c.Provision(caddy.Context{}); err == nil {
+			t.Errorf("expected %v/%q to be rejected", c.SamplePercent, c.SampleBy)
+		}
+	}
+}
+
+func TestMethods(t *testing.T) {
+	c := &Casefold{Methods: []string{"GET", "head"}, Redirect: true}
+	if err := c.Provision(caddy.Context{}); err != nil {
+		t.Fatal(err)
+	}
+	for method, want := range map[string]int{
+		http.MethodGet:    http.StatusPermanentRedirect,
+		http.MethodHead:   http.StatusPermanentRedirect,
+		http.MethodPut:    http.StatusOK,
+		http.MethodDelete: http.StatusOK,
+		"PROPFIND":        http.StatusOK,
+	} {
+		rr := httptest.NewRecorder()
+		if err := c.ServeHTTP(rr, httptest.NewRequest(method, "/Docs/File", nil), recordHandler{t}); err != nil {
+			t.Fatal(err)
+		}
+		if rr.Code != want {
+			t.Errorf("%s: expected %d, got %d", method, want, rr.Code)
+		}
+	}
+}
+
+func TestSkipUpgradeAndGRPC(t *testing.T) {
+	off := false
+	for _, tc := range []struct {
+		name       string
+		c          *Casefold
+		header     http.Header
+		method     string
+		wantFolded bool
+	}{
+		{"websocket", &Casefold{}, http.Header{"Upgrade": {"websocket"}, "Connection": {"Upgrade"}}, http.MethodGet, false},
+		{"extended connect", &Casefold{}, nil, http.MethodConnect, false},
+		{"grpc", &Casefold{}, http.Header{"Content-Type": {"application/grpc+proto"}}, http.MethodPost, false},
+		{"grpc-web", &Casefold{}, http.Header{"Content-Type": {"application/grpc-web"}}, http.MethodPost, false},
+		{"plain", &Casefold{}, http.Header{"Content-Type": {"application/json"}}, http.MethodPost, true},
+		{"upgrade disabled", &Casefold{SkipUpgrade: &off}, http.Header{"Upgrade": {"websocket"}}, http.MethodGet, true},
+		{"grpc disabled", &Casefold{SkipGRPC: &off}, http.Header{"Content-Type": {"application/grpc"}}, http.MethodPost, true},
+	} {
+		if err := tc.c.Provision(caddy.Context{}); err != nil {
+			t.Fatal(err)
+		}
+		req := httptest.NewRequest(tc.method, "/pkg.Service/GetThing", nil)
+		for k, v := range tc.header {
+			req.Header[k] = v
+		}
+		rr := httptest.NewRecorder()
+		if err := tc.c.ServeHTTP(rr, req, recordHandler{t}); err != nil {
+			t.Fatal(err)
+		}
+		if folded := rr.Header().Get("X-Final-Path") == "/pkg.service/getthing"; folded != tc.wantFolded {
+			t.Errorf("%s: expected folded=%v, got path %s", tc.name, tc.wantFolded, rr.Header().Get("X-Final-Path"))
+		}
+	}
+}
+
+func TestBypassHeader(t *testing.T) {
+	for _, tc := range []struct {
+		value      string
+		header     []string
+		wantFolded bool
+	}{
+		{"", nil, true},
+		{"", []string{""}, false},
+		{"", []string{"yes"}, false},
+		{"1", []string{"1"}, false},
+		{"1", []string{"0", " 1"}, false},
+		{"1", []string{"0"}, true},
+	} {
+		c := &Casefold{BypassHeader: "X-No-Casefold", BypassValue: tc.value}
+		if err := c.Provision(caddy.Context{}); err != nil {
+			t.Fatal(err)
+		}
+		req := httptest.NewRequest(http.MethodGet, "/Health", nil)
+		for _, v := range tc.header {
+			req.Header.Add("x-no-casefold", v)
+		}
+		rr := httptest.NewRecorder()
+		if err := c.ServeHTTP(rr, req, recordHandler{t}); err != nil {
+			t.Fatal(err)
+		}
+		if folded := rr.Header().Get("X-Final-Path") == "/health"; folded != tc.wantFolded {
+			t.Errorf("value %q, header %q: expected folded=%v", tc.value, tc.header, tc.wantFolded)
+		}
+	}
+}
+
+func TestSkipSignedURLs(t *testing.T) {
+	for _, tc := range []struct {
+		c          *Casefold
+		query      string
+		wantFolded bool
+	}{
+		{&Casefold{SkipSignedURLs: true}, "X-Amz-Algorithm=AWS4-HMAC-SHA256&X-Amz-Signature=abc", false},
+		{&Casefold{SkipSignedURLs: true}, "x-goog-signature=abc", false},
+		{&Casefold{SkipSignedURLs: true}, "sv=2022-11-02&se=2030&sig=abc", false},
+		{&Casefold{SkipSignedURLs: true}, "Expires=1&Signature=abc&Key-Pair-Id=K", false},
+		{&Casefold{SkipSignedURLs: true}, "page=2", true},
+		{&Casefold{}, "X-Amz-Signature=abc", true},
+		{&Casefold{SkipQueryParams: []string{"hmac"}}, "HMAC=abc", false},
+		{&Casefold{SkipQueryParams: []string{"hmac"}}, "sig=abc", true},
+	} {
+		if err := tc.c.Provision(caddy.Context{}); err != nil {
+			t.Fatal(err)
+		}
+		rr := httptest.NewRecorder()
+		if err := tc.c.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/Bucket/Key.PNG?"+tc.query, nil), recordHandler{t}); err != nil {
+			t.Fatal(err)
+		}
+		if folded := rr.Header().Get("X-Final-Path") == "/bucket/key.png"; folded != tc.wantFolded {
+			t.Errorf("%q: expected folded=%v", tc.query, tc.wantFolded)
+		}
+	}
+}
+
+func TestOnly(t *testing.T) {
+	c := &Casefold{Only: []string{"/Docs/*", "/faq.html"}}
+	if err := c.Provision(caddy.Context{}); err != nil {
+		t.Fatal(err)
+	}
+	before := testutil.ToFloat64(casefoldMetrics.skips.WithLabelValues("only"))
+	for _, tc := range []struct{ path, want string }{
+		{"/Docs/Guide", "/docs/guide"},
+		{"/Docs/Guide/Intro.HTML", "/docs/guide/intro.html"},
+		{"/faq.html", "/faq.html"},
+		{"/docs/Guide", "/docs/Guide"}, // patterns are case-sensitive
+		{"/Blog/Post", "/Blog/Post"},
+		{"/Docs", "/Docs"},
+	} {
+		rr := httptest.NewRecorder()
+		if err := c.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, tc.path, nil), recordHandler{t}); err != nil {
+			t.Fatal(err)
+		}
+		if got := rr.Header().Get("X-Final-Path"); got != tc.want {
+			t.Errorf("%s: expected %s, got %s", tc.path, tc.want, got)
+		}
+	}
+	if got := testutil.ToFloat64(casefoldMetrics.skips.WithLabelValues("only")) - before; got != 3 {
+		t.Errorf("expected 3 only skips, got %v", got)
+	}
+	if err := (&Casefold{Only: []string{"[a-"}}).Provision(caddy.Context{}); err == nil {
+		t.Error("expected invalid only pattern to fail provisioning")
+	}
+}
+
+func TestSkipAuthorized(t *testing.T) {
+	for _, tc := range []struct {
+		skip       bool
+		auth       string
+		wantFolded bool
+	}{
+		{true, "AWS4-HMAC-SHA256 Credential=AKID/20260101/us-east-1/s3/aws4_request", false},
+		{true, "", true},
+		{false, "Bearer abc", true},
+	} {
+		c := &Casefold{SkipAuthorized: tc.skip}
+		if err := c.Provision(caddy.Context{}); err != nil {
+			t.Fatal(err)
+		}
+		req := httptest.NewRequest(http.MethodGet, "/Api/Items", nil)
+		if tc.auth != "" {
+			req.Header.Set("Authorization", tc.auth)
+		}
+		rr := httptest.NewRecorder()
+		if err := c.ServeHTTP(rr, req, recordHandler{t}); err != nil {
+			t.Fatal(err)
+		}
+		if folded := rr.Header().Get("X-Final-Path") == "/api/items"; folded != tc.wantFolded {
+			t.Errorf("skip %v, auth %q: expected folded=%v", tc.skip, tc.auth, tc.wantFolded)
+		}
+	}
+}
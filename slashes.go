@@ -0,0 +1,130 @@
+package casefold
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// EncodedSlashes policies.
+const (
+	encodedSlashesKeep   = "keep"
+	encodedSlashesDecode = "decode"
+	encodedSlashesReject = "reject"
+)
+
+// slashMark stands in for an encoded slash while a path is transformed. It
+// is a noncharacter, so case mappings leave it alone and no file name
+// contains it, which keeps fs mode from resolving across it.
+const slashMark = "\uffff"
+
+func validEncodedSlashes(p string) bool {
+	switch p {
+	case "", encodedSlashesKeep, encodedSlashesDecode, encodedSlashesReject:
+		return true
+	}
+	return false
+}
+
+// hasEncodedSlash reports whether r's path contains %2F.
+func hasEncodedSlash(r *http.Request) bool {
+	return r.URL.RawPath != "" && strings.Contains(strings.ToUpper(r.URL.RawPath), "%2F")
+}
+
+// transformRequest transforms r's path, orig. raw is the escaped form of
+// transformed, to be used as RawPath, when the client's escaping differs
+// from the default: it is carried over (see escapeLike), so that, for one,
+// under the default keep policy encoded slashes survive the transform. raw
+// is empty when the default encoding of transformed will do. The path
+// changed if transformed differs from orig or raw from r.URL.RawPath. A
+// path already holding slashMark passes through untouched, since the mark
+// would otherwise turn into a real slash after the path was checked.
+func (c *Casefold) transformRequest(r *http.Request, orig string) (transformed, raw string, err error) {
+	if strings.Contains(orig, slashMark) {
+		return orig, r.URL.RawPath, nil
+	}
+	in := orig
+	keep := c.EncodedSlashes != encodedSlashesDecode && hasEncodedSlash(r)
+	if keep {
+		var ok bool
+		if in, ok = protectSlashes(r.URL.RawPath); !ok {
+			return orig, "", nil
+		}
+	}
+	transformed, err = c.transform(r, in)
+	switch {
+	case err != nil:
+		return orig, "", err
+	case transformed == in:
+		transformed, raw = orig, r.URL.RawPath
+	case r.URL.RawPath != "":
+		like := r.URL.RawPath
+		if c.CollapseSlashes {
+			like = collapseSlashes(like)
+		}
+		like = matchTrailingSlash(like, transformed)
+		if !keep {
+			like = strings.Join(splitEncodedSlashes(like), "/")
+		}
+		raw = escapeLike(transformed, like)
+		if keep {
+			transformed = strings.ReplaceAll(transformed, slashMark, "/")
+		}
+	}
+	if c.PercentHex != "" {
+		raw = normalizeHex(transformed, raw, c.PercentHex == percentHexUpper)
+	}
+	return transformed, raw, nil
+}
+
+// collapseSlashes replaces each run of slashes in p with a single one.
+func collapseSlashes(p string) string {
+	if !strings.Contains(p, "//") {
+		return p
+	}
+	var b strings.Builder
+	b.Grow(len(p))
+	for i := 0; i < len(p); i++ {
+		if p[i] == '/' && i > 0 && p[i-1] == '/' {
+			continue
+		}
+		b.WriteByte(p[i])
+	}
+	return b.String()
+}
+
+// protectSlashes decodes the escaped path raw with its encoded slashes
+// replaced by slashMark.
+func protectSlashes(raw string) (string, bool) {
+	parts := splitEncodedSlashes(raw)
+	for i, part := range parts {
+		dec, err := url.PathUnescape(part)
+		if err != nil {
+			return "", false
+		}
+		parts[i] = dec
+	}
+	return strings.Join(parts, slashMark), true
+}
+
+// splitEncodedSlashes splits raw around %2F, in either case.
+func splitEncodedSlashes(raw string) []string {
+	var parts []string
+	for {
+		i := strings.Index(strings.ToUpper(raw), "%2F")
+		if i < 0 {
+			return append(parts, raw)
+		}
+		parts = append(parts, raw[:i])
+		raw = raw[i+3:]
+	}
+}
+
+// rejectEncodedSlashes fails r under the reject policy.
+func (c *Casefold) rejectEncodedSlashes(r *http.Request) error {
+	if c.EncodedSlashes == encodedSlashesReject && hasEncodedSlash(r) {
+		return fmt.Errorf("encoded slash in path %q", r.URL.RawPath)
+	}
+	return nil
+}
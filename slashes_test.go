@@ -0,0 +1,111 @@
+package casefold
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/caddyserver/caddy/v2"
+	"github.com/caddyserver/caddy/v2/modules/caddyhttp"
+)
+
+func TestEncodedSlashes(t *testing.T) {
+	for _, tc := range []struct {
+		policy, target, path, uri string
+	}{
+		{"", "/Files/A%2FB/C", "/files/a/b/c", "/files/a%2Fb/c"},
+		{"keep", "/Files/a%2fB", "/files/a/b", "/files/a%2Fb"},
+		{"keep", "/Plain/Path", "/plain/path", "/plain/path"},
+		{"decode", "/Files/A%2FB/C", "/files/a/b/c", "/files/a/b/c"},
+	} {
+		c := &Casefold{Mode: "lower", EncodedSlashes: tc.policy}
+		if err := c.Provision(caddy.Context{}); err != nil {
+			t.Fatal(err)
+		}
+		req := httptest.NewRequest(http.MethodGet, tc.target, nil)
+		var got *http.Request
+		next := caddyhttp.HandlerFunc(func(_ http.ResponseWriter, r *http.Request) error {
+			got = r
+			return nil
+		})
+		if err := c.ServeHTTP(httptest.NewRecorder(), req, next); err != nil {
+			t.Fatal(err)
+		}
+		if got.URL.Path != tc.path || got.URL.EscapedPath() != tc.uri || got.RequestURI != tc.uri {
+			t.Errorf("%q %s: got path %s, escaped %s, RequestURI %s; want %s and %s", tc.policy, tc.target, got.URL.Path, got.URL.EscapedPath(), got.RequestURI, tc.path, tc.uri)
+		}
+	}
+
+	c := &Casefold{Mode: "lower", Redirect: true}
+	if err := c.Provision(caddy.Context{}); err != nil {
+		t.Fatal(err)
+	}
+	rr := httptest.NewRecorder()
+	if err := c.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/A%2FB?q=1", nil), recordHandler{t}); err != nil {
+		t.Fatal(err)
+	}
+	if got := rr.Header().Get("Location"); got != "/a%2Fb?q=1" {
+		t.Errorf("redirect: expected Location /a%%2Fb?q=1, got %s", got)
+	}
+
+	c = &Casefold{Mode: "lower", EncodedSlashes: "reject"}
+	if err := c.Provision(caddy.Context{}); err != nil {
+		t.Fatal(err)
+	}
+	err := c.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/A%2FB", nil), recordHandler{t})
+	var herr caddyhttp.HandlerError
+	if !errors.As(err, &herr) || herr.StatusCode != http.StatusBadRequest {
+		t.Errorf("reject: expected 400, got %v", err)
+	}
+	if err := c.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/A/B", nil), recordHandler{t}); err != nil {
+		t.Errorf("reject: plain path failed: %v", err)
+	}
+}
+
+func TestSlashMarkPassesThrough(t *testing.T) {
+	// A U+FFFF the client sent must not become a slash after the path checks.
+	const target = "/Public%ef%bf%bf..%ef%bf%bfAdmin"
+	for _, policy := range []string{"", "keep", "decode", "reject"} {
+		c := &Casefold{Mode: "lower", EncodedSlashes: policy, DotSegments: "reject"}
+		if err := c.Provision(caddy.Context{}); err != nil {
+			t.Fatal(err)
+		}
+		var got *http.Request
+		next := caddyhttp.HandlerFunc(func(_ http.ResponseWriter, r *http.Request) error {
+			got = r
+			return nil
+		})
+		if err := c.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, target, nil), next); err != nil {
+			t.Fatal(err)
+		}
+		if want := "/Public" + slashMark + ".." + slashMark + "Admin"; got.URL.Path != want || got.URL.EscapedPath() != target {
+			t.Errorf("%q: got path %q, escaped %s; want it passed through", policy, got.URL.Path, got.URL.EscapedPath())
+		}
+	}
+}
+
+func TestCollapseSlashes(t *testing.T) {
+	c := &Casefold{Mode: "lower", CollapseSlashes: true}
+	if err := c.Provision(caddy.Context{}); err != nil {
+		t.Fatal(err)
+	}
+	for target, want := range map[string]string{
+		"/Docs//Intro///Page": "/docs/intro/page",
+		"/docs//intro":        "/docs/intro", // only the slashes change
+		"//a%20B//":           "/a%20b/",
+		"/A%2F%2FB//C":        "/a%2F%2Fb/c", // encoded slashes stay as sent
+	} {
+		var got *http.Request
+		next := caddyhttp.HandlerFunc(func(_ http.ResponseWriter, r *http.Request) error {
+			got = r
+			return nil
+		})
+		if err := c.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, target, nil), next); err != nil {
+			t.Fatal(err)
+		}
+		if got.URL.EscapedPath() != want || got.RequestURI != want {
+			t.Errorf("%s: expected %s, got escaped path %s, RequestURI %s", target, want, got.URL.EscapedPath(), got.RequestURI)
+		}
+	}
+}
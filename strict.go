@@ -0,0 +1,23 @@
+package casefold
+
+import "fmt"
+
+// checkStrict fails, under Strict, the settings Provision otherwise
+// accepts with a warning.
+func (c *Casefold) checkStrict() error {
+	if !c.Strict {
+		return nil
+	}
+	if c.Locale != "" && c.hasStep("fold") {
+		return fmt.Errorf("locale %q does not apply to fold mode", c.Locale)
+	}
+	if c.Watch && c.hasStep("fs") {
+		if c.CacheSize == 0 && !c.Preload {
+			return fmt.Errorf("watch requires cache_size or preload")
+		}
+		if !c.onLocalDisk() {
+			return fmt.Errorf("watch is only supported on the local filesystem, not %s", c.rootID())
+		}
+	}
+	return nil
+}
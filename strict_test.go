@@ -0,0 +1,43 @@
+package casefold
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/caddyserver/caddy/v2"
+)
+
+func TestStrict(t *testing.T) {
+	c := &Casefold{Mode: "flod"}
+	if err := c.Provision(caddy.Context{}); err != nil {
+		t.Fatal(err)
+	}
+	rr := httptest.NewRecorder()
+	if err := c.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/Docs", nil), recordHandler{t}); err != nil {
+		t.Fatal(err)
+	}
+	if got := rr.Header().Get("X-Final-Path"); got != "/docs" {
+		t.Errorf("unknown mode: expected lower's /docs, got %s", got)
+	}
+
+	for _, tc := range []struct {
+		c    *Casefold
+		want string
+	}{
+		{&Casefold{Mode: "flod", Strict: true}, `unknown mode "flod"`},
+		{&Casefold{Mode: "fold", Locale: "tr", Strict: true}, "locale"},
+		{&Casefold{Mode: "fs", Root: t.TempDir(), Watch: true, Strict: true}, "watch requires"},
+	} {
+		err := tc.c.Provision(caddy.Context{})
+		if err == nil || !strings.Contains(err.Error(), tc.want) {
+			t.Errorf("expected an error containing %q, got %v", tc.want, err)
+		}
+		_ = tc.c.Cleanup()
+	}
+	c = &Casefold{Mode: "fold", Locale: "tr"}
+	if err := c.Provision(caddy.Context{}); err != nil {
+		t.Errorf("without strict: %v", err)
+	}
+}
@@ -0,0 +1,171 @@
+package casefold
+
+import (
+	"io/fs"
+	"net/http"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/caddyserver/caddy/v2"
+	"github.com/caddyserver/caddy/v2/modules/caddyhttp"
+)
+
+// suggestions returns up to n existing paths close to p, which fs mode could
+// not resolve: p is resolved case-insensitively as far as it goes, and the
+// entries of the last directory reached that are within a small edit
+// distance of the missing segment are offered, followed by the rest of p
+// when that resolves below them. Closer names come first.
+func (c *Casefold) suggestions(p string, n int) []string {
+	if c.fsys == nil {
+		return nil
+	}
+	clean := path.Clean(p)
+	if !strings.HasPrefix(clean, "/") || clean == "/" {
+		return nil
+	}
+	segs := strings.Split(clean[1:], "/")
+	if len(segs) > c.maxSegments() {
+		return nil
+	}
+	for _, s := range segs {
+		if s == ".." {
+			return nil
+		}
+	}
+	var deadline time.Time
+	if c.ResolveTimeout > 0 {
+		deadline = time.Now().Add(time.Duration(c.ResolveTimeout))
+	}
+	dir := "."
+	for i, seg := range segs {
+		entries, err := c.readDir(dir, deadline)
+		if err != nil {
+			return nil
+		}
+		folded := c.norm.fold(seg)
+		found := ""
+		for _, e := range entries {
+			if c.norm.fold(e.Name()) == folded {
+				found = e.Name()
+				break
+			}
+		}
+		if found == "" {
+			return c.closeEntries(dir, entries, folded, segs[i+1:], n)
+		}
+		if i == len(segs)-1 {
+			return nil
+		}
+		dir = path.Join(dir, found)
+		if fi, err := fs.Stat(c.fsys, dir); err != nil || !fi.IsDir() {
+			return nil
+		}
+	}
+	return nil
+}
+
+// closeEntries ranks the entries of dir within suggestEditDistance of the
+// folded segment, each followed by the resolved rest of the path.
+func (c *Casefold) closeEntries(dir string, entries []fs.DirEntry, folded string, rest []string, n int) []string {
+	type suggestion struct {
+		path string
+		dist int
+	}
+	limit := suggestEditDistance(folded)
+	var found []suggestion
+	for _, e := range entries {
+		d := editDistance(c.norm.fold(e.Name()), folded)
+		if d > limit {
+			continue
+		}
+		cand := "/" + path.Join(dir, e.Name())
+		if len(rest) > 0 {
+			if !e.IsDir() {
+				continue
+			}
+			res := c.resolveDisk(cand + "/" + strings.Join(rest, "/"))
+			if !res.ok {
+				continue
+			}
+			cand = res.canon
+		}
+		if c.hidden(cand) {
+			continue
+		}
+		found = append(found, suggestion{cand, d})
+	}
+	sort.SliceStable(found, func(i, j int) bool { return found[i].dist < found[j].dist })
+	if len(found) > n {
+		found = found[:n]
+	}
+	out := make([]string, len(found))
+	for i, s := range found {
+		out[i] = s.path
+	}
+	return out
+}
+
+// suggestEditDistance is how many edits a name may be away from a missing
+// segment to be suggested: one for short names, two from five runes.
+func suggestEditDistance(s string) int {
+	if len([]rune(s)) >= 5 {
+		return 2
+	}
+	return 1
+}
+
+// editDistance is the optimal string alignment distance between a and b,
+// in runes: the Levenshtein distance with swapping two adjacent runes
+// counted as one edit, the most common typo.
+func editDistance(a, b string) int {
+	ar, br := []rune(a), []rune(b)
+	d := make([][]int, len(ar)+1)
+	for i := range d {
+		d[i] = make([]int, len(br)+1)
+		d[i][0] = i
+	}
+	for j := range d[0] {
+		d[0][j] = j
+	}
+	for i := 1; i <= len(ar); i++ {
+		for j := 1; j <= len(br); j++ {
+			cost := 1
+			if ar[i-1] == br[j-1] {
+				cost = 0
+			}
+			d[i][j] = min(d[i-1][j]+1, d[i][j-1]+1, d[i-1][j-1]+cost)
+			if i > 1 && j > 1 && ar[i-1] == br[j-2] && ar[i-2] == br[j-1] {
+				d[i][j] = min(d[i][j], d[i-2][j-2]+1)
+			}
+		}
+	}
+	return d[len(ar)][len(br)]
+}
+
+// publishSuggestions records the suggestions for p, which fs mode could
+// not resolve, in the casefold.suggestions var and as the space-separated
+// {http.casefold.suggestions}.
+func (c *Casefold) publishSuggestions(r *http.Request, p string) {
+	fc := c.rootFor(r)
+	if fc == nil {
+		return
+	}
+	sugs := fc.suggestions(p, c.Suggest)
+	if len(sugs) == 0 {
+		return
+	}
+	caddyhttp.SetVar(r.Context(), "casefold.suggestions", sugs)
+	if repl, ok := r.Context().Value(caddy.ReplacerCtxKey).(*caddy.Replacer); ok {
+		repl.Set("http.casefold.suggestions", strings.Join(sugs, " "))
+	}
+}
+
+// setSuggestionHeader copies the published suggestions, if any, into the
+// SuggestHeader response header.
+func (c *Casefold) setSuggestionHeader(w http.ResponseWriter, r *http.Request) {
+	if sugs, ok := caddyhttp.GetVar(r.Context(), "casefold.suggestions").([]string); ok && len(sugs) > 0 {
+		w.Header().Set(c.SuggestHeader, strings.Join(sugs, ", "))
+	}
+}
@@ -0,0 +1,75 @@
+package casefold
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/caddyserver/caddy/v2"
+	"github.com/caddyserver/caddy/v2/modules/caddyhttp"
+)
+
+func TestSuggestions(t *testing.T) {
+	root := t.TempDir()
+	for _, f := range []string{"Docs/Install.html", "Docs/Guide/Intro.html", "Docs/Index.html", ".env"} {
+		p := filepath.Join(root, filepath.FromSlash(f))
+		if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, nil, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	c := &Casefold{Mode: "fs", Root: root, Suggest: 3, SuggestHeader: "X-Did-You-Mean"}
+	if err := c.Provision(caddy.Context{}); err != nil {
+		t.Fatal(err)
+	}
+	defer c.Cleanup()
+	for _, tc := range []struct {
+		path string
+		want []string
+	}{
+		{"/docs/instal.html", []string{"/Docs/Install.html"}},
+		{"/DOCS/Indx.html", []string{"/Docs/Index.html"}},
+		{"/dcos/guide/intro.html", []string{"/Docs/Guide/Intro.html"}},
+		{"/docs/nothing-like-it", nil},
+		{"/.envv", nil}, // hidden
+		{"/docs/install.html", nil},
+	} {
+		vars := map[string]any{}
+		req := httptest.NewRequest(http.MethodGet, tc.path, nil)
+		req = req.WithContext(context.WithValue(req.Context(), caddyhttp.VarsCtxKey, vars))
+		rr := httptest.NewRecorder()
+		if err := c.ServeHTTP(rr, req, recordHandler{t}); err != nil {
+			t.Fatal(err)
+		}
+		got, _ := vars["casefold.suggestions"].([]string)
+		if !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("%s: expected suggestions %q, got %q", tc.path, tc.want, got)
+		}
+		if len(tc.want) > 0 && rr.Header().Get("X-Did-You-Mean") != tc.want[0] {
+			t.Errorf("%s: expected header %q, got %q", tc.path, tc.want[0], rr.Header().Get("X-Did-You-Mean"))
+		}
+	}
+}
+
+func TestEditDistance(t *testing.T) {
+	for _, tc := range []struct {
+		a, b string
+		want int
+	}{
+		{"install", "instal", 1},
+		{"docs", "dcos", 1},
+		{"", "abc", 3},
+		{"straße", "strasse", 2},
+		{"same", "same", 0},
+	} {
+		if got := editDistance(tc.a, tc.b); got != tc.want {
+			t.Errorf("editDistance(%q, %q) = %d, want %d", tc.a, tc.b, got, tc.want)
+		}
+	}
+}
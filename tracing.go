@@ -0,0 +1,35 @@
+package casefold
+
+import (
+	"net/http"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// traceDecision records the rewrite decision on the request's active span,
+// if Caddy's tracing handler started a recording one.
+func traceDecision(r *http.Request, orig, canon string, rewritten bool, mode string) {
+	span := trace.SpanFromContext(r.Context())
+	if !span.IsRecording() {
+		return
+	}
+	span.SetAttributes(
+		attribute.String("casefold.original_path", orig),
+		attribute.String("casefold.path", canon),
+		attribute.Bool("casefold.rewritten", rewritten),
+		attribute.String("casefold.mode", mode),
+	)
+}
+
+// traceFSLookup records which layer answered an fs mode lookup.
+func traceFSLookup(r *http.Request, source string) {
+	span := trace.SpanFromContext(r.Context())
+	if !span.IsRecording() {
+		return
+	}
+	span.SetAttributes(
+		attribute.String("casefold.fs_source", source),
+		attribute.Bool("casefold.cache_hit", source != fsSourceDisk),
+	)
+}
@@ -0,0 +1,57 @@
+package casefold
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/caddyserver/caddy/v2"
+	"go.opentelemetry.io/otel/attribute"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestCasefoldSpanAttributes(t *testing.T) {
+	root := t.TempDir()
+	if err := os.WriteFile(filepath.Join(root, "Readme.md"), nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	c := &Casefold{Mode: "fs", Root: root, CacheSize: 4}
+	if err := c.Provision(caddy.Context{}); err != nil {
+		t.Fatal(err)
+	}
+	defer c.Cleanup()
+
+	rec := tracetest.NewSpanRecorder()
+	tracer := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(rec)).Tracer("test")
+	for i := 0; i < 2; i++ {
+		req := httptest.NewRequest(http.MethodGet, "/README.MD", nil)
+		ctx, span := tracer.Start(req.Context(), "request")
+		if err := c.ServeHTTP(httptest.NewRecorder(), req.WithContext(ctx), recordHandler{t}); err != nil {
+			t.Fatal(err)
+		}
+		span.End()
+	}
+
+	spans := rec.Ended()
+	if len(spans) != 2 {
+		t.Fatalf("expected 2 spans, got %d", len(spans))
+	}
+	for i, want := range []bool{false, true} {
+		attrs := map[attribute.Key]attribute.Value{}
+		for _, kv := range spans[i].Attributes() {
+			attrs[kv.Key] = kv.Value
+		}
+		if attrs["casefold.original_path"].AsString() != "/README.MD" || attrs["casefold.path"].AsString() != "/Readme.md" {
+			t.Fatalf("span %d: unexpected paths %v", i, attrs)
+		}
+		if !attrs["casefold.rewritten"].AsBool() || attrs["casefold.mode"].AsString() != "fs" {
+			t.Fatalf("span %d: unexpected decision %v", i, attrs)
+		}
+		if got := attrs["casefold.cache_hit"].AsBool(); got != want {
+			t.Fatalf("span %d: expected cache_hit %v, got %v", i, want, got)
+		}
+	}
+}
@@ -0,0 +1,73 @@
+package casefold
+
+import (
+	"io/fs"
+	"net/http"
+	"strings"
+)
+
+// TrailingSlash policies.
+const (
+	trailingSlashKeep   = "keep"
+	trailingSlashAdd    = "add"
+	trailingSlashRemove = "remove"
+)
+
+func validTrailingSlash(p string) bool {
+	switch p {
+	case "", trailingSlashKeep, trailingSlashAdd, trailingSlashRemove:
+		return true
+	}
+	return false
+}
+
+// trailingSlash gives p, transformed from orig, the trailing slash the
+// TrailingSlash policy asks for: orig's under keep. With an fs step the
+// policy only moves a path towards file_server's form, so add applies to
+// directories and remove to files; paths not found on disk keep orig's.
+func (c *Casefold) trailingSlash(r *http.Request, orig, p string) string {
+	had := strings.HasSuffix(orig, "/")
+	p = strings.TrimSuffix(p, "/")
+	if p == "" {
+		return "/"
+	}
+	want := had
+	switch c.TrailingSlash {
+	case trailingSlashAdd:
+		want = true
+	case trailingSlashRemove:
+		want = false
+	}
+	if want != had && c.hasStep("fs") {
+		if dir, found := c.isDir(r, p); !found || dir != want {
+			want = had
+		}
+	}
+	if want {
+		return p + "/"
+	}
+	return p
+}
+
+// isDir reports whether p names a directory under r's root or one of
+// FallbackRoots; found is false if it exists under none of them.
+func (c *Casefold) isDir(r *http.Request, p string) (dir, found bool) {
+	for _, fc := range append([]*Casefold{c.rootFor(r)}, c.fallbacks...) {
+		if fc == nil || fc.fsys == nil {
+			continue
+		}
+		if fi, err := fs.Stat(fc.fsys, fsPath(p)); err == nil {
+			return fi.IsDir(), true
+		}
+	}
+	return false, false
+}
+
+// matchTrailingSlash gives raw, an escaped path, the trailing slash of p.
+func matchTrailingSlash(raw, p string) string {
+	raw = strings.TrimSuffix(raw, "/")
+	if strings.HasSuffix(p, "/") {
+		return raw + "/"
+	}
+	return raw
+}
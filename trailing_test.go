@@ -0,0 +1,61 @@
+package casefold
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/caddyserver/caddy/v2"
+)
+
+func TestTrailingSlash(t *testing.T) {
+	root := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(root, "Docs"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(root, "Docs", "Intro.html"), nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	for _, tc := range []struct {
+		mode, policy, target, want string
+	}{
+		{"fs", "", "/docs/", "/Docs/"},
+		{"fs", "keep", "/docs", "/Docs"},
+		{"fs", "add", "/docs", "/Docs/"},
+		{"fs", "add", "/docs/intro.html", "/Docs/Intro.html"},
+		{"fs", "remove", "/docs/intro.html/", "/Docs/Intro.html"},
+		{"fs", "remove", "/docs/", "/Docs/"},
+		{"lower", "add", "/Guide", "/guide/"},
+		{"lower", "remove", "/Guide/", "/guide"},
+		{"lower", "remove", "/", "/"},
+	} {
+		c := &Casefold{Mode: tc.mode, Root: root, TrailingSlash: tc.policy}
+		if err := c.Provision(caddy.Context{}); err != nil {
+			t.Fatal(err)
+		}
+		rr := httptest.NewRecorder()
+		if err := c.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, tc.target, nil), recordHandler{t}); err != nil {
+			t.Fatal(err)
+		}
+		if got := rr.Header().Get("X-Final-Path"); got != tc.want {
+			t.Errorf("%s %q %s: expected %s, got %s", tc.mode, tc.policy, tc.target, tc.want, got)
+		}
+	}
+
+	c := &Casefold{Mode: "fs", Root: root, TrailingSlash: "add", Redirect: true}
+	if err := c.Provision(caddy.Context{}); err != nil {
+		t.Fatal(err)
+	}
+	rr := httptest.NewRecorder()
+	if err := c.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/docs?x=1", nil), recordHandler{t}); err != nil {
+		t.Fatal(err)
+	}
+	if got := rr.Header().Get("Location"); got != "/Docs/?x=1" {
+		t.Errorf("redirect: expected Location /Docs/?x=1, got %s", got)
+	}
+	if err := (&Casefold{Mode: "lower", TrailingSlash: "both"}).Provision(caddy.Context{}); err == nil {
+		t.Error("expected an invalid trailing_slash to be rejected")
+	}
+}
@@ -0,0 +1,37 @@
+package casefold
+
+import (
+	"net/http"
+
+	"go.uber.org/zap"
+)
+
+// Transformer is implemented by guest modules in the
+// http.handlers.casefold.transforms namespace. Transformers let third
+// parties ship their own pipeline steps (slugifiers, organization-specific
+// rules) that slot into Transforms next to the built-in steps, under their
+// module name.
+//
+// Transform receives the request and the previous step's output and returns
+// the path to hand to the next step. If it returns an error, the request
+// passes through unchanged. Transformers are called concurrently and must
+// be safe for concurrent use.
+type Transformer interface {
+	Transform(r *http.Request, p string) (string, error)
+}
+
+// applyTransformer runs the guest module registered for step on p.
+func (c *Casefold) applyTransformer(r *http.Request, p, step string) (string, bool) {
+	t, ok := c.transformers[step]
+	if !ok {
+		return p, false
+	}
+	out, err := t.Transform(r, p)
+	if err != nil {
+		if c.log != nil {
+			c.log.Warn("casefold transform failed; passing path through", zap.String("transform", step), zap.String("path", p), zap.Error(err))
+		}
+		return p, false
+	}
+	return out, true
+}
@@ -0,0 +1,103 @@
+package casefold
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/caddyserver/caddy/v2"
+	"github.com/caddyserver/caddy/v2/caddyconfig/caddyfile"
+)
+
+func init() {
+	caddy.RegisterModule(spaceSlug{})
+}
+
+// spaceSlug is a test transform module replacing spaces with Sep.
+type spaceSlug struct {
+	Sep string `json:"sep,omitempty"`
+}
+
+func (spaceSlug) CaddyModule() caddy.ModuleInfo {
+	return caddy.ModuleInfo{
+		ID:  "http.handlers.casefold.transforms.space_slug",
+		New: func() caddy.Module { return new(spaceSlug) },
+	}
+}
+
+func (s spaceSlug) Transform(_ *http.Request, p string) (string, error) {
+	if strings.Contains(p, "\x00") {
+		return "", errors.New("NUL in path")
+	}
+	sep := s.Sep
+	if sep == "" {
+		sep = "-"
+	}
+	return strings.ReplaceAll(p, " ", sep), nil
+}
+
+func (s *spaceSlug) UnmarshalCaddyfile(d *caddyfile.Dispenser) error {
+	d.Next() // consume module name
+	for d.NextBlock(0) {
+		if d.Val() == "sep" && d.NextArg() {
+			s.Sep = d.Val()
+		}
+	}
+	return nil
+}
+
+func TestTransformModules(t *testing.T) {
+	ctx, cancel := caddy.NewContext(caddy.Context{Context: context.Background()})
+	defer cancel()
+	for _, tc := range []struct {
+		settings caddy.ModuleMap
+		in, want string
+	}{
+		{nil, "/My Docs/Read Me", "/my-docs/read-me"},
+		{caddy.ModuleMap{"space_slug": json.RawMessage(`{"sep": "_"}`)}, "/My Docs/Read Me", "/my_docs/read_me"},
+		{nil, "/Bad\x00 Path", "/Bad\x00 Path"},
+	} {
+		c := &Casefold{Transforms: []string{"lower", "space_slug"}, TransformModules: tc.settings}
+		if err := c.Provision(ctx); err != nil {
+			t.Fatal(err)
+		}
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		if got, _ := c.transform(req, tc.in); got != tc.want {
+			t.Errorf("%q: expected %q, got %q", tc.in, tc.want, got)
+		}
+	}
+}
+
+func TestTransformModulesErrors(t *testing.T) {
+	ctx, cancel := caddy.NewContext(caddy.Context{Context: context.Background()})
+	defer cancel()
+	for _, c := range []*Casefold{
+		{Transforms: []string{"no_such_module"}},
+		{Transforms: []string{"lower"}, TransformModules: caddy.ModuleMap{"space_slug": json.RawMessage(`{}`)}},
+		{Mode: "lower", TransformModules: caddy.ModuleMap{"space_slug": json.RawMessage(`{}`)}},
+	} {
+		if err := c.Provision(ctx); err == nil {
+			t.Errorf("expected %v / %v to be rejected", c.Transforms, c.TransformModules)
+		}
+	}
+}
+
+func TestUnmarshalCaddyfileTransform(t *testing.T) {
+	d := caddyfile.NewTestDispenser(`casefold {
+		transforms fold space_slug
+		transform space_slug {
+			sep +
+		}
+	}`)
+	var c Casefold
+	if err := c.UnmarshalCaddyfile(d); err != nil {
+		t.Fatal(err)
+	}
+	if got := string(c.TransformModules["space_slug"]); got != `{"sep":"+"}` {
+		t.Fatalf("unexpected transform module config %s", got)
+	}
+}
@@ -0,0 +1,96 @@
+package casefold
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// transliterations holds the built-in romanization tables, in lowercase,
+// by script name. Uppercase letters are derived from them.
+var transliterations = map[string]map[rune]string{
+	// Russian, Ukrainian and Belarusian letters, romanized the way URL
+	// slugs usually are (close to BGN/PCGN, without diacritics).
+	"cyrillic": {
+		'а': "a", 'б': "b", 'в': "v", 'г': "g", 'д': "d", 'е': "e", 'ё': "yo",
+		'ж': "zh", 'з': "z", 'и': "i", 'й': "y", 'к': "k", 'л': "l", 'м': "m",
+		'н': "n", 'о': "o", 'п': "p", 'р': "r", 'с': "s", 'т': "t", 'у': "u",
+		'ф': "f", 'х': "kh", 'ц': "ts", 'ч': "ch", 'ш': "sh", 'щ': "shch",
+		'ъ': "", 'ы': "y", 'ь': "", 'э': "e", 'ю': "yu", 'я': "ya",
+		'і': "i", 'ї': "yi", 'є': "ye", 'ґ': "g", 'ў': "u",
+	},
+	// Modern Greek, following ELOT 743 without diacritics.
+	"greek": {
+		'α': "a", 'β': "v", 'γ': "g", 'δ': "d", 'ε': "e", 'ζ': "z", 'η': "i",
+		'θ': "th", 'ι': "i", 'κ': "k", 'λ': "l", 'μ': "m", 'ν': "n", 'ξ': "x",
+		'ο': "o", 'π': "p", 'ρ': "r", 'σ': "s", 'ς': "s", 'τ': "t", 'υ': "y",
+		'φ': "f", 'χ': "ch", 'ψ': "ps", 'ω': "o",
+		'ά': "a", 'έ': "e", 'ή': "i", 'ί': "i", 'ό': "o", 'ύ': "y", 'ώ': "o",
+		'ϊ': "i", 'ϋ': "y", 'ΐ': "i", 'ΰ': "y",
+	},
+}
+
+// transliterator maps letters of selected scripts to ASCII before a path is
+// transformed. A nil transliterator leaves strings unchanged.
+type transliterator map[rune]string
+
+// newTransliterator merges the tables of the named scripts.
+func newTransliterator(scripts []string) (transliterator, error) {
+	if len(scripts) == 0 {
+		return nil, nil
+	}
+	t := make(transliterator)
+	for _, s := range scripts {
+		table, ok := transliterations[strings.ToLower(s)]
+		if !ok {
+			return nil, fmt.Errorf("unknown transliteration script %q", s)
+		}
+		for r, latin := range table {
+			t[r] = latin
+			if up := unicode.ToUpper(r); up != r {
+				if _, ok := t[up]; !ok {
+					t[up] = capitalize(latin)
+				}
+			}
+		}
+	}
+	return t, nil
+}
+
+func (t transliterator) String(s string) string {
+	if t == nil {
+		return s
+	}
+	var b strings.Builder
+	changed := false
+	for i, r := range s {
+		latin, ok := t[r]
+		if !changed {
+			if !ok {
+				continue
+			}
+			b.Grow(len(s))
+			b.WriteString(s[:i])
+			changed = true
+		}
+		if ok {
+			b.WriteString(latin)
+		} else {
+			b.WriteRune(r)
+		}
+	}
+	if !changed {
+		return s
+	}
+	return b.String()
+}
+
+// capitalize uppercases the first letter of an ASCII romanization.
+func capitalize(s string) string {
+	if s == "" {
+		return s
+	}
+	r, size := utf8.DecodeRuneInString(s)
+	return string(unicode.ToUpper(r)) + s[size:]
+}
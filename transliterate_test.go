@@ -0,0 +1,57 @@
+package casefold
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"testing/fstest"
+
+	"github.com/caddyserver/caddy/v2"
+)
+
+func TestTransliterate(t *testing.T) {
+	for _, tc := range []struct {
+		mode    string
+		scripts []string
+		in      string
+		want    string
+	}{
+		{"lower", []string{"cyrillic"}, "/Москва/Щука.html", "/moskva/shchuka.html"},
+		{"lower", []string{"cyrillic"}, "/Київ", "/kiyiv"},
+		{"title", []string{"greek"}, "/αθήνα-ΘΕΣΣΑΛΟΝΊΚΗ", "/Athina-Thessaloniki"},
+		{"lower", []string{"greek"}, "/Москва", "/москва"},
+		{"upper", []string{"cyrillic", "greek"}, "/Жук-λόγος", "/ZHUK-LOGOS"},
+		{"lower", nil, "/Москва", "/москва"},
+	} {
+		c := &Casefold{Mode: tc.mode, Transliterate: tc.scripts}
+		if err := c.Provision(caddy.Context{}); err != nil {
+			t.Fatal(err)
+		}
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		if got, _ := c.transform(req, tc.in); got != tc.want {
+			t.Errorf("%s %v %s: expected %q, got %q", tc.mode, tc.scripts, tc.in, tc.want, got)
+		}
+	}
+}
+
+func TestTransliterateFSMode(t *testing.T) {
+	c := &Casefold{Mode: "fs", Transliterate: []string{"cyrillic"}}
+	if err := c.Provision(caddy.Context{}); err != nil {
+		t.Fatal(err)
+	}
+	c.fsys = fstest.MapFS{"Moskva/index.html": &fstest.MapFile{}}
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	if got, _ := c.transform(req, "/москва/index.html"); got != "/Moskva/index.html" {
+		t.Fatalf("expected the romanized on-disk path, got %q", got)
+	}
+	// unresolved paths pass through untransliterated
+	if got, _ := c.transform(req, "/Сочи"); got != "/Сочи" {
+		t.Fatalf("expected the original path, got %q", got)
+	}
+}
+
+func TestUnknownTransliteration(t *testing.T) {
+	if err := (&Casefold{Transliterate: []string{"klingon"}}).Provision(caddy.Context{}); err == nil {
+		t.Fatal("expected unknown script to be rejected")
+	}
+}
@@ -0,0 +1,78 @@
+package casefold
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"sort"
+	"strings"
+)
+
+// Validate fails configurations Provision accepts but that cannot work: an
+// unknown mode, or an fs root that does not exist or is not a directory.
+// Roots holding placeholders are only known per request and are not
+// checked. Rules and Hosts are validated too.
+func (c *Casefold) Validate() error { //nolint:revive
+	if len(c.Transforms) == 0 {
+		if m := c.modeName(); m != "" && stepKinds[m] == "" {
+			return fmt.Errorf("unknown mode %q: must be one of %s", c.Mode, strings.Join(modeNames(), ", "))
+		}
+	}
+	if c.fsys != nil {
+		if err := checkRoot(c.fsys, c.Root); err != nil {
+			return err
+		}
+	}
+	for _, fc := range c.fallbacks {
+		if err := checkRoot(fc.fsys, fc.Root); err != nil {
+			return fmt.Errorf("fallback_roots: %v", err)
+		}
+	}
+	if c.onLocalDisk() {
+		for host, root := range c.HostRoots {
+			if hasPlaceholder(root) {
+				continue
+			}
+			if err := checkRoot(os.DirFS(root), root); err != nil {
+				return fmt.Errorf("roots: host %q: %v", host, err)
+			}
+		}
+	}
+	for i := range c.Rules {
+		if err := c.Rules[i].Casefold.Validate(); err != nil {
+			return fmt.Errorf("rule %d: %v", i, err)
+		}
+	}
+	for name, hc := range c.Hosts {
+		if err := hc.Validate(); err != nil {
+			return fmt.Errorf("host %q: %v", name, err)
+		}
+	}
+	return nil
+}
+
+// checkRoot reports an error unless fsys, opened at root, is a readable
+// directory.
+func checkRoot(fsys fs.FS, root string) error {
+	if fsys == nil {
+		return nil
+	}
+	fi, err := fs.Stat(fsys, ".")
+	if err != nil {
+		return fmt.Errorf("root %s: %v", root, err)
+	}
+	if !fi.IsDir() {
+		return fmt.Errorf("root %s: not a directory", root)
+	}
+	return nil
+}
+
+// modeNames lists the values Mode accepts, sorted.
+func modeNames() []string {
+	names := make([]string, 0, len(stepKinds))
+	for name := range stepKinds {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,45 @@
+package casefold
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/caddyserver/caddy/v2"
+)
+
+func TestValidate(t *testing.T) {
+	root := t.TempDir()
+	file := filepath.Join(root, "file.txt")
+	if err := os.WriteFile(file, nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	missing := filepath.Join(root, "missing")
+	for _, tc := range []struct {
+		name string
+		c    *Casefold
+		want string
+	}{
+		{"ok", &Casefold{Mode: "fs", Root: root}, ""},
+		{"templated root", &Casefold{Mode: "fs", Root: "{http.vars.site}"}, ""},
+		{"unknown mode", &Casefold{Mode: "flod"}, `unknown mode "flod"`},
+		{"missing root", &Casefold{Mode: "fs", Root: missing}, "root " + missing},
+		{"file root", &Casefold{Mode: "fs", Root: file}, "not a directory"},
+		{"fallback root", &Casefold{Mode: "fs", Root: root, FallbackRoots: []string{missing}}, "fallback_roots"},
+		{"host root", &Casefold{Mode: "fs", Root: root, HostRoots: map[string]string{"a.example": missing}}, `roots: host "a.example"`},
+		{"rule", &Casefold{Rules: []*PathRule{{Paths: []string{"/x/*"}, Casefold: Casefold{Mode: "uper"}}}}, "rule 0: unknown mode"},
+		{"host", &Casefold{Hosts: map[string]*Casefold{"a.example": {Mode: "fs", Root: missing}}}, `host "a.example"`},
+	} {
+		if err := tc.c.Provision(caddy.Context{}); err != nil {
+			t.Fatalf("%s: %v", tc.name, err)
+		}
+		err := tc.c.Validate()
+		if tc.want == "" && err != nil {
+			t.Errorf("%s: unexpected error %v", tc.name, err)
+		} else if tc.want != "" && (err == nil || !strings.Contains(err.Error(), tc.want)) {
+			t.Errorf("%s: expected an error containing %q, got %v", tc.name, tc.want, err)
+		}
+		_ = tc.c.Cleanup()
+	}
+}
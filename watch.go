@@ -0,0 +1,95 @@
+package casefold
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+
+	"github.com/fsnotify/fsnotify"
+	"go.uber.org/zap"
+)
+
+// rootWatcher watches a directory tree for entries being created, removed
+// or renamed and reports the affected path (slash-separated, relative to the
+// root with a leading slash) to onChange. fsnotify is not recursive, so every
+// directory below root is watched individually and new directories are
+// added as they appear.
+type rootWatcher struct {
+	root     string
+	w        *fsnotify.Watcher
+	onChange func(rel string)
+	log      *zap.Logger
+	done     chan struct{}
+}
+
+// newRootWatcher starts watching root. Call Close to stop.
+func newRootWatcher(root string, log *zap.Logger, onChange func(rel string)) (*rootWatcher, error) {
+	w, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, err
+	}
+	rw := &rootWatcher{root: root, w: w, onChange: onChange, log: log, done: make(chan struct{})}
+	if err := rw.addTree(root); err != nil {
+		_ = w.Close()
+		return nil, err
+	}
+	go rw.loop()
+	return rw, nil
+}
+
+// addTree adds a watch for dir and every directory below it.
+func (rw *rootWatcher) addTree(dir string) error {
+	return filepath.WalkDir(dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if p == dir {
+				return err
+			}
+			return nil // directory vanished or unreadable; skip it
+		}
+		if d.IsDir() {
+			return rw.w.Add(p)
+		}
+		return nil
+	})
+}
+
+func (rw *rootWatcher) loop() {
+	defer close(rw.done)
+	for {
+		select {
+		case ev, ok := <-rw.w.Events:
+			if !ok {
+				return
+			}
+			if !ev.Has(fsnotify.Create) && !ev.Has(fsnotify.Remove) && !ev.Has(fsnotify.Rename) {
+				continue
+			}
+			if ev.Has(fsnotify.Create) {
+				if fi, err := os.Stat(ev.Name); err == nil && fi.IsDir() {
+					if err := rw.addTree(ev.Name); err != nil && rw.log != nil {
+						rw.log.Warn("casefold watcher failed to add directory", zap.String("dir", ev.Name), zap.Error(err))
+					}
+				}
+			}
+			rel, err := filepath.Rel(rw.root, ev.Name)
+			if err != nil {
+				continue
+			}
+			rw.onChange("/" + filepath.ToSlash(rel))
+		case err, ok := <-rw.w.Errors:
+			if !ok {
+				return
+			}
+			if rw.log != nil {
+				rw.log.Warn("casefold watcher error", zap.Error(err))
+			}
+		}
+	}
+}
+
+// Close stops the watcher and waits for its event loop to exit.
+func (rw *rootWatcher) Close() error {
+	err := rw.w.Close()
+	<-rw.done
+	return err
+}